@@ -0,0 +1,645 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/layer"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// builder 按解析后的配置构建并推送镜像，create 和 build-all 共用
+type builder struct {
+	options []crane.Option
+	// registries 为这次构建使用的仓库配置，请求通过 context 交给它处理，见 registry.WithContext
+	registries *registry.Transport
+	log        *event.Logger
+	// progress 为 nil 时不统计传输进度
+	progress *progressTracker
+
+	// bases 不为 nil 时在多次构建之间共享拉取的基础镜像
+	bases *baseCache
+	// layers 不为 nil 时在多次构建之间共享层的 tar 文件
+	layers *layer.Cache
+}
+
+// buildResult 为一次构建的结果
+type buildResult struct {
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags"`
+	Platforms  []string `json:"platforms"`
+	Digest     string   `json:"digest"`
+	// Refs 为推送的每个镜像引用，格式为 repository:tag@digest
+	Refs []string `json:"refs"`
+}
+
+// craneOptions 返回附加了 extra 的 crane 选项，不修改共用的 b.options，可以并发调用
+func (b *builder) craneOptions(extra ...crane.Option) []crane.Option {
+	opts := make([]crane.Option, 0, len(b.options)+len(extra))
+	opts = append(opts, b.options...)
+	return append(opts, extra...)
+}
+
+// pull 拉取基础镜像指定平台的镜像，cached 表示镜像已由其他构建拉取
+func (b *builder) pull(ctx context.Context, image string, platform *v1.Platform) (img v1.Image, cached bool, err error) {
+	pull := func() (v1.Image, error) {
+		return crane.Pull(image, b.craneOptions(crane.WithPlatform(platform), crane.WithContext(ctx), withRegistryOptions(b.registries, image))...)
+	}
+	if b.bases == nil {
+		img, err = pull()
+		return img, false, err
+	}
+	// 使用不同仓库配置的构建不共用基础镜像
+	return b.bases.get(fmt.Sprintf("%s %s %p", image, platformToString(platform), b.registries), pull)
+}
+
+// baseCache 在多次构建之间共享基础镜像，同一镜像的同一平台只解析一次，
+// 使所有构建使用相同摘要的基础镜像；镜像的层在推送时按需读取。
+// 使用不同仓库配置（见 configureRegistries）的构建分别拉取
+type baseCache struct {
+	mu     sync.Mutex
+	images map[string]*baseImage
+}
+
+// baseImage 记录一个基础镜像的拉取结果
+type baseImage struct {
+	once sync.Once
+	img  v1.Image
+	err  error
+}
+
+func newBaseCache() *baseCache {
+	return &baseCache{images: map[string]*baseImage{}}
+}
+
+// get 返回 key 对应的镜像，还未拉取时调用 pull 拉取，并发请求同一个 key 时等待第一次拉取完成
+func (bc *baseCache) get(key string, pull func() (v1.Image, error)) (img v1.Image, cached bool, err error) {
+	bc.mu.Lock()
+	bi, ok := bc.images[key]
+	if !ok {
+		bi = &baseImage{}
+		bc.images[key] = bi
+	}
+	bc.mu.Unlock()
+
+	cached = true
+	bi.once.Do(func() {
+		cached = false
+		bi.img, bi.err = pull()
+	})
+	return bi.img, cached, bi.err
+}
+
+// configureRegistries 返回应用了配置文件中的代理、仓库连接配置和 insecure 的 Transport。
+// 配置文件没有这些设置时返回 registries，否则返回其副本，不影响同一次运行中的其他构建
+func configureRegistries(cfg *config.Config, registries *registry.Transport, log *event.Logger) (*registry.Transport, error) {
+	if cfg.Proxy == nil && len(cfg.Registries) == 0 && !cfg.Insecure {
+		return registries, nil
+	}
+	registries = registries.Clone()
+	if cfg.Proxy != nil {
+		log.Info("proxy.configure", "Applying proxy settings...", nil)
+		if err := registries.SetProxy(*cfg.Proxy); err != nil {
+			return nil, fmt.Errorf("failed to configure proxy: %w", err)
+		}
+	}
+	if len(cfg.Registries) > 0 {
+		log.Info("registries.configure", fmt.Sprintf("Applying settings for %d registries...", len(cfg.Registries)), event.Fields{"count": len(cfg.Registries)})
+		if err := registries.Configure(cfg.Registries); err != nil {
+			return nil, fmt.Errorf("failed to configure registries: %w", err)
+		}
+	}
+
+	// 配置文件中的 insecure 只作用于基础镜像和目标镜像所在的仓库
+	if cfg.Insecure {
+		insecureRegs, err := buildRegistries(cfg)
+		if err != nil {
+			return nil, err
+		}
+		regs := make(map[string]config.RegistryConfig, len(insecureRegs))
+		for _, reg := range insecureRegs {
+			log.Warn("registries.insecure", fmt.Sprintf("insecure is set, TLS verification is disabled for registry %s", reg), event.Fields{"registry": reg})
+			regs[reg] = config.RegistryConfig{Insecure: true}
+		}
+		if err := registries.Configure(regs); err != nil {
+			return nil, fmt.Errorf("failed to configure registries: %w", err)
+		}
+	}
+	return registries, nil
+}
+
+// ociLayerTypes 为 Docker 格式的层对应的 OCI 媒体类型
+var ociLayerTypes = map[types.MediaType]types.MediaType{
+	types.DockerLayer:             types.OCILayer,
+	types.DockerUncompressedLayer: types.OCIUncompressedLayer,
+	types.DockerForeignLayer:      types.OCIRestrictedLayer,
+}
+
+// dockerToOCI 将 Docker 格式的镜像转换为 OCI 格式：清单、配置和层改用对应的 OCI 媒体类型，
+// 配置和层的内容不变，远程镜像的层仍在推送时按需读取
+func dockerToOCI(img v1.Image) (v1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) != len(manifest.Layers) {
+		return nil, fmt.Errorf("manifest lists %d layers, image has %d", len(manifest.Layers), len(layers))
+	}
+
+	adds := make([]mutate.Addendum, len(layers))
+	for i, l := range layers {
+		desc := manifest.Layers[i]
+		mt, ok := ociLayerTypes[desc.MediaType]
+		if !ok {
+			mt = desc.MediaType
+		}
+		adds[i] = mutate.Addendum{Layer: l, URLs: desc.URLs, Annotations: desc.Annotations, MediaType: mt}
+	}
+	oci := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	if oci, err = mutate.Append(oci, adds...); err != nil {
+		return nil, err
+	}
+	// 使用原来的配置，保留历史记录和 rootfs
+	return mutate.ConfigFile(oci, cf)
+}
+
+// build 按配置构建所有平台的镜像，合并为镜像索引后推送到所有 tag，
+// dir 为层的相对路径的基准目录：create 为当前目录，build-all 为各个配置文件所在目录
+func (b *builder) build(ctx context.Context, cfg *config.Config, dir string) (*buildResult, error) {
+	log := b.log
+	if b.registries != nil {
+		ctx = registry.WithContext(ctx, b.registries)
+	}
+	// 构建的当前时间，creationTime 和层属性 timestamp 中的 USE_CURRENT_TIMESTAMP 都使用它
+	now := time.Now()
+
+	// 4. 从配置中提取平台信息
+	platforms := layer.ExtractPlatforms(cfg.From)
+	log.Info("platforms", fmt.Sprintf("Platforms: %v", platforms), event.Fields{"platforms": platforms})
+
+	// 5. 创建临时目录用于存储中间产物
+	rootTmpDir, err := os.MkdirTemp("", "crane-job-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root temp dir: %w", err)
+	}
+	defer os.RemoveAll(rootTmpDir)
+	log.Info("tmpdir", fmt.Sprintf("Using temp directory: %s", rootTmpDir), event.Fields{"dir": rootTmpDir})
+
+	// OCI layout 目录
+	ociLayoutDir := filepath.Join(rootTmpDir, "oci-layout")
+	if err := os.MkdirAll(ociLayoutDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create OCI layout dir: %w", err)
+	}
+
+	// 6. 处理所有层，创建 tar 文件
+	step := log.Start("layers", fmt.Sprintf("Preparing %d layers...", len(cfg.Layers.Entries)), event.Fields{"count": len(cfg.Layers.Entries)})
+	layersCtx, span := trace.Start(ctx, "layers", trace.Int("layers.count", int64(len(cfg.Layers.Entries))))
+	var layerPaths []string
+	if b.layers != nil {
+		layerPaths, err = b.layers.ProcessLayers(layersCtx, cfg, dir, now, log)
+	} else {
+		layerPaths, err = layer.ProcessLayers(layersCtx, cfg, dir, rootTmpDir, now, log)
+	}
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, fmt.Errorf("failed to process layers: %w", err)
+	}
+	step.Done("", nil)
+
+	// 镜像创建时间：creationTime，未设置时使用 SOURCE_DATE_EPOCH，都未设置时为当前时间
+	createdTime, err := config.ResolveTime(cfg.CreationTime, now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creation time: %w", err)
+	}
+	log.Info("config.set.created", fmt.Sprintf("Setting creation time: %v", createdTime), event.Fields{"created": createdTime})
+
+	// 健康检查对所有平台相同，只转换一次
+	var healthcheck *v1.HealthConfig
+	if cfg.Healthcheck != nil {
+		if healthcheck, err = cfg.Healthcheck.HealthConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 从标签和当前目录所在的 git 仓库生成 OCI 标准注解，与 ${git.*} 模板函数使用同一个仓库
+	var derivedAnnotations map[string]string
+	if cfg.Annotations.Derive {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		derivedAnnotations = config.DeriveAnnotations(cfg.Labels, createdTime, wd)
+		log.Info("annotations.derive", fmt.Sprintf("Derived %d OCI annotations", len(derivedAnnotations)), event.Fields{"annotations": derivedAnnotations})
+	}
+
+	// 7. 处理每个平台
+	// 存储每个平台的镜像信息
+	platformImageRefs := make([]string, 0, len(platforms))
+
+	for _, targetPlatform := range platforms {
+		platformStep := log.Start("platform", fmt.Sprintf("Processing platform: %s", targetPlatform), event.Fields{"platform": targetPlatform})
+		// 出错返回时未结束的 span 在写入 trace 文件时结束，错误记录在 build span 上
+		platformCtx, platformSpan := trace.Start(ctx, "platform", trace.String("platform", targetPlatform))
+
+		// 解析平台字符串
+		platform, err := parsePlatform(targetPlatform)
+		if err != nil {
+			return nil, fmt.Errorf("parsing platform %s: %w", targetPlatform, err)
+		}
+
+		// 8. 拉取基础镜像
+		step := log.Start("platform.pull", fmt.Sprintf("Pulling base image: %s", cfg.From.Image), event.Fields{"image": cfg.From.Image, "platform": targetPlatform})
+		// 镜像的层在保存时才按需下载，使用 platformCtx 使这些请求的 span 属于平台而不是已结束的 pull
+		_, span := trace.Start(platformCtx, "pull", trace.String("image", cfg.From.Image))
+		img, cached, err := b.pull(platformCtx, cfg.From.Image, platform)
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return nil, fmt.Errorf("pulling base image %s: %w", cfg.From.Image, err)
+		}
+		// 基础镜像的层在保存到 OCI layout 时下载
+		img = b.progress.image(img)
+		if cached {
+			step.Done("Reusing base image pulled by another build", event.Fields{"cached": true})
+		} else {
+			step.Done("", nil)
+		}
+
+		// 9. 添加层
+		if len(layerPaths) > 0 {
+			log.Info("platform.layer.append", fmt.Sprintf("Adding %d layers...", len(layerPaths)), event.Fields{"count": len(layerPaths)})
+			_, span = trace.Start(platformCtx, "append", trace.Int("layers.count", int64(len(layerPaths))))
+			img, err = crane.Append(img, layerPaths...)
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				return nil, fmt.Errorf("adding layer %w", err)
+			}
+		}
+
+		// 10. 获取并修改配置
+		_, span = trace.Start(platformCtx, "mutate")
+		imgCfg, err := img.ConfigFile()
+		if err != nil {
+			span.SetError(err)
+			span.End()
+			return nil, fmt.Errorf("getting config file: %w", err)
+		}
+		imgCfg = imgCfg.DeepCopy()
+
+		// 10.1 设置创建时间
+		imgCfg.Created = v1.Time{Time: createdTime}
+
+		// 10.2 设置新增层的历史记录，crane.Append 为每个层添加的是空记录
+		if n := len(layerPaths); n > 0 && n == len(cfg.Layers.Entries) && len(imgCfg.History) >= n {
+			for i, entry := range cfg.Layers.Entries {
+				imgCfg.History[len(imgCfg.History)-n+i] = layer.LayerHistory(entry, createdTime, cfg.History.Author)
+			}
+		}
+
+		// 11. 设置环境变量，保持基础镜像中的顺序，并展开对已有变量的引用
+		if len(cfg.Environment) > 0 || len(cfg.Remove.Environment) > 0 || !config.Inherits(cfg.Inherit.Environment, true) {
+			log.Info("config.set.env", "Setting environment variables...", nil)
+			env, missing, err := config.BuildEnv(imgCfg.Config.Env, cfg)
+			if err != nil {
+				span.SetError(err)
+				span.End()
+				return nil, fmt.Errorf("setting environment variables: %w", err)
+			}
+			for _, k := range missing {
+				log.Warn("config.remove.env", fmt.Sprintf("Environment variable %s is not set in the base image", k), event.Fields{"name": k})
+			}
+			imgCfg.Config.Env = env
+			if len(env) == 0 {
+				imgCfg.Config.Env = nil
+			}
+		}
+
+		// 12. 设置标签
+		inheritLabels := config.Inherits(cfg.Inherit.Labels, true)
+		if len(cfg.Labels) > 0 || len(cfg.Remove.Labels) > 0 || !inheritLabels {
+			log.Info("config.set.labels", "Setting labels...", nil)
+			// 构建标签映射
+			labelMap := make(map[string]string)
+			if inheritLabels {
+				for k, v := range imgCfg.Config.Labels {
+					labelMap[k] = v
+				}
+			}
+
+			// 删除基础镜像中的标签
+			for _, k := range cfg.Remove.Labels {
+				if _, ok := labelMap[k]; !ok {
+					log.Warn("config.remove.labels", fmt.Sprintf("Label %s is not set in the base image", k), event.Fields{"label": k})
+				}
+				delete(labelMap, k)
+			}
+
+			// 更新标签
+			for k, v := range cfg.Labels {
+				labelMap[k] = v
+			}
+
+			imgCfg.Config.Labels = labelMap
+			if len(labelMap) == 0 {
+				imgCfg.Config.Labels = nil
+			}
+		}
+
+		// 13. 设置卷
+		inheritVolumes := config.Inherits(cfg.Inherit.Volumes, true)
+		if len(cfg.Volumes) > 0 || len(cfg.Remove.Volumes) > 0 || !inheritVolumes {
+			log.Info("config.set.volumes", "Setting volumes...", nil)
+			// 构建卷映射
+			volumeMap := make(map[string]struct{})
+			if inheritVolumes {
+				for k := range imgCfg.Config.Volumes {
+					volumeMap[k] = struct{}{}
+				}
+			}
+
+			// 删除基础镜像中的卷
+			for _, k := range cfg.Remove.Volumes {
+				if _, ok := volumeMap[k]; !ok {
+					log.Warn("config.remove.volumes", fmt.Sprintf("Volume %s is not declared in the base image", k), event.Fields{"volume": k})
+				}
+				delete(volumeMap, k)
+			}
+
+			// 更新卷
+			for _, v := range cfg.Volumes {
+				volumeMap[v] = struct{}{}
+			}
+
+			imgCfg.Config.Volumes = volumeMap
+			if len(volumeMap) == 0 {
+				imgCfg.Config.Volumes = nil
+			}
+		}
+
+		// 12. 设置命令
+		// 与 Docker 一致，只设置入口点时不继承基础镜像的命令，除非显式设置 inherit.cmd
+		inheritCmd := config.Inherits(cfg.Inherit.Cmd, len(cfg.Entrypoint) == 0)
+		if len(cfg.Cmd) > 0 {
+			log.Info("config.set.cmd", fmt.Sprintf("Setting command: %v", cfg.Cmd), event.Fields{"cmd": cfg.Cmd})
+			imgCfg.Config.Cmd = cfg.Cmd
+		} else if !inheritCmd && len(imgCfg.Config.Cmd) > 0 {
+			log.Info("config.reset.cmd", fmt.Sprintf("Clearing inherited command: %v", imgCfg.Config.Cmd), event.Fields{"cmd": imgCfg.Config.Cmd})
+			imgCfg.Config.Cmd = nil
+		}
+
+		// 13. 设置入口点
+		if len(cfg.Entrypoint) > 0 {
+			log.Info("config.set.entrypoint", fmt.Sprintf("Setting entrypoint: %v", cfg.Entrypoint), event.Fields{"entrypoint": cfg.Entrypoint})
+			imgCfg.Config.Entrypoint = cfg.Entrypoint
+		} else if !config.Inherits(cfg.Inherit.Entrypoint, true) && len(imgCfg.Config.Entrypoint) > 0 {
+			log.Info("config.reset.entrypoint", fmt.Sprintf("Clearing inherited entrypoint: %v", imgCfg.Config.Entrypoint), event.Fields{"entrypoint": imgCfg.Config.Entrypoint})
+			imgCfg.Config.Entrypoint = nil
+		}
+
+		// 14. 设置用户
+		if cfg.User != "" {
+			log.Info("config.set.user", fmt.Sprintf("Setting user: %s", cfg.User), event.Fields{"user": cfg.User})
+			imgCfg.Config.User = cfg.User
+		}
+
+		// 15. 设置工作目录
+		if cfg.WorkingDir != "" {
+			log.Info("config.set.workdir", fmt.Sprintf("Setting working directory: %s", cfg.WorkingDir), event.Fields{"workingDir": cfg.WorkingDir})
+			imgCfg.Config.WorkingDir = cfg.WorkingDir
+		}
+
+		// 16. 设置暴露端口，规范化为 端口/协议 并展开端口范围
+		if len(cfg.ExposedPorts) > 0 || len(cfg.Remove.ExposedPorts) > 0 || !config.Inherits(cfg.Inherit.ExposedPorts, true) {
+			log.Info("config.set.ports", fmt.Sprintf("Setting exposed ports: %v", cfg.ExposedPorts), event.Fields{"exposedPorts": cfg.ExposedPorts})
+			ports, missing, err := config.BuildPorts(imgCfg.Config.ExposedPorts, cfg)
+			if err != nil {
+				span.SetError(err)
+				span.End()
+				return nil, fmt.Errorf("setting exposed ports: %w", err)
+			}
+			for _, port := range missing {
+				log.Warn("config.remove.ports", fmt.Sprintf("Port %s is not exposed by the base image", port), event.Fields{"port": port})
+			}
+			imgCfg.Config.ExposedPorts = ports
+			if len(ports) == 0 {
+				imgCfg.Config.ExposedPorts = nil
+			}
+		}
+
+		// 16.1 设置健康检查
+		if healthcheck != nil {
+			log.Info("config.set.healthcheck", fmt.Sprintf("Setting healthcheck: %v", healthcheck.Test), event.Fields{"healthcheck": healthcheck})
+			imgCfg.Config.Healthcheck = healthcheck
+		}
+
+		// 16.2 设置停止信号
+		if cfg.StopSignal != "" {
+			log.Info("config.set.stopsignal", fmt.Sprintf("Setting stop signal: %s", cfg.StopSignal), event.Fields{"stopSignal": cfg.StopSignal})
+			imgCfg.Config.StopSignal = cfg.StopSignal
+		}
+
+		// 16.3 设置 shell
+		if len(cfg.Shell) > 0 {
+			log.Info("config.set.shell", fmt.Sprintf("Setting shell: %v", cfg.Shell), event.Fields{"shell": cfg.Shell})
+			imgCfg.Config.Shell = cfg.Shell
+		}
+
+		// 16.4 设置 ONBUILD 触发器
+		if len(cfg.OnBuild) > 0 {
+			log.Info("config.set.onbuild", fmt.Sprintf("Setting %d onBuild triggers", len(cfg.OnBuild)), event.Fields{"onBuild": cfg.OnBuild})
+			imgCfg.Config.OnBuild = cfg.OnBuild
+		}
+
+		// 16.5 设置 ArgsEscaped（仅 Windows 镜像使用）
+		if cfg.ArgsEscaped {
+			log.Info("config.set.argsescaped", "Setting argsEscaped", event.Fields{"argsEscaped": true})
+			imgCfg.Config.ArgsEscaped = true
+		}
+
+		// 16.6 添加配置修改的历史记录
+		if cfg.History.ConfigChanges {
+			history := layer.ConfigHistory(cfg, createdTime, cfg.History.Author)
+			log.Info("config.set.history", fmt.Sprintf("Adding %d history entries for config changes", len(history)), event.Fields{"count": len(history)})
+			imgCfg.History = append(imgCfg.History, history...)
+		}
+
+		// 17. 应用配置修改
+		log.Info("platform.cfg", "Applying config changes...", nil)
+		img, err = mutate.ConfigFile(img, imgCfg)
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return nil, fmt.Errorf("mutating config: %w", err)
+		}
+
+		// 17.1 设置镜像清单的注解。Docker 格式的清单不支持注解，基础镜像为 Docker 格式时先转换为 OCI 格式，
+		// format 为 Docker 时无法转换，跳过注解
+		if anns := cfg.Annotations.ManifestAnnotations(targetPlatform, derivedAnnotations); len(anns) > 0 {
+			mt, err := img.MediaType()
+			if err != nil {
+				return nil, fmt.Errorf("getting manifest media type: %w", err)
+			}
+			switch {
+			case mt == types.DockerManifestSchema2 && strings.EqualFold(cfg.Format, "Docker"):
+				log.Warn("platform.annotations", fmt.Sprintf("format is Docker and Docker manifests do not support annotations, skipping %d annotations", len(anns)), event.Fields{"mediaType": string(mt)})
+			case mt == types.DockerManifestSchema2:
+				log.Info("platform.format", "Converting the Docker manifest to OCI format for annotations...", event.Fields{"mediaType": string(mt)})
+				if img, err = dockerToOCI(img); err != nil {
+					return nil, fmt.Errorf("converting manifest to OCI format: %w", err)
+				}
+				fallthrough
+			default:
+				log.Info("platform.annotations", fmt.Sprintf("Setting %d manifest annotations", len(anns)), event.Fields{"annotations": anns})
+				img = mutate.Annotations(img, anns).(v1.Image)
+			}
+		}
+
+		// 获取镜像的实际平台信息（可能与配置的不同，如基础镜像不支持某平台）
+		actualPlatform := &v1.Platform{
+			OS:           imgCfg.OS,
+			Architecture: imgCfg.Architecture,
+			Variant:      imgCfg.Variant,
+		}
+		if actualPlatform.String() != platform.String() {
+			log.Warn("platform.mismatch", fmt.Sprintf("actual platform %s differs from requested %s", actualPlatform.String(), platform.String()), event.Fields{"actual": actualPlatform.String(), "requested": platform.String()})
+		}
+
+		// 多个平台，保存到同一个 OCI layout 目录（带平台信息）
+		step = log.Start("platform.save", fmt.Sprintf("Saving image to OCI layout: %s", ociLayoutDir), event.Fields{"dir": ociLayoutDir})
+		_, span = trace.Start(platformCtx, "save", trace.String("dir", ociLayoutDir))
+		var lp layout.Path
+		// 检查 OCI layout 是否已存在（通过检查 oci-layout 文件）
+		if _, err := os.Stat(filepath.Join(ociLayoutDir, "oci-layout")); os.IsNotExist(err) {
+			// 不存在，创建新的
+			lp, err = layout.Write(ociLayoutDir, empty.Index)
+			if err != nil {
+				span.SetError(err)
+				span.End()
+				return nil, fmt.Errorf("creating OCI layout: %w", err)
+			}
+		} else {
+			// 已存在，打开
+			lp, err = layout.FromPath(ociLayoutDir)
+			if err != nil {
+				span.SetError(err)
+				span.End()
+				return nil, fmt.Errorf("opening OCI layout: %w", err)
+			}
+		}
+		// 使用镜像的实际平台信息，确保 index.json 中的 platform 与镜像一致
+		err = lp.AppendImage(img, layout.WithPlatform(*actualPlatform))
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return nil, fmt.Errorf("saving image to OCI layout: %w", err)
+		}
+		step.Done("", nil)
+		platformImageRefs = append(platformImageRefs, actualPlatform.String())
+
+		platformSpan.SetAttributes(trace.String("platform.actual", actualPlatform.String()))
+		platformSpan.End()
+		platformStep.Done(fmt.Sprintf("Platform %s completed!", actualPlatform.String()), event.Fields{"actual": actualPlatform.String()})
+	}
+
+	repository := cfg.To.Repository
+	log.Info("index.create", "Creating multi-platform manifest...", nil)
+
+	// 从 OCI layout 加载索引
+	log.Info("index.combine", fmt.Sprintf("Combining %d platform images from OCI layout...", len(platformImageRefs)), event.Fields{"count": len(platformImageRefs)})
+	idx, err := layout.ImageIndexFromPath(ociLayoutDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading OCI layout as index: %w", err)
+	}
+
+	// 根据 format 配置选择推送格式
+	var pushIdx v1.ImageIndex = idx
+	if strings.EqualFold(cfg.Format, "Docker") {
+		log.Info("index.format", "Converting to Docker Manifest List format...", event.Fields{"format": "Docker"})
+		pushIdx = mutate.IndexMediaType(idx, types.DockerManifestList)
+	} else {
+		log.Info("index.format", "Using OCI Image Index format...", event.Fields{"format": "OCI"})
+	}
+
+	// 设置镜像索引的注解，Docker Manifest List 不支持注解
+	if anns := cfg.Annotations.IndexAnnotations(derivedAnnotations); len(anns) > 0 {
+		if strings.EqualFold(cfg.Format, "Docker") {
+			log.Warn("index.annotations", fmt.Sprintf("Docker manifest lists do not support annotations, skipping %d annotations", len(anns)), nil)
+		} else {
+			log.Info("index.annotations", fmt.Sprintf("Setting %d index annotations", len(anns)), event.Fields{"annotations": anns})
+			pushIdx = mutate.Annotations(pushIdx, anns).(v1.ImageIndex)
+		}
+	}
+
+	digest, err := pushIdx.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("computing index digest: %w", err)
+	}
+
+	result := &buildResult{
+		Repository: repository,
+		Tags:       cfg.To.Tags,
+		Platforms:  platformImageRefs,
+		Digest:     digest.String(),
+	}
+
+	// 推送到所有 tags（直接推送 index，不使用 crane.Tag 避免重复下载）
+	for i, tag := range cfg.To.Tags {
+		targetImage := repository + ":" + tag
+		pushCtx, span := trace.Start(ctx, "push", trace.String("ref", targetImage))
+		o := crane.GetOptions(b.craneOptions(crane.WithContext(pushCtx), withRegistryOptions(b.registries, targetImage))...)
+		if i == 0 {
+			step = log.Start("push", fmt.Sprintf("Pushing to: %s", targetImage), event.Fields{"ref": targetImage})
+		} else {
+			step = log.Start("push.tag", fmt.Sprintf("Pushing tag: %s", targetImage), event.Fields{"ref": targetImage})
+		}
+
+		ref, err := name.ParseReference(targetImage, o.Name...)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reference: %w", err)
+		}
+
+		opts := o.Remote
+		updates, wait := b.progress.push(targetImage)
+		if updates != nil {
+			opts = append(opts[:len(opts):len(opts)], remote.WithProgress(updates))
+		}
+		err = remote.WriteIndex(ref, pushIdx, opts...)
+		if err == nil {
+			wait()
+		}
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return nil, fmt.Errorf("pushing multi-platform index to %s: %w", targetImage, err)
+		}
+		step.Done("", event.Fields{"digest": digest.String()})
+		result.Refs = append(result.Refs, fmt.Sprintf("%s@%s", targetImage, digest))
+	}
+	return result, nil
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// TestBaseCacheGet 测试并发请求同一个基础镜像时只拉取一次，不同的 key 分别拉取
+func TestBaseCacheGet(t *testing.T) {
+	img, err := random.Image(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newBaseCache()
+	var pulls, uncached int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, cached, err := bc.get("base linux/amd64", func() (v1.Image, error) {
+				atomic.AddInt32(&pulls, 1)
+				return img, nil
+			})
+			if err != nil || got != img {
+				t.Errorf("Expected the pulled image, got %v, %v", got, err)
+			}
+			if !cached {
+				atomic.AddInt32(&uncached, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if pulls != 1 || uncached != 1 {
+		t.Errorf("Expected one pull, got %d pulls and %d uncached results", pulls, uncached)
+	}
+
+	// 拉取失败时之后的请求返回相同的错误
+	pullErr := errors.New("manifest unknown")
+	for i := 0; i < 2; i++ {
+		_, cached, err := bc.get("base linux/arm64", func() (v1.Image, error) {
+			atomic.AddInt32(&pulls, 1)
+			return nil, pullErr
+		})
+		if !errors.Is(err, pullErr) || cached != (i > 0) {
+			t.Errorf("Expected the pull error (cached %v), got %v (cached %v)", i > 0, err, cached)
+		}
+	}
+	if pulls != 2 {
+		t.Errorf("Expected a separate pull for another platform, got %d pulls", pulls)
+	}
+}
+
+// TestBuildTraceSpans 测试基础镜像的层在保存时按需下载，这些请求的 span 属于平台 span
+func TestBuildTraceSpans(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.OS, cf.Architecture = "linux", "amd64"
+	if base, err = mutate.ConfigFile(base, cf); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(base, u.Host+"/base:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "jib.yaml")
+	content := "from:\n  image: " + u.Host + "/base:latest\nto: " + u.Host + "/app:v1\ncreationTime: 0\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, _, err := loadConfig(file, config.LoadOptions{}, nil, nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	registries := registry.NewTransport(http.DefaultTransport.(*http.Transport).Clone())
+	b := &builder{
+		options:    []crane.Option{crane.WithTransport(&traceTransport{inner: registries})},
+		registries: registries,
+	}
+	tracer := trace.NewTracer("test", "")
+	if _, err := b.build(trace.WithTracer(context.Background(), tracer), cfg, dir); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tracer.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key   string `json:"key"`
+						Value struct {
+							StringValue string `json:"stringValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	spans := out.ResourceSpans[0].ScopeSpans[0].Spans
+	platformID := ""
+	for _, span := range spans {
+		if span.Name == "platform" {
+			platformID = span.SpanID
+		}
+	}
+	if platformID == "" {
+		t.Fatal("Expected a platform span")
+	}
+	blobs := 0
+	for _, span := range spans {
+		if span.Name != http.MethodGet {
+			continue
+		}
+		for _, a := range span.Attributes {
+			if a.Key == "url.full" && strings.Contains(a.Value.StringValue, "/base/blobs/") {
+				blobs++
+				if span.ParentSpanID != platformID {
+					t.Errorf("Expected %s to belong to the platform span", a.Value.StringValue)
+				}
+			}
+		}
+	}
+	// 配置和两个层
+	if blobs != 3 {
+		t.Errorf("Expected 3 blob downloads, got %d", blobs)
+	}
+}
+
+// TestBuildManifestAnnotations 测试基础镜像为 Docker 格式时先转换为 OCI 格式再设置清单的注解，
+// format 为 Docker 时跳过注解并警告
+func TestBuildManifestAnnotations(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.OS, cf.Architecture = "linux", "amd64"
+	if base, err = mutate.ConfigFile(base, cf); err != nil {
+		t.Fatal(err)
+	}
+	if mt, _ := base.MediaType(); mt != types.DockerManifestSchema2 {
+		t.Fatalf("Expected a Docker base image, got %s", mt)
+	}
+	if err := crane.Push(base, u.Host+"/base:latest"); err != nil {
+		t.Fatal(err)
+	}
+	baseLayers, err := base.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseDigest, err := baseLayers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, format := range []string{"OCI", "Docker"} {
+		file := filepath.Join(dir, format+".yaml")
+		content := "from:\n  image: " + u.Host + "/base:latest\nto: " + u.Host + "/app:" + strings.ToLower(format) + "\n" +
+			"format: " + format + "\ncreationTime: 0\nannotations:\n  manifest:\n    com.example.team: platform\n"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, _, err := loadConfig(file, config.LoadOptions{}, nil, nil)
+		if err != nil {
+			t.Fatalf("loadConfig failed: %v", err)
+		}
+		var logs strings.Builder
+		b := &builder{registries: registry.NewTransport(http.DefaultTransport.(*http.Transport).Clone()), log: event.New(&logs)}
+		result, err := b.build(context.Background(), cfg, dir)
+		if err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+
+		idx, err := remote.Index(mustParseRef(t, u.Host+"/app@"+result.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := idx.Image(im.Manifests[0].Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if format == "Docker" {
+			if m.MediaType != types.DockerManifestSchema2 || m.Annotations != nil {
+				t.Errorf("Expected a Docker manifest without annotations, got %s %v", m.MediaType, m.Annotations)
+			}
+			if !strings.Contains(logs.String(), "skipping 1 annotations") {
+				t.Errorf("Expected a warning about skipped annotations, got:\n%s", logs.String())
+			}
+			continue
+		}
+		if m.MediaType != types.OCIManifestSchema1 || m.Config.MediaType != types.OCIConfigJSON {
+			t.Errorf("Expected an OCI manifest, got %s with config %s", m.MediaType, m.Config.MediaType)
+		}
+		if m.Annotations["com.example.team"] != "platform" {
+			t.Errorf("Expected the manifest annotation to be set, got %v", m.Annotations)
+		}
+		// 层的内容不变，只改变媒体类型
+		if m.Layers[0].Digest != baseDigest || m.Layers[0].MediaType != types.OCILayer {
+			t.Errorf("Expected the base layer %s as an OCI layer, got %s %s", baseDigest, m.Layers[0].Digest, m.Layers[0].MediaType)
+		}
+	}
+}
+
+// mustParseRef 解析镜像引用，失败时终止测试
+func mustParseRef(t *testing.T, ref string) name.Reference {
+	t.Helper()
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/layer"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+)
+
+// build-all 中每个构建的状态
+const (
+	buildSucceeded = "succeeded"
+	buildFailed    = "failed"
+	buildSkipped   = "skipped"
+)
+
+// buildAllEntry 为 build-all 中一个构建的结果，成功时包含 buildResult 的字段
+type buildAllEntry struct {
+	Name       string `json:"name"`
+	Config     string `json:"config"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	*buildResult
+
+	cfg *config.Config
+	// dir 为配置文件中相对路径的基准目录
+	dir string
+	// registries 为应用了配置文件中仓库配置的 Transport，见 configureRegistries
+	registries *registry.Transport
+	log        *event.Logger
+}
+
+// buildAllResult 为 --result-file 输出的汇总结果
+type buildAllResult struct {
+	Builds     []*buildAllEntry `json:"builds"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	DurationMS int64            `json:"duration_ms"`
+}
+
+// NewCmdBuildAll creates a new cobra.Command for the build-all subcommand.
+func NewCmdBuildAll(options *[]crane.Option, s *session) *cobra.Command {
+	var vars varFlags
+	var workspaceFile string
+	var profiles []string
+	var jobs int
+	var failFast bool
+	var resultFile string
+	var trustTemplates bool
+
+	buildAllCmd := &cobra.Command{
+		Use:   "build-all [CONFIG|PATTERN]...",
+		Short: "Build the images of several configuration files concurrently, sharing base images, layers and registry sessions.",
+		Example: `  # Build every service of a monorepo, 4 at a time
+  crane-jib-tool build-all 'services/**/jib.yaml' --jobs 4
+
+  # Build the configs listed in a workspace file and record the results
+  crane-jib-tool build-all --workspace jib-workspace.yaml --result-file results.json`,
+		RunE: func(c *cobra.Command, args []string) (err error) {
+			// 1. 确定要构建的配置文件
+			var ws *config.Workspace
+			switch {
+			case workspaceFile != "" && len(args) > 0:
+				return errors.New("config files and --workspace cannot be used together")
+			case workspaceFile != "":
+				if ws, err = config.LoadWorkspace(workspaceFile); err != nil {
+					return err
+				}
+			case len(args) > 0:
+				ws = &config.Workspace{}
+				for _, arg := range args {
+					ws.Builds = append(ws.Builds, config.WorkspaceBuild{Config: arg})
+				}
+			default:
+				return errors.New("no config files, pass config files or patterns as arguments or use --workspace")
+			}
+			ws.Profiles = append(ws.Profiles, profiles...)
+			builds, err := ws.Expand()
+			if err != nil {
+				return err
+			}
+			if !c.Flags().Changed("jobs") && ws.Jobs > 0 {
+				jobs = ws.Jobs
+			}
+			if jobs < 1 {
+				return errors.New("--jobs must be at least 1")
+			}
+
+			log := s.log
+			defer s.progress.Finish()
+			defer s.writeTrace()
+			start := time.Now()
+			ctx, cancel := context.WithCancel(c.Context())
+			defer cancel()
+
+			// 2. 读取所有配置文件，每个构建的代理和仓库配置应用到各自的 Transport 副本
+			basePool, baseSources, err := vars.pool(s.log)
+			if err != nil {
+				return err
+			}
+			loadOpts := config.LoadOptions{Fetch: fetchTemplate(ctx, *options, s), TrustTemplates: trustTemplates}
+			entries := make([]*buildAllEntry, len(builds))
+			for i, b := range builds {
+				entries[i] = &buildAllEntry{
+					Name:   b.Name,
+					Config: b.Config,
+					Status: buildSkipped,
+					log:    log.With(b.Name, event.Fields{"build": b.Name}),
+				}
+			}
+			for i, b := range builds {
+				entry := entries[i]
+				pool := make(map[string]string, len(basePool)+len(b.Vals))
+				sources := make(map[string]string, len(baseSources)+len(b.Vals))
+				for k, v := range basePool {
+					pool[k] = v
+					sources[k] = baseSources[k]
+				}
+				for k, v := range b.Vals {
+					pool[k] = v
+					sources[k] = "workspace"
+				}
+				// 命令行中的 --val 优先级最高
+				for k, v := range vars.vals {
+					pool[k] = v
+					sources[k] = config.SourceVal
+				}
+				opts := loadOpts
+				opts.VarSources = sources
+
+				step := entry.log.Start("config.parse", "Parsing configuration file...", event.Fields{"file": b.Config})
+				cfg, _, overrides, err := loadConfig(b.Config, opts, pool, b.Profiles)
+				if err != nil {
+					entry.fail(fmt.Errorf("failed to parse config file: %w", err))
+					if failFast {
+						cancel()
+						break
+					}
+					continue
+				}
+				step.Done("", event.Fields{"from": cfg.From.Image, "to": cfg.To.Repository})
+				for _, o := range overrides {
+					entry.log.Info("config.profile", fmt.Sprintf("Applied profile %s, overriding: %s", o.Profile, overriddenFields(o)), event.Fields{"profile": o.Profile, "fields": o.Fields})
+				}
+
+				if entry.registries, err = configureRegistries(cfg, s.registries, entry.log); err != nil {
+					entry.fail(err)
+					if failFast {
+						cancel()
+						break
+					}
+					continue
+				}
+				if entry.dir, err = config.BaseDir(b.Config); err != nil {
+					return err
+				}
+				entry.cfg = cfg
+			}
+
+			// 3. 准备所有构建共用的层缓存、基础镜像缓存和仓库会话
+			layerDir, err := os.MkdirTemp("", "crane-jib-layers-")
+			if err != nil {
+				return fmt.Errorf("failed to create layer cache dir: %w", err)
+			}
+			defer os.RemoveAll(layerDir)
+
+			o := crane.GetOptions(*options...)
+			puller, err := remote.NewPuller(o.Remote...)
+			if err != nil {
+				return err
+			}
+			pusher, err := remote.NewPusher(o.Remote...)
+			if err != nil {
+				return err
+			}
+			// 复用 Puller 和 Pusher，同一个仓库的认证令牌只获取一次
+			shared := append(append([]crane.Option{}, *options...), func(o *crane.Options) {
+				o.Remote = append(o.Remote, remote.Reuse(puller), remote.Reuse(pusher))
+			})
+			bases := newBaseCache()
+			layers := layer.NewCache(layerDir)
+
+			// 4. 并发构建，--fail-fast 时第一个构建失败后不再开始新的构建
+			runnable := 0
+			for _, entry := range entries {
+				if entry.cfg != nil {
+					runnable++
+				}
+			}
+			log.Info("workspace", fmt.Sprintf("Building %d images with %d jobs...", runnable, jobs), event.Fields{"count": runnable, "jobs": jobs})
+			runBuilds(ctx, entries, jobs, failFast, func(ctx context.Context, entry *buildAllEntry) error {
+				b := &builder{options: shared, registries: entry.registries, log: entry.log, progress: s.progress, bases: bases, layers: layers}
+				return entry.run(ctx, b)
+			})
+			s.progress.Finish()
+
+			// 5. 输出汇总表格和结果文件
+			summary := summarizeBuilds(entries, time.Since(start))
+			if err := printBuildSummary(c.OutOrStdout(), entries); err != nil {
+				return err
+			}
+			if resultFile != "" {
+				if err := summary.write(resultFile); err != nil {
+					return err
+				}
+				log.Info("workspace.result", fmt.Sprintf("Results written to: %s", resultFile), event.Fields{"file": resultFile})
+			}
+
+			if summary.Failed > 0 || summary.Skipped > 0 {
+				return fmt.Errorf("%d of %d builds failed, %d skipped", summary.Failed, len(entries), summary.Skipped)
+			}
+			log.Info("workspace.done", fmt.Sprintf("All %d images built in %s", len(entries), time.Since(start).Round(time.Millisecond)), event.Fields{"count": len(entries)})
+			return nil
+		},
+	}
+	vars.register(buildAllCmd)
+	buildAllCmd.Flags().StringVarP(&workspaceFile, "workspace", "w", "", "Path to a workspace file listing the config files to build")
+	buildAllCmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "Profile to apply to every build after the workspace's profiles; repeat to apply several in order")
+	buildAllCmd.Flags().IntVarP(&jobs, "jobs", "j", 4, "Maximum number of images to build concurrently (default: the workspace's jobs, or 4)")
+	buildAllCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Do not start more builds after the first failure")
+	buildAllCmd.Flags().StringVar(&resultFile, "result-file", "", "Write the result of every build to this file as JSON")
+	buildAllCmd.Flags().BoolVar(&trustTemplates, "trust-templates", false, trustTemplatesUsage)
+
+	return buildAllCmd
+}
+
+// runBuilds 按列表顺序开始构建，最多同时进行 jobs 个，run 执行一个构建；
+// failFast 时第一个构建失败后取消 ctx，还未开始的构建保持 skipped 状态。
+// 没有解析出配置的构建不执行
+func runBuilds(ctx context.Context, entries []*buildAllEntry, jobs int, failFast bool, run func(context.Context, *buildAllEntry) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		if entry.cfg == nil {
+			continue
+		}
+		// 按列表顺序开始构建
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			entry.log.Warn("build.skipped", "Skipping build after an earlier failure", nil)
+			continue
+		}
+		wg.Add(1)
+		go func(entry *buildAllEntry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := run(ctx, entry); err != nil && failFast {
+				cancel()
+			}
+		}(entry)
+	}
+	wg.Wait()
+}
+
+// summarizeBuilds 统计每种状态的构建数
+func summarizeBuilds(entries []*buildAllEntry, duration time.Duration) *buildAllResult {
+	summary := &buildAllResult{Builds: entries, DurationMS: duration.Milliseconds()}
+	for _, entry := range entries {
+		switch entry.Status {
+		case buildSucceeded:
+			summary.Succeeded++
+		case buildFailed:
+			summary.Failed++
+		default:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+// write 将汇总结果以 JSON 写入 file
+func (r *buildAllResult) write(file string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write result file: %w", err)
+	}
+	return nil
+}
+
+// run 执行构建并记录结果和耗时
+func (e *buildAllEntry) run(ctx context.Context, b *builder) (err error) {
+	start := time.Now()
+	defer func() { e.DurationMS = time.Since(start).Milliseconds() }()
+
+	ctx, span := trace.Start(ctx, "build", trace.String("config", e.Config), trace.String("build", e.Name))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	step := e.log.Start("build", "Starting build...", event.Fields{"config": e.Config})
+
+	result, err := b.build(ctx, e.cfg, e.dir)
+	if err != nil {
+		e.fail(err)
+		return err
+	}
+	e.Status = buildSucceeded
+	e.buildResult = result
+	step.Done("Image creation completed successfully!", event.Fields{
+		"repository": result.Repository,
+		"tags":       result.Tags,
+		"platforms":  result.Platforms,
+		"digest":     result.Digest,
+	})
+	return nil
+}
+
+// fail 将构建标记为失败并输出错误
+func (e *buildAllEntry) fail(err error) {
+	e.Status = buildFailed
+	e.Error = err.Error()
+	e.log.Error("build.failed", err.Error(), nil)
+}
+
+// printBuildSummary 以表格输出每个构建的状态、耗时、推送的镜像和摘要
+func printBuildSummary(out io.Writer, entries []*buildAllEntry) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BUILD\tSTATUS\tDURATION\tIMAGE\tDIGEST")
+	for _, e := range entries {
+		image, digest, duration := "-", "-", "-"
+		if e.buildResult != nil {
+			image = e.Repository + ":" + strings.Join(e.Tags, ",")
+			digest = shortID(e.Digest)
+		}
+		if e.Status != buildSkipped {
+			duration = (time.Duration(e.DurationMS) * time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Name, e.Status, duration, image, digest)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/layer"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// newTestEntries 创建名为 names 的构建，名称以 - 开头的构建没有解析出配置
+func newTestEntries(names ...string) []*buildAllEntry {
+	entries := make([]*buildAllEntry, len(names))
+	for i, n := range names {
+		entries[i] = &buildAllEntry{Name: n, Status: buildSkipped}
+		if strings.HasPrefix(n, "-") {
+			entries[i].fail(errors.New("parse error"))
+		} else {
+			entries[i].cfg = &config.Config{}
+		}
+	}
+	return entries
+}
+
+// fakeRun 返回一个记录执行顺序的 run 函数，名称以 fail 开头的构建失败
+func fakeRun(mu *sync.Mutex, order *[]string) func(context.Context, *buildAllEntry) error {
+	return func(ctx context.Context, e *buildAllEntry) error {
+		mu.Lock()
+		*order = append(*order, e.Name)
+		mu.Unlock()
+		if strings.HasPrefix(e.Name, "fail") {
+			e.fail(errors.New("build error"))
+			return errors.New("build error")
+		}
+		e.Status = buildSucceeded
+		return nil
+	}
+}
+
+// TestRunBuilds 测试构建按列表顺序开始，没有配置的构建不执行
+func TestRunBuilds(t *testing.T) {
+	entries := newTestEntries("a", "-b", "fail-c", "d")
+	var mu sync.Mutex
+	var order []string
+	runBuilds(context.Background(), entries, 1, false, fakeRun(&mu, &order))
+
+	if expected := []string{"a", "fail-c", "d"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected builds to run in order %v, got %v", expected, order)
+	}
+	var statuses []string
+	for _, e := range entries {
+		statuses = append(statuses, e.Status)
+	}
+	if expected := []string{buildSucceeded, buildFailed, buildFailed, buildSucceeded}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected statuses %v, got %v", expected, statuses)
+	}
+}
+
+// TestRunBuildsJobs 测试同时进行的构建数不超过 jobs
+func TestRunBuildsJobs(t *testing.T) {
+	entries := newTestEntries("a", "b", "c", "d", "e", "f")
+	var mu sync.Mutex
+	running, peak := 0, 0
+	runBuilds(context.Background(), entries, 2, false, func(ctx context.Context, e *buildAllEntry) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		e.Status = buildSucceeded
+		return nil
+	})
+	if peak != 2 {
+		t.Errorf("Expected 2 concurrent builds at most, got a peak of %d", peak)
+	}
+}
+
+// TestRunBuildsFailFast 测试 failFast 时第一个构建失败后不再开始新的构建
+func TestRunBuildsFailFast(t *testing.T) {
+	entries := newTestEntries("a", "fail-b", "c", "d")
+	var mu sync.Mutex
+	var order []string
+	runBuilds(context.Background(), entries, 1, true, fakeRun(&mu, &order))
+
+	if expected := []string{"a", "fail-b"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected builds %v to run, got %v", expected, order)
+	}
+	summary := summarizeBuilds(entries, time.Second)
+	if summary.Succeeded != 1 || summary.Failed != 1 || summary.Skipped != 2 {
+		t.Errorf("Expected 1 succeeded, 1 failed and 2 skipped, got %+v", summary)
+	}
+}
+
+// TestBuildAllResult 测试汇总结果的计数、表格和结果文件
+func TestBuildAllResult(t *testing.T) {
+	entries := newTestEntries("api", "-web", "worker")
+	entries[0].Status = buildSucceeded
+	entries[0].DurationMS = 1500
+	entries[0].buildResult = &buildResult{
+		Repository: "registry.example.com/api",
+		Tags:       []string{"1.0", "latest"},
+		Digest:     "sha256:1ac24b132f03a3ed4a8bd8c0c2f6f1e2d3c4b5a6978877665544332211000000",
+	}
+
+	summary := summarizeBuilds(entries, 2*time.Second)
+	if summary.Succeeded != 1 || summary.Failed != 1 || summary.Skipped != 1 || summary.DurationMS != 2000 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	var out strings.Builder
+	if err := printBuildSummary(&out, entries); err != nil {
+		t.Fatalf("printBuildSummary failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, []string{"api", "succeeded", "1.5s", "registry.example.com/api:1.0,latest", "sha256:1ac24b132f03"}) {
+		t.Errorf("Unexpected row %q", lines[1])
+	}
+	if fields := strings.Fields(lines[3]); !reflect.DeepEqual(fields, []string{"worker", "skipped", "-", "-", "-"}) {
+		t.Errorf("Unexpected row %q", lines[3])
+	}
+
+	file := filepath.Join(t.TempDir(), "results.json")
+	if err := summary.write(file); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read result file: %v", err)
+	}
+	var got struct {
+		Builds []map[string]interface{} `json:"builds"`
+		Failed int                      `json:"failed"`
+	}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("Invalid result file: %v", err)
+	}
+	if len(got.Builds) != 3 || got.Failed != 1 {
+		t.Fatalf("Unexpected result file %s", content)
+	}
+	if got.Builds[0]["repository"] != "registry.example.com/api" || got.Builds[0]["status"] != buildSucceeded {
+		t.Errorf("Expected the build result inline, got %v", got.Builds[0])
+	}
+	if got.Builds[1]["error"] != "parse error" {
+		t.Errorf("Expected the error of the failed build, got %v", got.Builds[1])
+	}
+	if _, ok := got.Builds[2]["repository"]; ok {
+		t.Errorf("Expected no build result for a skipped build, got %v", got.Builds[2])
+	}
+}
+
+// TestBuildAllEntryRun 测试两个构建共用基础镜像和层缓存，推送到测试仓库
+func TestBuildAllEntryRun(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.OS, cf.Architecture = "linux", "amd64"
+	if base, err = mutate.ConfigFile(base, cf); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(base, u.Host+"/base:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.txt"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var entries []*buildAllEntry
+	for _, n := range []string{"api", "web"} {
+		file := filepath.Join(dir, n+".yaml")
+		content := "from:\n  image: " + u.Host + "/base:latest\n" +
+			"to: " + u.Host + "/" + n + ":v1\n" +
+			"creationTime: 0\n" +
+			"layers:\n  entries:\n    - name: app\n      files:\n        - src: app.txt\n          dest: /app/\n"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, _, err := loadConfig(file, config.LoadOptions{}, nil, nil)
+		if err != nil {
+			t.Fatalf("loadConfig failed: %v", err)
+		}
+		entries = append(entries, &buildAllEntry{Name: n, Config: file, Status: buildSkipped, cfg: cfg, dir: dir})
+	}
+
+	bases := newBaseCache()
+	layers := layer.NewCache(t.TempDir())
+	registries := registry.NewTransport(http.DefaultTransport.(*http.Transport).Clone())
+	var logs strings.Builder
+	logger := event.New(&logs)
+	for _, e := range entries {
+		e.log = logger.With(e.Name, nil)
+		b := &builder{registries: registries, log: e.log, bases: bases, layers: layers}
+		if err := e.run(context.Background(), b); err != nil {
+			t.Fatalf("build %s failed: %v", e.Name, err)
+		}
+	}
+
+	for _, e := range entries {
+		if e.Status != buildSucceeded || e.DurationMS < 0 || e.buildResult == nil {
+			t.Fatalf("Unexpected result for %s: %+v", e.Name, e)
+		}
+		if expected := []string{u.Host + "/" + e.Name + ":v1@" + e.Digest}; !reflect.DeepEqual(e.Refs, expected) {
+			t.Errorf("Expected refs %v, got %v", expected, e.Refs)
+		}
+		if _, err := crane.Digest(u.Host + "/" + e.Name + ":v1"); err != nil {
+			t.Errorf("Expected %s to be pushed: %v", e.Name, err)
+		}
+	}
+	// 两个构建的内容相同，摘要相同
+	if entries[0].Digest != entries[1].Digest {
+		t.Errorf("Expected identical builds to have the same digest, got %s and %s", entries[0].Digest, entries[1].Digest)
+	}
+	for _, msg := range []string{"[web] Reusing base image pulled by another build", "[web] Reusing identical layer app from another build"} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("Expected %q in the output, got:\n%s", msg, logs.String())
+		}
+	}
+}
+
+// TestBuildAllEntryRegistries 测试一个配置文件中的 insecure 只对该构建生效，不影响其他构建
+func TestBuildAllEntryRegistries(t *testing.T) {
+	s := httptest.NewUnstartedServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	// 证书校验失败是预期的，不输出握手错误
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(base, u.Host+"/base:latest", crane.WithTransport(s.Client().Transport)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	registries := registry.NewTransport(http.DefaultTransport.(*http.Transport).Clone())
+	var logs strings.Builder
+	logger := event.New(&logs)
+	// 与 build-all 相同，先应用所有配置文件的仓库配置，再开始构建
+	var entries []*buildAllEntry
+	for _, n := range []string{"insecure", "secure"} {
+		file := filepath.Join(dir, n+".yaml")
+		content := "from:\n  image: " + u.Host + "/base:latest\nto: " + u.Host + "/" + n + ":v1\n"
+		if n == "insecure" {
+			content += "insecure: true\n"
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, _, err := loadConfig(file, config.LoadOptions{}, nil, nil)
+		if err != nil {
+			t.Fatalf("loadConfig failed: %v", err)
+		}
+		e := &buildAllEntry{Name: n, Config: file, Status: buildSkipped, cfg: cfg, dir: dir, log: logger.With(n, nil)}
+		if e.registries, err = configureRegistries(cfg, registries, e.log); err != nil {
+			t.Fatalf("configureRegistries failed: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	if _, ok := registries.Lookup(u.Host); ok {
+		t.Error("Expected the shared transport to be left unchanged")
+	}
+
+	bases := newBaseCache()
+	layers := layer.NewCache(t.TempDir())
+	for _, e := range entries {
+		b := &builder{options: []crane.Option{crane.WithTransport(registries)}, registries: e.registries, log: e.log, bases: bases, layers: layers}
+		e.run(context.Background(), b)
+	}
+	if entries[0].Status != buildSucceeded {
+		t.Errorf("Expected the insecure build to succeed, got %s: %s", entries[0].Status, entries[0].Error)
+	}
+	if entries[1].Status != buildFailed || !strings.Contains(entries[1].Error, "certificate") {
+		t.Errorf("Expected the other build to fail certificate verification, got %s: %s", entries[1].Status, entries[1].Error)
+	}
+}
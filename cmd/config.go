@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// NewCmdConfig creates a new cobra.Command for the config subcommand.
+func NewCmdConfig(options *[]crane.Option, s *session) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect build configuration files.",
+		Args:  cobra.NoArgs,
+		RunE:  func(cmd *cobra.Command, _ []string) error { return cmd.Usage() },
+	}
+	configCmd.AddCommand(NewCmdConfigRender(options, s))
+	return configCmd
+}
+
+// NewCmdConfigRender creates a new cobra.Command for the config render subcommand.
+func NewCmdConfigRender(options *[]crane.Option, s *session) *cobra.Command {
+	var cf configFlags
+	var vars varFlags
+	var profiles []string
+
+	renderCmd := &cobra.Command{
+		Use:   "render",
+		Short: "Print the configuration after variable substitution, extends/include merging and profiles.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			opts, err := cf.loadOptions(c, *options, s)
+			if err != nil {
+				return err
+			}
+			pool, sources, err := vars.pool(s.log)
+			if err != nil {
+				return err
+			}
+			opts.VarSources = sources
+			node, _, err := config.LoadConfigNodeWithSources(cf.file, pool, opts)
+			if err != nil {
+				return err
+			}
+			node, _, err = config.ApplyProfiles(node, profiles)
+			if err != nil {
+				return err
+			}
+
+			enc := yaml.NewEncoder(c.OutOrStdout())
+			enc.SetIndent(2)
+			if err := enc.Encode(node); err != nil {
+				return err
+			}
+			return enc.Close()
+		},
+	}
+	cf.register(renderCmd, "Path to config file to render")
+	vars.register(renderCmd)
+	renderCmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "Profile from the config file's profiles section to apply; repeat to apply several in order")
+
+	return renderCmd
+}
@@ -17,22 +17,18 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
-	"github.com/AnonymousMister/crane-jib-tool/pkg/layer"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
-	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/empty"
-	"github.com/google/go-containerregistry/pkg/v1/layout"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 // ValFlag 用于处理命令行中的键值对参数
@@ -58,296 +54,242 @@ func (v *ValFlag) Type() string {
 	return "key=value"
 }
 
+// varFlags 是 create、vars 等读取配置文件的子命令共用的变量参数
+type varFlags struct {
+	valFiles []string
+	vals     ValFlag
+	noEnv    bool
+	lenient  bool
+}
+
+// register 注册变量相关的参数
+func (vf *varFlags) register(cmd *cobra.Command) {
+	vf.vals = make(ValFlag)
+	cmd.Flags().StringSliceVarP(&vf.valFiles, "valf", "f", nil, "Path to variable file (.yaml, .json or .env) to inject into config")
+	cmd.Flags().Var(&vf.vals, "val", "Dynamic variables in key=value format to inject into config")
+	cmd.Flags().BoolVar(&vf.noEnv, "no-env", false, "Do not import the process environment into the variable pool (${env:NAME} still works)")
+	cmd.Flags().BoolVar(&vf.lenient, "valf-lenient", false, "Skip variable files that cannot be read or parsed with a warning instead of failing")
+}
+
+// pool 构建变量池，同时返回每个变量的来源；--valf-lenient 时跳过的变量文件通过 log 警告
+func (vf *varFlags) pool(log *event.Logger) (map[string]string, map[string]string, error) {
+	return config.BuildVarPoolWithSources(vf.valFiles, vf.vals, config.VarPoolOptions{
+		NoEnv:   vf.noEnv,
+		Lenient: vf.lenient,
+		Warn: func(err error) {
+			log.Warn("vars.file", fmt.Sprintf("Skipping variable file: %v", err), event.Fields{"error": err.Error()})
+		},
+	})
+}
+
+// configFlags 是 create、validate 等读取配置文件的子命令共用的配置文件参数
+type configFlags struct {
+	file           string
+	format         string
+	trustTemplates bool
+}
+
+// register 注册配置文件相关的参数，usage 为 --config 的说明
+func (cf *configFlags) register(cmd *cobra.Command, usage string) {
+	cmd.Flags().StringVarP(&cf.file, "config", "c", "", usage+"; - reads it from stdin, oci://REF pulls a build template from a registry")
+	cmd.Flags().StringVar(&cf.format, "config-format", "", "Format of the config file: yaml, json or toml (default: detected from the file extension)")
+	cmd.Flags().BoolVar(&cf.trustTemplates, "trust-templates", false, trustTemplatesUsage)
+}
+
+// trustTemplatesUsage 为 --trust-templates 的说明，create 和 build-all 共用
+const trustTemplatesUsage = "Allow oci:// config templates to read local files and environment variables, reference local config files and set layer files, registry certificates, proxies and insecure registries"
+
+// loadOptions 检查配置文件参数并返回读取配置文件的选项，oci:// 模板使用 options 和 s 中的仓库配置拉取
+func (cf *configFlags) loadOptions(c *cobra.Command, options []crane.Option, s *session) (config.LoadOptions, error) {
+	if cf.file == "" {
+		return config.LoadOptions{}, errors.New("--config flag is required")
+	}
+	format, err := config.ParseFormat(cf.format)
+	if err != nil {
+		return config.LoadOptions{}, err
+	}
+	return config.LoadOptions{
+		Format:         format,
+		Stdin:          c.InOrStdin(),
+		Fetch:          fetchTemplate(c.Context(), options, s),
+		TrustTemplates: cf.trustTemplates,
+	}, nil
+}
+
+// withRegistryOptions 为镜像引用附加其所在仓库需要的 name.Option（如允许 HTTP）
+// 必须放在其他 Option 之后
+func withRegistryOptions(registries *registry.Transport, image string) crane.Option {
+	return func(o *crane.Options) {
+		ref, err := name.ParseReference(image, o.Name...)
+		if err != nil {
+			// 解析错误交由后续调用处理
+			return
+		}
+		o.Name = append(o.Name, registries.NameOptions(ref.Context().RegistryStr())...)
+	}
+}
+
+// loadConfig 读取配置文件并应用 profile，返回配置、最终的配置节点以及每个 profile 覆盖的字段
+func loadConfig(configFile string, opts config.LoadOptions, pool map[string]string, profiles []string) (*config.Config, *yaml.Node, []config.ProfileOverride, error) {
+	node, sources, err := config.LoadConfigNodeWithSources(configFile, pool, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	node, overrides, err := config.ApplyProfiles(node, profiles)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cfg, err := config.DecodeConfig(node, sources)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, node, overrides, nil
+}
+
+// overriddenFields 返回 profile 覆盖的字段列表，用于输出
+func overriddenFields(o config.ProfileOverride) string {
+	if len(o.Fields) == 0 {
+		return "(nothing)"
+	}
+	return strings.Join(o.Fields, ", ")
+}
+
+// printDryRun 输出最终配置，每个 profile 覆盖的字段以注释形式输出在开头
+func printDryRun(w io.Writer, node *yaml.Node, overrides []config.ProfileOverride) error {
+	for _, o := range overrides {
+		fmt.Fprintf(w, "# profile %s overrides: %s\n", o.Profile, overriddenFields(o))
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// buildRegistries 返回基础镜像和目标镜像所在的仓库地址（已去重）
+func buildRegistries(cfg *config.Config) ([]string, error) {
+	from, err := name.ParseReference(cfg.From.Image)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base image %s: %w", cfg.From.Image, err)
+	}
+	to, err := name.NewRepository(cfg.To.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repository %s: %w", cfg.To.Repository, err)
+	}
+
+	regs := []string{from.Context().RegistryStr()}
+	if to.RegistryStr() != regs[0] {
+		regs = append(regs, to.RegistryStr())
+	}
+	return regs, nil
+}
+
 // NewCmdCreate creates a new cobra.Command for the create subcommand.
-func NewCmdCreate(options *[]crane.Option) *cobra.Command {
+func NewCmdCreate(options *[]crane.Option, s *session) *cobra.Command {
 	// 配置文件相关参数
-	var configFile string
-	var valFiles []string
-	var vals ValFlag = make(ValFlag)
+	var cf configFlags
+	var vars varFlags
+	var profiles []string
+	var dryRun bool
 
 	createCmd := &cobra.Command{
 		Use:   "create",
 		Short: "Create a new image from an existing one using a configuration file.",
 		Args:  cobra.NoArgs,
-		RunE: func(c *cobra.Command, args []string) error {
+		RunE: func(c *cobra.Command, args []string) (err error) {
 			// 1. 检查配置文件是否提供
-			if configFile == "" {
-				return errors.New("--config flag is required")
+			loadOpts, err := cf.loadOptions(c, *options, s)
+			if err != nil {
+				return err
 			}
+			configFile := cf.file
+
+			registries, log := s.registries, s.log
+			defer s.progress.Finish()
+			defer s.writeTrace()
+
+			ctx, buildSpan := trace.Start(c.Context(), "build", trace.String("config", configFile))
+			defer func() {
+				buildSpan.SetError(err)
+				buildSpan.End()
+			}()
+			build := log.Start("build", "", event.Fields{"config": configFile})
 
 			// 2. 构建变量池
-			fmt.Println("🔧 Building variable pool...")
-			varPool := config.BuildVarPool(valFiles, vals)
+			step := log.Start("vars", "Building variable pool...", nil)
+			_, span := trace.Start(ctx, "vars")
+			varPool, varSources, err := vars.pool(s.log)
+			span.SetError(err)
+			span.SetAttributes(trace.Int("vars.count", int64(len(varPool))))
+			span.End()
+			if err != nil {
+				return err
+			}
+			step.Done("", event.Fields{"count": len(varPool)})
+			loadOpts.VarSources = varSources
 
 			// 3. 解析配置文件
-			fmt.Println("📄 Parsing configuration file...")
-			cfg, err := config.ParseConfig(configFile, varPool)
+			step = log.Start("config.parse", "Parsing configuration file...", event.Fields{"file": configFile})
+			_, span = trace.Start(ctx, "config.parse", trace.String("config", configFile))
+			cfg, node, overrides, err := loadConfig(configFile, loadOpts, varPool, profiles)
+			span.SetError(err)
+			span.End()
 			if err != nil {
 				return fmt.Errorf("failed to parse config file: %w", err)
 			}
-
-			// 4. 从配置中提取平台信息
-			platforms := layer.ExtractPlatforms(cfg.From)
-			fmt.Printf("🎯 Platforms: %v\n", platforms)
-
-			// 5. 创建临时目录用于存储中间产物
-			rootTmpDir, err := os.MkdirTemp("", "crane-job-")
-			if err != nil {
-				return fmt.Errorf("failed to create root temp dir: %w", err)
+			step.Done("", event.Fields{"from": cfg.From.Image, "to": cfg.To.Repository})
+			for _, o := range overrides {
+				log.Info("config.profile", fmt.Sprintf("Applied profile %s, overriding: %s", o.Profile, overriddenFields(o)), event.Fields{"profile": o.Profile, "fields": o.Fields})
 			}
-			defer os.RemoveAll(rootTmpDir)
-			fmt.Printf("📁 Using temp directory: %s\n", rootTmpDir)
 
-			// OCI layout 目录
-			ociLayoutDir := filepath.Join(rootTmpDir, "oci-layout")
-			if err := os.MkdirAll(ociLayoutDir, 0755); err != nil {
-				return fmt.Errorf("failed to create OCI layout dir: %w", err)
+			// 3.0 只解析配置时输出最终配置后退出
+			if dryRun {
+				return printDryRun(c.OutOrStdout(), node, overrides)
 			}
 
-			// 6. 处理所有层，创建 tar 文件
-			fmt.Printf("📦 Preparing %d layers...\n", len(cfg.Layers.Entries))
-			layerPaths, err := layer.ProcessLayers(cfg, rootTmpDir)
+			// 3.1 应用配置文件中的代理和仓库连接配置
+			registries, err = configureRegistries(cfg, registries, log)
 			if err != nil {
-				return fmt.Errorf("failed to process layers: %w", err)
+				return err
 			}
 
-			var createdTime = time.Now()
-
-			// 当前创建时间
-			if cfg.CreationTime != "" {
-				createdTime, err := layer.ParseCreationTime(cfg.CreationTime)
-				if err != nil {
-					fmt.Printf("   ⚠️  Warning: %v, using current time instead\n", err)
-					createdTime = time.Now()
-				}
-				fmt.Printf("   ⚙️  Setting creation time: %v\n", createdTime)
-			}
-
-			// 7. 处理每个平台
-			// 存储每个平台的镜像信息
-			platformImageRefs := make([]string, 0, len(platforms))
-
-			for _, targetPlatform := range platforms {
-				fmt.Printf("\n🔨 Processing platform: %s\n", targetPlatform)
-
-				// 解析平台字符串
-				platform, err := parsePlatform(targetPlatform)
-				if err != nil {
-					return fmt.Errorf("parsing platform %s: %w", targetPlatform, err)
-				}
-
-				// 8. 拉取基础镜像
-				fmt.Printf("   📥 Pulling base image: %s\n", cfg.From.Image)
-				img, err := crane.Pull(cfg.From.Image, append(*options, crane.WithPlatform(platform))...)
-				if err != nil {
-					return fmt.Errorf("pulling base image %s: %w", cfg.From.Image, err)
-				}
-
-				// 9. 添加层
-				if len(layerPaths) > 0 {
-					fmt.Printf("   🧩 Adding %d layers...\n", len(layerPaths))
-					img, err = crane.Append(img, layerPaths...)
-					if err != nil {
-						return fmt.Errorf("adding layer %w", err)
-					}
-				}
-
-				// 10. 获取并修改配置
-				imgCfg, err := img.ConfigFile()
-				if err != nil {
-					return fmt.Errorf("getting config file: %w", err)
-				}
-				imgCfg = imgCfg.DeepCopy()
-
-				// 10.1 设置创建时间
-				imgCfg.Created = v1.Time{Time: createdTime}
-
-				// 11. 设置环境变量
-				if len(cfg.Environment) > 0 {
-					fmt.Printf("   ⚙️  Setting environment variables...\n")
-					// 构建环境变量映射
-					envMap := make(map[string]string)
-					for _, env := range imgCfg.Config.Env {
-						parts := strings.SplitN(env, "=", 2)
-						if len(parts) == 2 {
-							envMap[parts[0]] = parts[1]
-						}
-					}
-
-					// 更新环境变量
-					for k, v := range cfg.Environment {
-						envMap[k] = v
-					}
-
-					// 转换回数组格式
-					newEnv := make([]string, 0, len(envMap))
-					for k, v := range envMap {
-						newEnv = append(newEnv, fmt.Sprintf("%s=%s", k, v))
-					}
-					imgCfg.Config.Env = newEnv
-				}
-
-				// 12. 设置标签
-				if len(cfg.Labels) > 0 {
-					fmt.Printf("   ⚙️  Setting labels...\n")
-					// 构建标签映射
-					labelMap := make(map[string]string)
-					for k, v := range imgCfg.Config.Labels {
-						labelMap[k] = v
-					}
-
-					// 更新标签
-					for k, v := range cfg.Labels {
-						labelMap[k] = v
-					}
-
-					imgCfg.Config.Labels = labelMap
-				}
-
-				// 13. 设置卷
-				if len(cfg.Volumes) > 0 {
-					fmt.Printf("   ⚙️  Setting volumes...\n")
-					// 构建卷映射
-					volumeMap := make(map[string]struct{})
-					for k := range imgCfg.Config.Volumes {
-						volumeMap[k] = struct{}{}
-					}
-
-					// 更新卷
-					for _, v := range cfg.Volumes {
-						volumeMap[v] = struct{}{}
-					}
-
-					imgCfg.Config.Volumes = volumeMap
-				}
-
-				// 12. 设置命令
-				if len(cfg.Cmd) > 0 {
-					fmt.Printf("   ⚙️  Setting command: %v\n", cfg.Cmd)
-					imgCfg.Config.Cmd = cfg.Cmd
-				}
-
-				// 13. 设置入口点
-				if len(cfg.Entrypoint) > 0 {
-					fmt.Printf("   ⚙️  Setting entrypoint: %v\n", cfg.Entrypoint)
-					imgCfg.Config.Entrypoint = cfg.Entrypoint
-				}
-
-				// 14. 设置用户
-				if cfg.User != "" {
-					fmt.Printf("   ⚙️  Setting user: %s\n", cfg.User)
-					imgCfg.Config.User = cfg.User
-				}
-
-				// 15. 设置工作目录
-				if cfg.WorkingDir != "" {
-					fmt.Printf("   ⚙️  Setting working directory: %s\n", cfg.WorkingDir)
-					imgCfg.Config.WorkingDir = cfg.WorkingDir
-				}
-
-				// 16. 设置暴露端口
-				if len(cfg.ExposedPorts) > 0 {
-					fmt.Printf("   ⚙️  Setting exposed ports: %v\n", cfg.ExposedPorts)
-					portMap := make(map[string]struct{})
-					for _, port := range cfg.ExposedPorts {
-						portMap[port] = struct{}{}
-					}
-					imgCfg.Config.ExposedPorts = portMap
-				}
-
-				// 17. 应用配置修改
-				fmt.Printf("   📝 Applying config changes...\n")
-				img, err = mutate.ConfigFile(img, imgCfg)
-				if err != nil {
-					return fmt.Errorf("mutating config: %w", err)
-				}
-
-				// 获取镜像的实际平台信息（可能与配置的不同，如基础镜像不支持某平台）
-				actualPlatform := &v1.Platform{
-					OS:           imgCfg.OS,
-					Architecture: imgCfg.Architecture,
-					Variant:      imgCfg.Variant,
-				}
-				if actualPlatform.String() != platform.String() {
-					fmt.Printf("   ⚠️  Warning: actual platform %s differs from requested %s\n", actualPlatform.String(), platform.String())
-				}
-
-				// 多个平台，保存到同一个 OCI layout 目录（带平台信息）
-				fmt.Printf("   💾 Saving image to OCI layout: %s\n", ociLayoutDir)
-				var lp layout.Path
-				// 检查 OCI layout 是否已存在（通过检查 oci-layout 文件）
-				if _, err := os.Stat(filepath.Join(ociLayoutDir, "oci-layout")); os.IsNotExist(err) {
-					// 不存在，创建新的
-					lp, err = layout.Write(ociLayoutDir, empty.Index)
-					if err != nil {
-						return fmt.Errorf("creating OCI layout: %w", err)
-					}
-				} else {
-					// 已存在，打开
-					lp, err = layout.FromPath(ociLayoutDir)
-					if err != nil {
-						return fmt.Errorf("opening OCI layout: %w", err)
-					}
-				}
-				// 使用镜像的实际平台信息，确保 index.json 中的 platform 与镜像一致
-				if err := lp.AppendImage(img, layout.WithPlatform(*actualPlatform)); err != nil {
-					return fmt.Errorf("saving image to OCI layout: %w", err)
-				}
-				platformImageRefs = append(platformImageRefs, actualPlatform.String())
-
-				fmt.Printf("   ✅ Platform %s completed!\n", actualPlatform.String())
+			// 层的相对路径相对于当前目录
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
 			}
-
-			repository := cfg.To.Repository
-			fmt.Printf("\n📦 Creating multi-platform manifest...\n")
-
-			// 从 OCI layout 加载索引
-			fmt.Printf("   🛠️  Combining %d platform images from OCI layout...\n", len(platformImageRefs))
-			idx, err := layout.ImageIndexFromPath(ociLayoutDir)
+			b := &builder{options: *options, registries: registries, log: log, progress: s.progress}
+			result, err := b.build(ctx, cfg, dir)
 			if err != nil {
-				return fmt.Errorf("loading OCI layout as index: %w", err)
+				return err
 			}
 
-			// 根据 format 配置选择推送格式
-			var pushIdx v1.ImageIndex = idx
-			if strings.EqualFold(cfg.Format, "Docker") {
-				fmt.Printf("   🔄 Converting to Docker Manifest List format...\n")
-				pushIdx = mutate.IndexMediaType(idx, types.DockerManifestList)
-			} else {
-				fmt.Printf("   📋 Using OCI Image Index format...\n")
+			// 标准输出只输出结果：每个推送的镜像引用
+			for _, ref := range result.Refs {
+				fmt.Fprintln(c.OutOrStdout(), ref)
 			}
 
-			o := crane.GetOptions(*options...)
-
-			// 推送到所有 tags（直接推送 index，不使用 crane.Tag 避免重复下载）
-			for i, tag := range cfg.To.Tags {
-				targetImage := repository + ":" + tag
-				if i == 0 {
-					fmt.Printf("   📤 Pushing to: %s\n", targetImage)
-				} else {
-					fmt.Printf("   🏷️  Pushing tag: %s\n", targetImage)
-				}
-
-				ref, err := name.ParseReference(targetImage, o.Name...)
-				if err != nil {
-					return fmt.Errorf("parsing reference: %w", err)
-				}
-
-				if err := remote.WriteIndex(ref, pushIdx, o.Remote...); err != nil {
-					return fmt.Errorf("pushing multi-platform index to %s: %w", targetImage, err)
-				}
+			s.progress.Finish()
+			build.Done("Image creation completed successfully!", event.Fields{
+				"repository": result.Repository,
+				"tags":       result.Tags,
+				"platforms":  result.Platforms,
+				"digest":     result.Digest,
+			})
+			// JSON 格式下 build.done 事件已包含结果，不再重复输出
+			if !log.JSON() {
+				log.Info("build.result", fmt.Sprintf("Repository: %s", result.Repository), nil)
+				log.Info("build.result", fmt.Sprintf("Tags: %v", result.Tags), nil)
+				log.Info("build.result", fmt.Sprintf("Platforms: %v", result.Platforms), nil)
 			}
-
-			fmt.Printf("\n✅ Image creation completed successfully!\n")
-			fmt.Printf("   🎉 Repository: %s\n", cfg.To.Repository)
-			fmt.Printf("   🎉 Tags: %v\n", cfg.To.Tags)
-			fmt.Printf("   🎉 Platforms: %v\n", platformImageRefs)
 			return nil
 		},
 	}
-	createCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to config file to use for creating the new image")
-	createCmd.Flags().StringSliceVarP(&valFiles, "valf", "f", nil, "Path to variable file (yaml format) to inject into config")
-	createCmd.Flags().Var(&vals, "val", "Dynamic variables in key=value format to inject into config")
+	cf.register(createCmd, "Path to config file to use for creating the new image")
+	vars.register(createCmd)
+	createCmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "Profile from the config file's profiles section to apply; repeat to apply several in order")
+	createCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Resolve the configuration and print it with the fields each profile overrode, without building")
 
 	return createCmd
 }
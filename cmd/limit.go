@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// maxThrottleRetries 收到 429 后的最大重试次数
+const maxThrottleRetries = 5
+
+// limitTransport 限制并发下载数量和每秒请求数，并在收到 429 时按 Retry-After 重试
+//
+// 并发上传数由 remote.WithJobs 按 blob 限制：分块上传的一个 blob 会发送多个请求，
+// 无法在 Transport 中按请求计数
+type limitTransport struct {
+	inner http.RoundTripper
+
+	// downloads 是并发下载的信号量，为 nil 时不限制
+	downloads chan struct{}
+
+	// interval 为两次请求之间的最小间隔，为 0 时不限制
+	interval time.Duration
+
+	mu        sync.Mutex
+	next      time.Time
+	throttled int
+	waited    time.Duration
+}
+
+// newLimitTransport 创建限流 Transport，参数为 0 表示不限制
+func newLimitTransport(inner http.RoundTripper, maxDownloads int, rps float64) *limitTransport {
+	lt := &limitTransport{inner: inner}
+	if maxDownloads > 0 {
+		lt.downloads = make(chan struct{}, maxDownloads)
+	}
+	if rps > 0 {
+		lt.interval = time.Duration(float64(time.Second) / rps)
+	}
+	return lt
+}
+
+// RoundTrip 实现了 http.RoundTripper 接口
+func (lt *limitTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	sem := lt.semaphore(in)
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-in.Context().Done():
+			return nil, in.Context().Err()
+		}
+	}
+
+	resp, err := lt.roundTrip(in)
+	if sem == nil {
+		return resp, err
+	}
+	if err != nil {
+		<-sem
+		return nil, err
+	}
+
+	// 下载在读取响应体时才真正传输数据，关闭响应体后释放信号量。
+	// 重定向时 http.Client 先关闭响应体再请求新地址，新地址的请求重新获取信号量
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { <-sem }}
+	return resp, nil
+}
+
+// roundTrip 按速率限制发送请求，收到 429 时等待后重试
+func (lt *limitTransport) roundTrip(in *http.Request) (*http.Response, error) {
+	req := in
+	for attempt := 0; ; attempt++ {
+		if err := lt.wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		resp, err := lt.inner.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= maxThrottleRetries {
+			return resp, err
+		}
+
+		// 请求体无法重放时不能重试
+		next, ok := rewind(in)
+		if !ok {
+			return resp, nil
+		}
+
+		delay := retryAfter(resp.Header.Get("Retry-After"), attempt)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		lt.mu.Lock()
+		lt.throttled++
+		lt.waited += delay
+		lt.mu.Unlock()
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
+
+// semaphore 返回下载 blob 的请求需要获取的信号量，其他请求返回 nil
+func (lt *limitTransport) semaphore(in *http.Request) chan struct{} {
+	if in.Method != http.MethodGet {
+		return nil
+	}
+	// 仓库常把 blob 重定向到对象存储，重定向后的请求同样计入下载数
+	for req := in; req != nil; {
+		if strings.Contains(req.URL.Path, "/blobs/") {
+			return lt.downloads
+		}
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return nil
+}
+
+// wait 等待直到满足每秒请求数限制
+func (lt *limitTransport) wait(ctx context.Context) error {
+	if lt.interval == 0 {
+		return nil
+	}
+
+	lt.mu.Lock()
+	now := time.Now()
+	if lt.next.Before(now) {
+		lt.next = now
+	}
+	delay := lt.next.Sub(now)
+	lt.next = lt.next.Add(lt.interval)
+	lt.mu.Unlock()
+
+	return sleep(ctx, delay)
+}
+
+// Summary 返回限流情况的汇总，没有发生限流时返回空字符串
+func (lt *limitTransport) Summary() string {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if lt.throttled == 0 {
+		return ""
+	}
+	return fmt.Sprintf("registry throttled %d requests (HTTP 429), waited %s in total", lt.throttled, lt.waited.Round(time.Millisecond))
+}
+
+// retryPredicate 替换 go-containerregistry 默认的重试条件：429 已由 limitTransport
+// 按 Retry-After 重试，这里不再重试，其余与默认条件相同
+func retryPredicate(err error) bool {
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	temp, ok := err.(interface{ Temporary() bool })
+	if (ok && temp.Temporary()) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed) {
+		logs.Warn.Printf("retrying %v", err)
+		return true
+	}
+	return false
+}
+
+// rewind 复制请求以便重试，请求体无法重放时返回 false
+func rewind(in *http.Request) (*http.Request, bool) {
+	if in.Body == nil || in.Body == http.NoBody {
+		return in, true
+	}
+	if in.GetBody == nil {
+		return nil, false
+	}
+	body, err := in.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	out := in.Clone(in.Context())
+	out.Body = body
+	return out, true
+}
+
+// retryAfter 解析 Retry-After 头（秒数或 HTTP 日期），缺省时按重试次数指数退避
+func retryAfter(header string, attempt int) time.Duration {
+	if header != "" {
+		if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(header); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+			return 0
+		}
+	}
+	return time.Second << attempt
+}
+
+// sleep 等待 d，context 取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseBody 在响应体关闭时释放信号量（只释放一次）
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close 实现了 io.Closer 接口
+func (rb *releaseBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.once.Do(rb.release)
+	return err
+}
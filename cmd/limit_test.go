@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// TestLimitTransportRetryAfter 测试收到 429 后按 Retry-After 重试，重试时重新发送完整的请求体
+func TestLimitTransportRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		n := len(bodies)
+		mu.Unlock()
+		if n <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	lt := newLimitTransport(http.DefaultTransport, 0, 0)
+	if lt.Summary() != "" {
+		t.Errorf("Expected no summary before throttling, got %q", lt.Summary())
+	}
+	req, err := http.NewRequest(http.MethodPut, s.URL+"/v2/app/blobs/uploads/1", bytes.NewReader([]byte("layer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := lt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected the request to succeed after retrying, got %d", resp.StatusCode)
+	}
+	if expected := []string{"layer", "layer", "layer"}; fmt.Sprint(bodies) != fmt.Sprint(expected) {
+		t.Errorf("Expected the full body on every attempt, got %q", bodies)
+	}
+	if !strings.Contains(lt.Summary(), "throttled 2 requests") {
+		t.Errorf("Expected 2 throttled requests in the summary, got %q", lt.Summary())
+	}
+}
+
+// TestLimitTransportNoRewind 测试请求体无法重放时不重试，超过最大重试次数后返回 429
+func TestLimitTransportNoRewind(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	lt := newLimitTransport(http.DefaultTransport, 0, 0)
+	req, err := http.NewRequest(http.MethodPatch, s.URL+"/v2/app/blobs/uploads/1", io.NopCloser(strings.NewReader("chunk")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := lt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || attempts != 1 {
+		t.Errorf("Expected a single attempt without GetBody, got %d attempts and status %d", attempts, resp.StatusCode)
+	}
+
+	attempts = 0
+	req, err = http.NewRequest(http.MethodGet, s.URL+"/v2/app/manifests/v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = lt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || attempts != maxThrottleRetries+1 {
+		t.Errorf("Expected %d attempts, got %d and status %d", maxThrottleRetries+1, attempts, resp.StatusCode)
+	}
+}
+
+// TestLimitTransportDownloads 测试同时下载的 blob 数不超过上限，重定向后的请求同样计数，
+// 关闭响应体后释放信号量
+func TestLimitTransportDownloads(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") {
+			http.Redirect(w, r, "/storage/"+path.Base(r.URL.Path), http.StatusTemporaryRedirect)
+			return
+		}
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		w.Write([]byte("blob"))
+	}))
+	defer s.Close()
+
+	client := &http.Client{Transport: newLimitTransport(http.DefaultTransport, 2, 0)}
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get(fmt.Sprintf("%s/v2/app/blobs/sha256:%d", s.URL, i))
+			if err != nil {
+				t.Errorf("Get failed: %v", err)
+				return
+			}
+			// 读取响应体期间占用信号量
+			time.Sleep(20 * time.Millisecond)
+			io.Copy(io.Discard, resp.Body)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Errorf("Expected 2 concurrent downloads at most, got a peak of %d", peak)
+	}
+}
+
+// TestRetryPredicate 测试 429 不交给 go-containerregistry 重试，其他临时错误仍重试
+func TestRetryPredicate(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		expected bool
+	}{
+		{&transport.Error{StatusCode: http.StatusTooManyRequests, Errors: []transport.Diagnostic{{Code: transport.TooManyRequestsErrorCode}}}, false},
+		{&transport.Error{StatusCode: http.StatusServiceUnavailable, Errors: []transport.Diagnostic{{Code: transport.UnavailableErrorCode}}}, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{errors.New("manifest unknown"), false},
+	} {
+		if got := retryPredicate(test.err); got != test.expected {
+			t.Errorf("retryPredicate(%v) = %v, expected %v", test.err, got, test.expected)
+		}
+	}
+}
+
+// TestRetryAfter 测试 Retry-After 的秒数、HTTP 日期和缺省时的指数退避
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("3", 0); got != 3*time.Second {
+		t.Errorf("Expected 3s, got %s", got)
+	}
+	if got := retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0); got != 0 {
+		t.Errorf("Expected no wait for a past date, got %s", got)
+	}
+	if got := retryAfter("", 2); got != 4*time.Second {
+		t.Errorf("Expected 4s of backoff, got %s", got)
+	}
+}
@@ -0,0 +1,530 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	// progressBarInterval 终端进度条的刷新间隔
+	progressBarInterval = 200 * time.Millisecond
+	// progressLogInterval 非终端环境下输出进度日志的间隔
+	progressLogInterval = 10 * time.Second
+	// progressBarBlobs 进度条中最多显示的 blob 数量
+	progressBarBlobs = 4
+)
+
+// progressMode 定义了进度的展示方式
+type progressMode int
+
+const (
+	progressOff progressMode = iota
+	// progressBar 在终端中原地刷新进度条
+	progressBar
+	// progressLines 定期输出进度日志
+	progressLines
+)
+
+const (
+	directionUpload   = "upload"
+	directionDownload = "download"
+)
+
+// blobProgress 记录单个 blob 的传输进度
+type blobProgress struct {
+	key       string
+	label     string
+	direction string
+	total     int64
+	complete  int64
+	started   time.Time
+	done      bool
+}
+
+// progressTracker 汇总 blob 的上传/下载进度并按模式展示
+type progressTracker struct {
+	log *event.Logger
+
+	mu       sync.Mutex
+	mode     progressMode
+	blobs    []*blobProgress
+	index    map[string]*blobProgress
+	started  map[string]time.Time
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// newProgressTracker 创建进度跟踪器，默认不展示进度，需要调用 Configure 设置模式
+func newProgressTracker(log *event.Logger) *progressTracker {
+	return &progressTracker{
+		log:     log,
+		index:   map[string]*blobProgress{},
+		started: map[string]time.Time{},
+	}
+}
+
+// Configure 根据输出环境选择展示方式：终端且支持控制序列时显示进度条，否则定期输出日志
+func (pt *progressTracker) Configure(format event.Format, quiet bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	switch {
+	case quiet:
+		pt.mode = progressOff
+	case format == event.FormatText && isTerminal(os.Stderr) && !nocolor():
+		pt.mode = progressBar
+	default:
+		pt.mode = progressLines
+	}
+}
+
+// begin 开始跟踪一个 blob 的传输，同一个 key 重新开始时会重置进度
+func (pt *progressTracker) begin(key, label, direction string, total int64) *blobProgress {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	now := time.Now()
+	bp, ok := pt.index[key]
+	if !ok {
+		bp = &blobProgress{key: key, label: label, direction: direction}
+		pt.index[key] = bp
+		pt.blobs = append(pt.blobs, bp)
+	}
+	bp.total = total
+	bp.complete = 0
+	bp.started = now
+	bp.done = false
+	if _, ok := pt.started[direction]; !ok {
+		pt.started[direction] = now
+	}
+
+	// 第一个 blob 开始传输时启动展示
+	if pt.stop == nil && pt.mode != progressOff {
+		pt.stop = make(chan struct{})
+		pt.finished = make(chan struct{})
+		go pt.run(pt.stop, pt.finished)
+	}
+	return bp
+}
+
+// add 累加 blob 已传输的字节数
+func (pt *progressTracker) add(bp *blobProgress, n int64) {
+	pt.mu.Lock()
+	bp.complete += n
+	pt.mu.Unlock()
+}
+
+// set 设置 blob 已传输的字节数和总字节数，用于 remote.WithProgress 报告的累计进度
+func (pt *progressTracker) set(bp *blobProgress, complete, total int64) {
+	pt.mu.Lock()
+	bp.complete = complete
+	bp.total = total
+	pt.mu.Unlock()
+}
+
+// finish 标记 blob 传输完成
+func (pt *progressTracker) finish(bp *blobProgress) {
+	pt.mu.Lock()
+	if bp.done {
+		pt.mu.Unlock()
+		return
+	}
+	bp.done = true
+	mode := pt.mode
+	complete := bp.complete
+	elapsed := time.Since(bp.started)
+	pt.mu.Unlock()
+
+	if mode == progressLines {
+		pt.log.Info("progress.blob", fmt.Sprintf("%s %s: %s in %s", directionVerb(bp.direction), bp.label, humanBytes(complete), elapsed.Round(time.Millisecond)), event.Fields{
+			"direction":   bp.direction,
+			"blob":        bp.label,
+			"bytes":       complete,
+			"duration_ms": elapsed.Milliseconds(),
+		})
+	}
+}
+
+// Finish 停止展示并输出传输汇总
+func (pt *progressTracker) Finish() {
+	pt.mu.Lock()
+	stop, finished := pt.stop, pt.finished
+	pt.stop = nil
+	pt.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-finished
+
+	pt.log.Status(nil)
+	for _, s := range pt.summaries() {
+		pt.log.Info("progress.done", s.text(true), s.fields())
+	}
+}
+
+// run 按展示模式定期刷新进度
+func (pt *progressTracker) run(stop <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+
+	interval := progressLogInterval
+	if pt.mode == progressBar {
+		interval = progressBarInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if pt.mode == progressBar {
+				pt.log.Status(pt.barLines())
+				continue
+			}
+			for _, s := range pt.summaries() {
+				if s.complete < s.total || s.total == 0 {
+					pt.log.Info("progress", s.text(false), s.fields())
+				}
+			}
+		}
+	}
+}
+
+// progressSummary 是某个方向上所有 blob 的汇总进度
+type progressSummary struct {
+	direction string
+	blobs     int
+	total     int64
+	complete  int64
+	elapsed   time.Duration
+}
+
+// rate 返回平均传输速率（字节/秒）
+func (s progressSummary) rate() float64 {
+	if s.elapsed <= 0 {
+		return 0
+	}
+	return float64(s.complete) / s.elapsed.Seconds()
+}
+
+// eta 返回预计剩余时间，无法估计时返回 -1
+func (s progressSummary) eta() time.Duration {
+	rate := s.rate()
+	if rate <= 0 || s.total < s.complete {
+		return -1
+	}
+	return time.Duration(float64(s.total-s.complete) / rate * float64(time.Second))
+}
+
+// text 返回汇总的文本描述
+func (s progressSummary) text(done bool) string {
+	if done {
+		return fmt.Sprintf("%s %d %s, %s in %s (%s/s)", directionVerb(s.direction), s.blobs, directionUnit(s.direction), humanBytes(s.complete), s.elapsed.Round(time.Millisecond), humanBytes(int64(s.rate())))
+	}
+	text := fmt.Sprintf("%s %s / %s (%d%%), %s/s", directionVerb(s.direction), humanBytes(s.complete), humanBytes(s.total), percent(s.complete, s.total), humanBytes(int64(s.rate())))
+	if eta := s.eta(); eta >= 0 {
+		text += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return text
+}
+
+// fields 返回汇总的结构化字段
+func (s progressSummary) fields() event.Fields {
+	fields := event.Fields{
+		"direction":     s.direction,
+		"blobs":         s.blobs,
+		"bytes":         s.complete,
+		"total":         s.total,
+		"bytes_per_sec": int64(s.rate()),
+		"elapsed_ms":    s.elapsed.Milliseconds(),
+		"percent":       percent(s.complete, s.total),
+	}
+	if eta := s.eta(); eta >= 0 {
+		fields["eta_ms"] = eta.Milliseconds()
+	}
+	return fields
+}
+
+// summaries 按方向汇总进度（先下载后上传）
+func (pt *progressTracker) summaries() []progressSummary {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	byDirection := map[string]*progressSummary{}
+	for _, bp := range pt.blobs {
+		s, ok := byDirection[bp.direction]
+		if !ok {
+			s = &progressSummary{direction: bp.direction, elapsed: time.Since(pt.started[bp.direction])}
+			byDirection[bp.direction] = s
+		}
+		s.blobs++
+		s.complete += bp.complete
+		if bp.total > 0 {
+			s.total += bp.total
+		} else {
+			s.total += bp.complete
+		}
+	}
+
+	result := make([]progressSummary, 0, len(byDirection))
+	for _, direction := range []string{directionDownload, directionUpload} {
+		if s, ok := byDirection[direction]; ok {
+			result = append(result, *s)
+		}
+	}
+	return result
+}
+
+// barLines 生成进度条的状态行：正在传输的 blob（按剩余字节排序）和各方向汇总
+func (pt *progressTracker) barLines() []string {
+	pt.mu.Lock()
+	active := make([]blobProgress, 0, len(pt.blobs))
+	for _, bp := range pt.blobs {
+		if !bp.done {
+			active = append(active, *bp)
+		}
+	}
+	pt.mu.Unlock()
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].total-active[i].complete > active[j].total-active[j].complete
+	})
+
+	lines := make([]string, 0, progressBarBlobs+3)
+	for i, bp := range active {
+		if i == progressBarBlobs {
+			lines = append(lines, fmt.Sprintf("   ... %d more", len(active)-progressBarBlobs))
+			break
+		}
+		elapsed := time.Since(bp.started)
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(bp.complete) / elapsed.Seconds()
+		}
+		lines = append(lines, fmt.Sprintf("   %s %-24s %s %9s / %-9s %9s/s",
+			directionArrow(bp.direction), bp.label, bar(bp.complete, bp.total, 20),
+			humanBytes(bp.complete), humanBytes(bp.total), humanBytes(int64(rate))))
+	}
+	for _, s := range pt.summaries() {
+		lines = append(lines, fmt.Sprintf("   %s %s %s", directionArrow(s.direction), bar(s.complete, s.total, 30), s.text(false)))
+	}
+	return lines
+}
+
+// image 返回读取层时统计下载字节数的镜像：基础镜像的层在保存到 OCI layout 时才按需下载，
+// 包装每个层的 Compressed 读取器即可统计下载进度，不需要关心镜像仓库的请求和重定向
+func (pt *progressTracker) image(img v1.Image) v1.Image {
+	if pt == nil || !pt.enabled() {
+		return img
+	}
+	return &progressImage{Image: img, tracker: pt}
+}
+
+// push 返回传给 remote.WithProgress 的通道，按镜像引用统计推送的字节数。
+// wait 在推送成功后等待所有进度更新处理完成；推送出错时通道可能未被关闭，不应等待
+func (pt *progressTracker) push(ref string) (updates chan v1.Update, wait func()) {
+	if pt == nil || !pt.enabled() {
+		return nil, func() {}
+	}
+	updates = make(chan v1.Update, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var bp *blobProgress
+		for u := range updates {
+			if u.Error != nil {
+				continue
+			}
+			if bp == nil {
+				bp = pt.begin("push "+ref, ref, directionUpload, u.Total)
+			}
+			pt.set(bp, u.Complete, u.Total)
+		}
+		if bp != nil {
+			pt.finish(bp)
+		}
+	}()
+	return updates, func() { <-done }
+}
+
+// enabled 判断是否展示进度
+func (pt *progressTracker) enabled() bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.mode != progressOff
+}
+
+// progressImage 包装镜像的层，统计层的下载进度
+type progressImage struct {
+	v1.Image
+	tracker *progressTracker
+}
+
+// Layers 实现了 v1.Image 接口
+func (i *progressImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]v1.Layer, len(layers))
+	for j, l := range layers {
+		wrapped[j] = &progressLayer{Layer: l, tracker: i.tracker}
+	}
+	return wrapped, nil
+}
+
+// LayerByDigest 实现了 v1.Image 接口
+func (i *progressImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return &progressLayer{Layer: l, tracker: i.tracker}, nil
+}
+
+// LayerByDiffID 实现了 v1.Image 接口，mutate 按 DiffID 查找基础镜像的层
+func (i *progressImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	return &progressLayer{Layer: l, tracker: i.tracker}, nil
+}
+
+// progressLayer 在读取压缩内容时统计下载的字节数
+type progressLayer struct {
+	v1.Layer
+	tracker *progressTracker
+}
+
+// Compressed 实现了 v1.Layer 接口
+func (l *progressLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := l.Digest()
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	size, err := l.Size()
+	if err != nil {
+		size = 0
+	}
+	bp := l.tracker.begin("pull "+digest.String(), shortID(digest.String()), directionDownload, size)
+	return &countingReader{ReadCloser: rc, tracker: l.tracker, blob: bp, finishOnEOF: true}, nil
+}
+
+// countingReader 在读取时累加 blob 的传输字节数
+type countingReader struct {
+	io.ReadCloser
+	tracker     *progressTracker
+	blob        *blobProgress
+	finishOnEOF bool
+}
+
+// Read 实现了 io.Reader 接口
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	if n > 0 {
+		cr.tracker.add(cr.blob, int64(n))
+	}
+	if err == io.EOF && cr.finishOnEOF {
+		cr.tracker.finish(cr.blob)
+	}
+	return n, err
+}
+
+// Close 实现了 io.Closer 接口
+func (cr *countingReader) Close() error {
+	if cr.finishOnEOF {
+		cr.tracker.finish(cr.blob)
+	}
+	return cr.ReadCloser.Close()
+}
+
+// isTerminal 判断文件是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// shortID 缩短 digest 或上传 ID 用于展示
+func shortID(id string) string {
+	if algo, hex, ok := strings.Cut(id, ":"); ok && len(hex) > 12 {
+		return algo + ":" + hex[:12]
+	}
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// humanBytes 将字节数格式化为便于阅读的形式
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// percent 返回完成百分比，total 未知时返回 0
+func percent(complete, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	if complete >= total {
+		return 100
+	}
+	return int(complete * 100 / total)
+}
+
+// bar 生成指定宽度的文本进度条
+func bar(complete, total int64, width int) string {
+	filled := percent(complete, total) * width / 100
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+// directionVerb 返回传输方向的描述
+func directionVerb(direction string) string {
+	if direction == directionUpload {
+		return "Uploaded"
+	}
+	return "Downloaded"
+}
+
+// directionUnit 返回传输方向上统计的对象：下载统计基础镜像的层，上传统计推送的镜像
+func directionUnit(direction string) string {
+	if direction == directionUpload {
+		return "images"
+	}
+	return "layers"
+}
+
+// directionArrow 返回传输方向的箭头
+func directionArrow(direction string) string {
+	if direction == directionUpload {
+		return "↑"
+	}
+	return "↓"
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// newTestTracker 创建定期输出进度日志的跟踪器
+func newTestTracker() (*progressTracker, *bytes.Buffer) {
+	var buf bytes.Buffer
+	pt := newProgressTracker(event.New(&buf))
+	pt.mode = progressLines
+	return pt, &buf
+}
+
+// TestProgressImage 测试读取基础镜像的层时统计下载的字节数
+func TestProgressImage(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不展示进度时不包装镜像
+	if got := newProgressTracker(nil).image(img); got != img {
+		t.Errorf("Expected the image to be returned as is when progress is off")
+	}
+
+	// 与构建时相同，层经过 mutate 读取
+	pt, buf := newTestTracker()
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutated, err := mutate.ConfigFile(pt.image(img), cf.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := mutated.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, l := range layers {
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+		total += n
+	}
+	pt.Finish()
+
+	summaries := pt.summaries()
+	if len(summaries) != 1 || summaries[0].direction != directionDownload {
+		t.Fatalf("Expected a download summary, got %+v", summaries)
+	}
+	if s := summaries[0]; s.blobs != 3 || s.complete != total || s.total != total {
+		t.Errorf("Expected 3 layers and %d bytes, got %+v", total, s)
+	}
+	if got := strings.Count(buf.String(), "Downloaded sha256:"); got != 3 {
+		t.Errorf("Expected a log line per layer, got:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Downloaded 3 layers") {
+		t.Errorf("Expected a download summary, got:\n%s", buf.String())
+	}
+}
+
+// TestProgressPush 测试按 remote.WithProgress 的更新统计推送的字节数
+func TestProgressPush(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt, buf := newTestTracker()
+	updates, wait := pt.push(ref.String())
+	if err := remote.Write(ref, img, remote.WithProgress(updates)); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	wait()
+	pt.Finish()
+
+	summaries := pt.summaries()
+	if len(summaries) != 1 || summaries[0].direction != directionUpload {
+		t.Fatalf("Expected an upload summary, got %+v", summaries)
+	}
+	if s := summaries[0]; s.blobs != 1 || s.complete == 0 || s.complete != s.total {
+		t.Errorf("Expected one completed push, got %+v", s)
+	}
+	if !strings.Contains(buf.String(), "Uploaded "+ref.String()+":") {
+		t.Errorf("Expected a log line for the push, got:\n%s", buf.String())
+	}
+
+	// 不展示进度时不创建通道
+	if updates, _ := newProgressTracker(nil).push(ref.String()); updates != nil {
+		t.Errorf("Expected no progress channel when progress is off")
+	}
+}
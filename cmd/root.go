@@ -26,6 +26,10 @@ import (
 	"strings"
 	"sync"
 
+	jibconfig "github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/registry"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
 	"github.com/docker/cli/cli/config"
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/logs"
@@ -58,9 +62,28 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 	verbose := false
 	insecure := false
 	ndlayers := false
+	registryConfig := ""
+	maxUploads := 0
+	maxDownloads := 0
+	rateLimit := 0.0
+	logFormat := string(event.FormatText)
+	quiet := false
+	traceFile := ""
 	platform := &platformValue{}
 
 	wt := &warnTransport{}
+	var lt *limitTransport
+
+	// Per-registry TLS and proxy settings are applied on top of this
+	// transport. The create command adds the registries declared in the
+	// build file later.
+	transport := remote.DefaultTransport.(*http.Transport).Clone()
+	log := event.New(os.Stderr)
+	s := &session{
+		registries: registry.NewTransport(transport),
+		log:        log,
+		progress:   newProgressTracker(log),
+	}
 
 	root := &cobra.Command{
 		Use:               use,
@@ -68,12 +91,23 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 		RunE:              func(cmd *cobra.Command, _ []string) error { return cmd.Usage() },
 		DisableAutoGenTag: true,
 		SilenceUsage:      true,
-		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if traceFile != "" {
+				s.tracer = trace.NewTracer(use, Version)
+				s.traceFile = traceFile
+				cmd.SetContext(trace.WithTracer(cmd.Context(), s.tracer))
+			}
 			options = append(options, crane.WithContext(cmd.Context()))
 			// TODO(jonjohnsonjr): crane.Verbose option?
 			if verbose {
 				logs.Debug.SetOutput(os.Stderr)
 			}
+			format, err := event.ParseFormat(logFormat)
+			if err != nil {
+				return err
+			}
+			log.Configure(format, quiet, nocolor())
+			s.progress.Configure(format, quiet)
 			if insecure {
 				options = append(options, crane.Insecure)
 			}
@@ -90,12 +124,29 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 
 			options = append(options, crane.WithPlatform(platform.platform))
 
-			transport := remote.DefaultTransport.(*http.Transport).Clone()
 			transport.TLSClientConfig = &tls.Config{
 				InsecureSkipVerify: insecure, //nolint: gosec
 			}
 
-			var rt http.RoundTripper = transport
+			if registryConfig != "" {
+				rf, err := jibconfig.LoadRegistries(registryConfig)
+				if err != nil {
+					return err
+				}
+				if err := s.registries.SetProxy(rf.Proxy); err != nil {
+					return err
+				}
+				if err := s.registries.Configure(rf.Registries); err != nil {
+					return err
+				}
+			}
+
+			var rt http.RoundTripper = s.registries
+
+			// Record a span for every request attempt when tracing.
+			if s.tracer != nil {
+				rt = &traceTransport{inner: rt}
+			}
 
 			// Add any http headers if they are set in the config file.
 			cf, err := config.Load(os.Getenv("DOCKER_CONFIG"))
@@ -108,30 +159,71 @@ func New(use, short string, options []crane.Option) *cobra.Command {
 				}
 			}
 
+			// Limit download concurrency and request rate, and back off on 429s.
+			// Uploads are limited per blob by the pusher's jobs, and 429s are
+			// left out of ggcr's own retries so they aren't retried twice.
+			lt = newLimitTransport(rt, maxDownloads, rateLimit)
+			rt = lt
+			if maxUploads > 0 {
+				options = append(options, crane.WithJobs(maxUploads))
+			}
+			options = append(options, func(o *crane.Options) {
+				o.Remote = append(o.Remote, remote.WithRetryPredicate(retryPredicate))
+			})
+
 			// Inject our warning-collecting transport.
 			wt.inner = rt
 			rt = wt
 
 			options = append(options, crane.WithTransport(rt))
+			return nil
 		},
 		PersistentPostRun: func(_ *cobra.Command, _ []string) {
-			wt.Report() // Report any collected warnings.
+			if lt != nil {
+				if summary := lt.Summary(); summary != "" {
+					wt.add(summary)
+				}
+			}
+			wt.Report(log) // Report any collected warnings.
 		},
 	}
 
 	root.AddCommand(
 		NewCmdAuth(options, "crane-jib-tool", "auth"),
-		NewCmdCreate(&options),
+		NewCmdCreate(&options, s),
+		NewCmdBuildAll(&options, s),
+		NewCmdVars(&options, s),
+		NewCmdConfig(&options, s),
+		NewCmdValidate(&options, s),
+		NewCmdSchema(),
 	)
 
 	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable debug logs")
 	root.PersistentFlags().BoolVar(&insecure, "insecure", false, "Allow image references to be fetched without TLS")
+	root.PersistentFlags().StringVar(&registryConfig, "registry-config", "", "Path to a YAML file with proxy and per-registry TLS settings (CA bundles, client certificates, plain HTTP)")
+	root.PersistentFlags().IntVar(&maxUploads, "max-concurrent-uploads", 0, "Maximum number of concurrent blob uploads per push (0 for the default of 4)")
+	root.PersistentFlags().IntVar(&maxDownloads, "max-concurrent-downloads", 0, "Maximum number of concurrent blob downloads (0 for unlimited)")
+	root.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "Maximum number of registry requests per second (0 for unlimited)")
+	root.PersistentFlags().StringVar(&logFormat, "log-format", logFormat, "Log format for progress events written to stderr: text or json")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log warnings and errors")
+	root.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Write build phase and HTTP request spans to this file as OTLP JSON")
 	root.PersistentFlags().BoolVar(&ndlayers, "allow-nondistributable-artifacts", false, "Allow pushing non-distributable (foreign) layers")
 	root.PersistentFlags().Var(platform, "platform", "Specifies the platform in the form os/arch[/variant][:osversion] (e.g. linux/amd64).")
 
 	return root
 }
 
+// session holds the state shared by subcommands during one invocation.
+type session struct {
+	registries *registry.Transport
+	log        *event.Logger
+	progress   *progressTracker
+
+	// tracer is nil unless --trace-file is set.
+	tracer    *trace.Tracer
+	traceFile string
+}
+
 // headerTransport sets headers on outgoing requests.
 type headerTransport struct {
 	httpHeaders map[string]string
@@ -172,19 +264,21 @@ func (wt *warnTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 		start := strings.Index(wh, `"`)
 		end := strings.LastIndex(wh, `"`)
 		warn := wh[start+1 : end]
-		func() {
-			wt.mu.Lock()
-			defer wt.mu.Unlock()
-			if wt.warns == nil {
-				wt.warns = map[string]struct{}{}
-			}
-			wt.warns[warn] = struct{}{}
-		}()
+		wt.add(warn)
 	}
 	return resp, nil
 }
 
-func (wt *warnTransport) Report() {
+func (wt *warnTransport) add(warn string) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	if wt.warns == nil {
+		wt.warns = map[string]struct{}{}
+	}
+	wt.warns[warn] = struct{}{}
+}
+
+func (wt *warnTransport) Report(log *event.Logger) {
 	if wt.warns == nil {
 		return
 	}
@@ -194,6 +288,12 @@ func (wt *warnTransport) Report() {
 		warns = append(warns, k)
 	}
 	sort.Strings(warns)
+	if log.JSON() {
+		for _, w := range warns {
+			log.Warn("registry.warning", w, nil)
+		}
+		return
+	}
 	prefix := "\033[1;33m[WARNING]\033[0m:"
 	if nocolor() {
 		prefix = "[WARNING]:"
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdSchema creates a new cobra.Command for the schema subcommand.
+func NewCmdSchema() *cobra.Command {
+	var apiVersion string
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the build file for editors and pre-commit checks.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			schema, err := config.Schema(apiVersion)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(c.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(schema)
+		},
+	}
+	schemaCmd.Flags().StringVar(&apiVersion, "api-version", config.APIVersionV1Alpha1, "apiVersion of the build file to describe")
+
+	return schemaCmd
+}
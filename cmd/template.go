@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// fetchTemplate 返回拉取 oci:// 配置模板的函数，使用 --registry-config 等全局的仓库配置；
+// 配置文件中的 registries 在解析完成后才生效，不用于拉取模板
+func fetchTemplate(ctx context.Context, options []crane.Option, s *session) func(ref string) ([]byte, string, error) {
+	return func(ref string) ([]byte, string, error) {
+		s.log.Info("config.template", fmt.Sprintf("Pulling build template %s%s...", config.OCIPrefix, ref), event.Fields{"ref": ref})
+		ctx, span := trace.Start(ctx, "config.template", trace.String("template.ref", ref))
+		defer span.End()
+
+		var content []byte
+		var name string
+		img, err := crane.Pull(ref, append(options, crane.WithContext(ctx), withRegistryOptions(s.registries, ref))...)
+		if err == nil {
+			content, name, err = config.ReadArtifact(img)
+		}
+		span.SetError(err)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to pull build template %s%s: %w", config.OCIPrefix, ref, err)
+		}
+		return content, name, nil
+	}
+}
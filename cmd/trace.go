@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
+)
+
+// traceTransport 为每个发往仓库的 HTTP 请求记录一个 client span
+// 父 span 来自请求的 context，没有配置 tracer 时不记录
+type traceTransport struct {
+	inner http.RoundTripper
+}
+
+// RoundTrip 实现了 http.RoundTripper 接口
+func (tt *traceTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	// 查询参数中可能带有签名等敏感信息，不记录
+	u := *in.URL
+	u.RawQuery = ""
+	u.User = nil
+	ctx, span := trace.StartKind(in.Context(), in.Method, trace.KindClient,
+		trace.String("http.request.method", in.Method),
+		trace.String("url.full", u.String()),
+		trace.String("server.address", in.URL.Host),
+	)
+	if span == nil {
+		return tt.inner.RoundTrip(in)
+	}
+	defer span.End()
+
+	resp, err := tt.inner.RoundTrip(in.WithContext(ctx))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttributes(trace.Int("http.response.status_code", int64(resp.StatusCode)))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetError(fmt.Errorf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// writeTrace 将收集到的 span 写入 --trace-file，写入失败只输出警告
+func (s *session) writeTrace() {
+	if s.tracer == nil {
+		return
+	}
+	if err := s.tracer.WriteFile(s.traceFile); err != nil {
+		s.log.Warn("trace.write", err.Error(), event.Fields{"file": s.traceFile})
+		return
+	}
+	s.log.Info("trace.write", fmt.Sprintf("Trace written to: %s", s.traceFile), event.Fields{"file": s.traceFile})
+}
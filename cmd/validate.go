@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdValidate creates a new cobra.Command for the validate subcommand.
+func NewCmdValidate(options *[]crane.Option, s *session) *cobra.Command {
+	var cf configFlags
+	var vars varFlags
+	var profiles []string
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check a configuration file for unknown fields and invalid values without building.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			opts, err := cf.loadOptions(c, *options, s)
+			if err != nil {
+				return err
+			}
+			pool, varSources, err := vars.pool(s.log)
+			if err != nil {
+				return err
+			}
+			opts.VarSources = varSources
+			node, sources, err := config.LoadConfigNodeWithSources(cf.file, pool, opts)
+			if err != nil {
+				return err
+			}
+			node, _, err = config.ApplyProfiles(node, profiles)
+			if err != nil {
+				return err
+			}
+
+			diags := config.Validate(node, sources)
+			if len(diags) == 0 {
+				fmt.Fprintf(c.OutOrStdout(), "%s is valid\n", cf.file)
+				return nil
+			}
+			for _, d := range diags {
+				fmt.Fprintln(c.OutOrStdout(), d.Error())
+			}
+			return fmt.Errorf("found %d problem(s) in %s", len(diags), cf.file)
+		},
+	}
+	cf.register(validateCmd, "Path to config file to validate")
+	vars.register(validateCmd)
+	validateCmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "Profile from the config file's profiles section to apply before validating; repeat to apply several in order")
+
+	return validateCmd
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdVars creates a new cobra.Command for the vars subcommand.
+func NewCmdVars(options *[]crane.Option, s *session) *cobra.Command {
+	var cf configFlags
+	var vars varFlags
+
+	varsCmd := &cobra.Command{
+		Use:   "vars",
+		Short: "List the variables referenced by a configuration file and where their values come from.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			opts, err := cf.loadOptions(c, *options, s)
+			if err != nil {
+				return err
+			}
+			pool, sources, err := vars.pool(s.log)
+			if err != nil {
+				return err
+			}
+			opts.VarSources = sources
+			refs, err := config.FindConfigVars(cf.file, pool, opts)
+			if err != nil {
+				return err
+			}
+
+			// 按首次出现的顺序汇总每个变量的所有引用位置
+			var names []string
+			locations := make(map[string][]string)
+			ops := make(map[string]map[string]bool)
+			for _, ref := range refs {
+				if _, ok := locations[ref.Name]; !ok {
+					names = append(names, ref.Name)
+					ops[ref.Name] = make(map[string]bool)
+				}
+				locations[ref.Name] = append(locations[ref.Name], fmt.Sprintf("%s:%d:%d", ref.File, ref.Line, ref.Column))
+				ops[ref.Name][ref.Op] = true
+			}
+
+			w := tabwriter.NewWriter(c.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VARIABLE\tSOURCE\tREFERENCES")
+			for _, name := range names {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", name, varSource(name, sources, ops[name]), strings.Join(locations[name], ", "))
+			}
+			return w.Flush()
+		},
+	}
+	cf.register(varsCmd, "Path to config file to inspect")
+	vars.register(varsCmd)
+
+	return varsCmd
+}
+
+// varSource 返回变量值的来源说明
+func varSource(name string, sources map[string]string, ops map[string]bool) string {
+	if source, ok := sources[name]; ok {
+		return source
+	}
+	if config.IsTemplateFunc(name) {
+		return "function"
+	}
+	// 只有全部引用都带修饰符时才不会报错
+	if !ops[""] && !ops[":?"] {
+		if ops[":-"] {
+			return "undefined (default)"
+		}
+		return "undefined (empty)"
+	}
+	return "undefined"
+}
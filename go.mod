@@ -5,6 +5,7 @@ go 1.25.5
 require (
 	github.com/docker/cli v29.0.3+incompatible
 	github.com/google/go-containerregistry v0.20.7
+	github.com/pelletier/go-toml/v2 v2.2.4
 	github.com/spf13/cobra v1.10.1
 	gopkg.in/yaml.v3 v3.0.1
 )
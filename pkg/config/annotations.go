@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/git"
+)
+
+// 由 DeriveAnnotations 生成的 OCI 标准注解
+const (
+	AnnotationCreated  = "org.opencontainers.image.created"
+	AnnotationRevision = "org.opencontainers.image.revision"
+	AnnotationSource   = "org.opencontainers.image.source"
+
+	// annotationPrefix 为 OCI 标准注解的前缀，同名的标签会复制为注解
+	annotationPrefix = "org.opencontainers.image."
+)
+
+// AnnotationsConfig 定义了写入镜像索引和各平台镜像清单的注解
+type AnnotationsConfig struct {
+	// Index 为镜像索引（多平台清单）的注解
+	Index map[string]string `yaml:"index"`
+	// Manifest 为每个平台镜像清单的注解
+	Manifest map[string]string `yaml:"manifest"`
+	// Platforms 按平台（与 from.platforms 中的写法相同，如 linux/arm64）设置清单的注解，覆盖 Manifest 中的同名注解
+	Platforms map[string]map[string]string `yaml:"platforms"`
+	// Derive 为 true 时从标签和 git 仓库生成 OCI 标准注解，见 DeriveAnnotations
+	Derive bool `yaml:"derive"`
+}
+
+// IndexAnnotations 返回镜像索引的注解，配置中的注解覆盖生成的注解
+func (a AnnotationsConfig) IndexAnnotations(derived map[string]string) map[string]string {
+	return mergeAnnotations(derived, a.Index)
+}
+
+// ManifestAnnotations 返回平台 platform 的镜像清单的注解，
+// 优先级从低到高为生成的注解、Manifest 和 Platforms 中该平台的注解
+func (a AnnotationsConfig) ManifestAnnotations(platform string, derived map[string]string) map[string]string {
+	return mergeAnnotations(derived, a.Manifest, a.Platforms[platform])
+}
+
+// mergeAnnotations 按顺序合并注解，没有注解时返回 nil
+func mergeAnnotations(layers ...map[string]string) map[string]string {
+	var out map[string]string
+	for _, m := range layers {
+		for k, v := range m {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// DeriveAnnotations 生成 OCI 标准注解：
+//
+//   - labels 中以 org.opencontainers.image. 开头的标签
+//   - created 为镜像的创建时间
+//   - revision 和 source 为 dir 所在 git 仓库的当前提交和 origin 地址（见 git.SourceURL），
+//     不在 git 仓库中或没有 origin 时省略
+//
+// 标签中的值优先于从 git 仓库读取的值
+func DeriveAnnotations(labels map[string]string, created time.Time, dir string) map[string]string {
+	anns := map[string]string{
+		AnnotationCreated: created.UTC().Format(time.RFC3339),
+	}
+	if repo, err := git.Open(dir); err == nil {
+		if sha, err := repo.Head(); err == nil {
+			anns[AnnotationRevision] = sha
+		}
+		if url, err := repo.RemoteURL("origin"); err == nil {
+			anns[AnnotationSource] = git.SourceURL(url)
+		}
+	}
+	for k, v := range labels {
+		if strings.HasPrefix(k, annotationPrefix) {
+			anns[k] = v
+		}
+	}
+	return anns
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	// maxArtifactSize 为 oci:// 配置模板文件的大小上限
+	maxArtifactSize = 4 << 20
+	// annotationTitle 为 OCI artifact 中文件名的注解（oras push 会设置）
+	annotationTitle = "org.opencontainers.image.title"
+)
+
+// ReadArtifact 从 OCI artifact 中读取配置模板，返回内容和文件名（用于识别格式）。
+//
+// artifact 的每个层为一个原始文件（如 oras push 上传的文件），只有一个层时直接使用；
+// 有多个层时使用文件名（org.opencontainers.image.title 注解）为 .yaml、.yml、.json 或 .toml 的层，
+// 这样的层必须只有一个。没有文件名时按层的媒体类型识别 JSON 和 TOML
+func ReadArtifact(img v1.Image) ([]byte, string, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, "", errors.New("artifact contains no files")
+	}
+
+	desc := manifest.Layers[0]
+	if len(manifest.Layers) > 1 {
+		var candidates []v1.Descriptor
+		var names []string
+		for _, l := range manifest.Layers {
+			if title := l.Annotations[annotationTitle]; isConfigFileName(title) {
+				candidates = append(candidates, l)
+				names = append(names, title)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			return nil, "", fmt.Errorf("none of the %d files in the artifact is a .yaml, .yml, .json or .toml build file", len(manifest.Layers))
+		case 1:
+			desc = candidates[0]
+		default:
+			return nil, "", fmt.Errorf("artifact contains several build files (%s)", strings.Join(names, ", "))
+		}
+	}
+	if desc.Size > maxArtifactSize {
+		return nil, "", fmt.Errorf("build file in artifact is too large (%d bytes, limit %d)", desc.Size, maxArtifactSize)
+	}
+
+	layer, err := img.LayerByDigest(desc.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, maxArtifactSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) > maxArtifactSize {
+		return nil, "", fmt.Errorf("build file in artifact is too large (limit %d bytes)", maxArtifactSize)
+	}
+
+	name := desc.Annotations[annotationTitle]
+	if name == "" {
+		switch mt := string(desc.MediaType); {
+		case strings.Contains(mt, "json"):
+			name = "config.json"
+		case strings.Contains(mt, "toml"):
+			name = "config.toml"
+		}
+	}
+	return content, name, nil
+}
+
+// isConfigFileName 判断文件名是否为支持的配置文件格式
+func isConfigFileName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".yaml", ".yml", ".json", ".toml"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
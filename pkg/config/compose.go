@@ -0,0 +1,376 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 组合配置使用的键，加载后会从结果中移除
+const (
+	keyExtends = "extends"
+	keyInclude = "include"
+)
+
+// LoadConfigNode 读取配置文件，应用变量替换并处理 extends/include，返回合并后的 YAML 映射节点。
+//
+// 合并顺序为 extends 指向的文件、include 中的文件（按列表顺序）、当前文件，后者覆盖前者，
+// 相对路径相对于引用它的文件所在目录。合并规则见 MergeNodes。
+// 每个文件的格式按扩展名识别（见 DetectFormat），JSON 和 TOML 文件同样转换为 YAML 节点
+func LoadConfigNode(configPath string, varPool map[string]string) (*yaml.Node, error) {
+	node, _, err := LoadConfigNodeWithSources(configPath, varPool, LoadOptions{})
+	return node, err
+}
+
+// LoadConfigNodeWithSources 与 LoadConfigNode 相同，同时返回每个节点来自的配置文件，用于报告问题的位置。
+// opts 可以指定顶层配置文件的格式，以及从标准输入（-）和 oci:// 引用读取配置文件的方式
+func LoadConfigNodeWithSources(configPath string, varPool map[string]string, opts LoadOptions) (*yaml.Node, *Sources, error) {
+	l := &loader{pool: varPool, opts: opts, sources: &Sources{Root: displayPath(configPath), files: make(map[*yaml.Node]string)}}
+	node, err := l.load(configPath, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return node, l.sources, nil
+}
+
+// Sources 记录合并后的配置节点来自哪个配置文件
+type Sources struct {
+	// Root 为顶层配置文件，合并时新建的节点（如合并后的映射）归属于它
+	Root  string
+	files map[*yaml.Node]string
+}
+
+// File 返回节点所在的配置文件，s 为 nil 时返回空字符串
+func (s *Sources) File(node *yaml.Node) string {
+	if s == nil {
+		return ""
+	}
+	if file, ok := s.files[node]; ok {
+		return file
+	}
+	return s.Root
+}
+
+// add 记录 node 及其所有子节点来自 file
+func (s *Sources) add(node *yaml.Node, file string) {
+	s.files[node] = file
+	for _, child := range node.Content {
+		s.add(child, file)
+	}
+}
+
+// FindConfigVars 返回配置文件及其通过 extends/include 引用的文件中引用的所有变量。
+// 引用的文件路径中可以包含变量，使用 varPool 替换后查找，替换错误在此忽略。
+// opts 的含义与 LoadConfigNodeWithSources 相同
+func FindConfigVars(configPath string, varPool map[string]string, opts LoadOptions) ([]VarRef, error) {
+	var refs []VarRef
+	seen := make(map[string]bool)
+	var walk func(path, from string) error
+	walk = func(path, from string) error {
+		key, err := sourceKey(path)
+		if err != nil {
+			return err
+		}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		content, name, err := opts.read(path, from)
+		if err != nil {
+			return err
+		}
+		display := displayPath(path)
+		fileRefs, err := FindVars(string(content))
+		if err != nil {
+			var ve VarErrors
+			if errors.As(err, &ve) {
+				ve.SetFile(display)
+			}
+			return err
+		}
+		for _, ref := range fileRefs {
+			ref.File = display
+			refs = append(refs, ref)
+		}
+
+		contentStr, _ := replaceVars(string(content), varPool, opts.VarSources, opts.restricted(path))
+		root, err := parseDocument([]byte(contentStr), opts.format(name, from))
+		if err != nil {
+			return fmt.Errorf("%s: %w", display, err)
+		}
+		parents, err := takeParents(root)
+		if err != nil {
+			return fmt.Errorf("%s: %w", display, err)
+		}
+		for _, parent := range parents {
+			parent, err := opts.resolvePath(parent, path)
+			if err != nil {
+				return err
+			}
+			if err := walk(parent, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(configPath, ""); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// loader 递归加载配置文件
+type loader struct {
+	pool    map[string]string
+	opts    LoadOptions
+	sources *Sources
+	// stack 为正在加载的文件（本地文件为绝对路径），用于检测循环引用
+	stack []string
+}
+
+// load 加载一个配置文件及其引用的文件，from 为引用它的文件，顶层文件为空
+func (l *loader) load(path, from string) (*yaml.Node, error) {
+	key, err := sourceKey(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range l.stack {
+		if p == key {
+			chain := append(append([]string{}, l.stack[i:]...), key)
+			return nil, fmt.Errorf("config files form a cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	l.stack = append(l.stack, key)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	// 1. 读取配置文件内容
+	content, name, err := l.opts.read(path, from)
+	if err != nil {
+		return nil, err
+	}
+	display := displayPath(path)
+
+	// 2. 应用变量替换到配置文件内容
+	contentStr, err := replaceVars(string(content), l.pool, l.opts.VarSources, l.opts.restricted(path))
+	if err != nil {
+		var ve VarErrors
+		if errors.As(err, &ve) {
+			ve.SetFile(display)
+		}
+		return nil, err
+	}
+
+	// 3. 按格式解析
+	root, err := parseDocument([]byte(contentStr), l.opts.format(name, from))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", display, err)
+	}
+	l.sources.add(root, display)
+	if l.opts.restricted(path) {
+		if err := checkTemplate(root, display); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4. 按顺序合并引用的文件
+	parents, err := takeParents(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", display, err)
+	}
+	var merged *yaml.Node
+	for _, parent := range parents {
+		parent, err := l.opts.resolvePath(parent, path)
+		if err != nil {
+			return nil, err
+		}
+		node, err := l.load(parent, path)
+		if err != nil {
+			return nil, err
+		}
+		merged = MergeNodes(merged, node)
+	}
+	return MergeNodes(merged, root), nil
+}
+
+// parseNode 解析 YAML 文档，返回顶层映射节点，空文档返回空映射。
+// 别名会被展开，以便合并后的节点可以独立编码
+func parseNode(content []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := expandAliases(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: top level must be a mapping", root.Line)
+	}
+	return root, nil
+}
+
+// expandAliases 将别名节点替换为其指向的节点，并清除锚点
+func expandAliases(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	node.Anchor = ""
+	for i, child := range node.Content {
+		node.Content[i] = expandAliases(child)
+	}
+	return node
+}
+
+// takeParents 从映射中取出并移除 extends 和 include，返回要先合并的文件列表
+func takeParents(root *yaml.Node) ([]string, error) {
+	var parents []string
+	extends := takeKey(root, keyExtends)
+	if extends != nil {
+		if extends.Kind != yaml.ScalarNode || extends.Value == "" {
+			return nil, fmt.Errorf("line %d: %s must be a file path", extends.Line, keyExtends)
+		}
+		parents = append(parents, extends.Value)
+	}
+
+	include := takeKey(root, keyInclude)
+	switch {
+	case include == nil:
+	case include.Kind == yaml.ScalarNode:
+		parents = append(parents, include.Value)
+	case include.Kind == yaml.SequenceNode:
+		for _, item := range include.Content {
+			if item.Kind != yaml.ScalarNode || item.Value == "" {
+				return nil, fmt.Errorf("line %d: %s must be a list of file paths", item.Line, keyInclude)
+			}
+			parents = append(parents, item.Value)
+		}
+	default:
+		return nil, fmt.Errorf("line %d: %s must be a file path or a list of file paths", include.Line, keyInclude)
+	}
+	return parents, nil
+}
+
+// takeKey 从映射中取出并移除 key 对应的值，不存在时返回 nil
+func takeKey(mapping *yaml.Node, key string) *yaml.Node {
+	idx := mappingIndex(mapping, key)
+	if idx < 0 {
+		return nil
+	}
+	value := mapping.Content[idx+1]
+	mapping.Content = append(mapping.Content[:idx:idx], mapping.Content[idx+2:]...)
+	return value
+}
+
+// MergeNodes 将 override 深度合并到 base 上，返回新的节点，不修改 base。规则如下：
+//
+//   - 映射：逐键合并，两边都有的键递归合并
+//   - layers.entries：按 name 合并，同名的层递归合并，其余追加到末尾
+//   - 其他列表和标量：override 整体替换 base
+func MergeNodes(base, override *yaml.Node) *yaml.Node {
+	return mergeNodes(base, override, "", nil)
+}
+
+// mergeNodes 合并节点，path 为以 . 连接的键路径；changed 不为 nil 时记录被覆盖或新增的字段路径
+func mergeNodes(base, override *yaml.Node, path string, changed *[]string) *yaml.Node {
+	switch {
+	case override == nil:
+		return base
+	case base == nil:
+		record(changed, path)
+		return override
+	case base.Kind == yaml.MappingNode && override.Kind == yaml.MappingNode:
+		out := copyNode(override)
+		out.Content = append([]*yaml.Node{}, base.Content...)
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+			if idx := mappingIndex(out, key.Value); idx >= 0 {
+				out.Content[idx+1] = mergeNodes(out.Content[idx+1], value, joinKey(path, key.Value), changed)
+			} else {
+				record(changed, joinKey(path, key.Value))
+				out.Content = append(out.Content, key, value)
+			}
+		}
+		return out
+	case base.Kind == yaml.SequenceNode && override.Kind == yaml.SequenceNode && path == "layers.entries":
+		return mergeByName(base, override, path, changed)
+	default:
+		if !equalNodes(base, override) {
+			record(changed, path)
+		}
+		return override
+	}
+}
+
+// mergeByName 按 name 字段合并两个映射列表
+func mergeByName(base, override *yaml.Node, path string, changed *[]string) *yaml.Node {
+	out := copyNode(override)
+	out.Content = append([]*yaml.Node{}, base.Content...)
+	for _, item := range override.Content {
+		name := entryName(item)
+		idx := -1
+		for i, existing := range out.Content {
+			if name != "" && entryName(existing) == name {
+				idx = i
+				break
+			}
+		}
+		if idx >= 0 {
+			out.Content[idx] = mergeNodes(out.Content[idx], item, path+"."+name, changed)
+		} else {
+			record(changed, joinKey(path, name))
+			out.Content = append(out.Content, item)
+		}
+	}
+	return out
+}
+
+// record 记录被覆盖的字段路径
+func record(changed *[]string, path string) {
+	if changed != nil {
+		*changed = append(*changed, path)
+	}
+}
+
+// equalNodes 判断两个节点的内容是否相同
+func equalNodes(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !equalNodes(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// entryName 返回映射中 name 字段的值，没有时返回空字符串
+func entryName(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	if idx := mappingIndex(node, "name"); idx >= 0 {
+		return node.Content[idx+1].Value
+	}
+	return ""
+}
+
+// mappingIndex 返回映射中 key 所在的下标，不存在时返回 -1
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyNode 浅拷贝节点，不包含子节点
+func copyNode(node *yaml.Node) *yaml.Node {
+	out := *node
+	out.Content = nil
+	return &out
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeConfigFiles 在临时目录中写入多个配置文件，返回目录
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestParseConfigExtends 测试 extends 和 include 的合并规则
+func TestParseConfigExtends(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": `from:
+  image: alpine:3.19
+  platforms: [linux/amd64, linux/arm64]
+labels:
+  team: platform
+  tier: base
+cmd: [base]
+layers:
+  properties:
+    user: "1000"
+  entries:
+    - name: config
+      files: [{src: a, dest: /a}]
+    - name: app
+      properties:
+        filePermissions: "644"
+      files: [{src: app, dest: /app}]
+to: ${REGISTRY}/base:latest
+`,
+		"common.yaml": `labels:
+  owner: ops
+  tier: common
+`,
+		"svc/build.yaml": `extends: ../base.yaml
+include:
+  - ../common.yaml
+labels:
+  service: orders
+cmd: [svc, run]
+layers:
+  entries:
+    - name: app
+      files: [{src: bin, dest: /bin/app}]
+    - name: extra
+      files: [{src: x, dest: /x}]
+to: ${REGISTRY}/orders:v1
+`,
+	})
+
+	cfg, err := ParseConfig(filepath.Join(dir, "svc", "build.yaml"), map[string]string{"REGISTRY": "reg.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.From.Image != "alpine:3.19" || len(cfg.From.Platforms) != 2 {
+		t.Errorf("Expected from to be inherited, got %+v", cfg.From)
+	}
+	expectedLabels := map[string]string{"team": "platform", "tier": "common", "owner": "ops", "service": "orders"}
+	for k, v := range expectedLabels {
+		if cfg.Labels[k] != v {
+			t.Errorf("Expected label %s=%s, got %q", k, v, cfg.Labels[k])
+		}
+	}
+	if len(cfg.Cmd) != 2 || cfg.Cmd[0] != "svc" {
+		t.Errorf("Expected cmd to be replaced, got %v", cfg.Cmd)
+	}
+	if cfg.Layers.Properties.User != "1000" {
+		t.Errorf("Expected layer properties to be inherited, got %+v", cfg.Layers.Properties)
+	}
+
+	entries := cfg.Layers.Entries
+	if len(entries) != 3 || entries[0].Name != "config" || entries[1].Name != "app" || entries[2].Name != "extra" {
+		t.Fatalf("Expected entries merged by name, got %+v", entries)
+	}
+	if entries[1].Properties.FilePermissions != "644" || len(entries[1].Files) != 1 || entries[1].Files[0].Src != "bin" {
+		t.Errorf("Expected app entry merged, got %+v", entries[1])
+	}
+	if cfg.To.Repository != "reg.example.com/orders" {
+		t.Errorf("Expected to be overridden, got %+v", cfg.To)
+	}
+}
+
+// TestLoadConfigNodeErrors 测试循环引用和缺失文件
+func TestLoadConfigNodeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"a.yaml":       "extends: b.yaml\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"missing.yaml": "include: nothere.yaml\n",
+		"bad.yaml":     "extends: [a.yaml]\n",
+		"vars.yaml":    "extends: ${MISSING}.yaml\n",
+	})
+
+	tests := []struct {
+		file string
+		msg  string
+	}{
+		{"a.yaml", "config files form a cycle: " + filepath.Join(dir, "a.yaml") + " -> " + filepath.Join(dir, "b.yaml") + " -> " + filepath.Join(dir, "a.yaml")},
+		{"missing.yaml", "referenced from"},
+		{"bad.yaml", "extends must be a file path"},
+		{"vars.yaml", "undefined variable: ${MISSING}"},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfigNode(filepath.Join(dir, tt.file), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.file, tt.msg, err)
+		}
+	}
+}
+
+// TestLoadConfigNodeDiamond 测试同一文件被多次引用（非循环）
+func TestLoadConfigNodeDiamond(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"root.yaml": "labels: {a: root}\n",
+		"x.yaml":    "extends: root.yaml\nlabels: {x: x}\n",
+		"y.yaml":    "extends: root.yaml\nlabels: {y: y}\n",
+		"top.yaml":  "include: [x.yaml, y.yaml]\n",
+	})
+	node, err := LoadConfigNode(filepath.Join(dir, "top.yaml"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var cfg Config
+	if err := node.Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Labels) != 3 {
+		t.Errorf("Expected 3 labels, got %v", cfg.Labels)
+	}
+}
+
+// TestMergeNodesDoesNotModifyBase 测试合并不修改 base
+func TestMergeNodesDoesNotModifyBase(t *testing.T) {
+	base, err := parseNode([]byte("labels: {a: '1'}\nlist: [1]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	override, err := parseNode([]byte("labels: {b: '2'}\nlist: [2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := MergeNodes(base, override)
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "labels: {a: '1', b: '2'}\nlist: [2]\n"
+	if string(out) != expected {
+		t.Errorf("Expected merged %q, got %q", expected, out)
+	}
+	out, _ = yaml.Marshal(base)
+	if string(out) != "labels: {a: '1'}\nlist: [1]\n" {
+		t.Errorf("Expected base unchanged, got %q", out)
+	}
+}
+
+// TestApplyProfiles 测试按顺序应用 profile 并记录覆盖的字段
+func TestApplyProfiles(t *testing.T) {
+	root, err := parseNode([]byte(`from:
+  image: alpine
+to:
+  image: reg.example.com/app
+  tags: [latest]
+environment:
+  LOG_LEVEL: info
+  REGION: eu
+layers:
+  entries:
+    - name: app
+      files: [{src: app, dest: /app}]
+profiles:
+  dev:
+    to:
+      tags: [dev]
+    environment:
+      LOG_LEVEL: debug
+      REGION: eu
+    layers:
+      entries:
+        - name: debug
+          files: [{src: tools, dest: /tools}]
+  prod:
+    to:
+      image: prod.example.com/app
+  empty:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, overrides, err := ApplyProfiles(root, []string{"dev", "prod", "empty"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []ProfileOverride{
+		{Profile: "dev", Fields: []string{"to.tags", "environment.LOG_LEVEL", "layers.entries.debug"}},
+		{Profile: "prod", Fields: []string{"to.image"}},
+		{Profile: "empty"},
+	}
+	if len(overrides) != len(expected) {
+		t.Fatalf("Expected %d overrides, got %+v", len(expected), overrides)
+	}
+	for i, o := range overrides {
+		if o.Profile != expected[i].Profile || strings.Join(o.Fields, ",") != strings.Join(expected[i].Fields, ",") {
+			t.Errorf("Expected %+v, got %+v", expected[i], o)
+		}
+	}
+
+	cfg, err := DecodeConfig(node, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.To.Repository != "prod.example.com/app" || cfg.To.Tags[0] != "dev" {
+		t.Errorf("Unexpected to: %+v", cfg.To)
+	}
+	if cfg.Environment["LOG_LEVEL"] != "debug" || len(cfg.Layers.Entries) != 2 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	if mappingIndex(node, keyProfiles) >= 0 || mappingIndex(root, keyProfiles) < 0 {
+		t.Error("Expected profiles removed from result but not from input")
+	}
+}
+
+// TestApplyProfilesErrors 测试未定义的 profile
+func TestApplyProfilesErrors(t *testing.T) {
+	root, err := parseNode([]byte("profiles:\n  prod: {}\n  dev: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ApplyProfiles(root, []string{"prd"})
+	expected := `unknown profile "prd" (available: dev, prod), did you mean "prod"?`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, err)
+	}
+
+	root, _ = parseNode([]byte("from: {image: alpine}\n"))
+	if _, _, err := ApplyProfiles(root, []string{"dev"}); err == nil || !strings.Contains(err.Error(), "no profiles are defined") {
+		t.Errorf("Expected no profiles error, got %v", err)
+	}
+
+	root, _ = parseNode([]byte("profiles:\n  dev:\n    extends: base.yaml\n"))
+	if _, _, err := ApplyProfiles(root, []string{"dev"}); err == nil || !strings.Contains(err.Error(), "extends is not allowed") {
+		t.Errorf("Expected extends error, got %v", err)
+	}
+}
@@ -1,10 +1,8 @@
 package config
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 
@@ -13,22 +11,36 @@ import (
 
 // Config 定义了镜像构建的配置结构
 type Config struct {
-	APIVersion   string            `yaml:"apiVersion"`
-	Kind         string            `yaml:"kind"`
-	From         FromConfig        `yaml:"from"`
-	CreationTime string            `yaml:"creationTime"`
-	Format       string            `yaml:"format"`
-	Environment  map[string]string `yaml:"environment"`
-	Labels       map[string]string `yaml:"labels"`
-	Volumes      []string          `yaml:"volumes"`
-	ExposedPorts []string          `yaml:"exposedPorts"`
-	User         string            `yaml:"user"`
-	WorkingDir   string            `yaml:"workingDirectory"`
-	Entrypoint   []string          `yaml:"entrypoint"`
-	Cmd          []string          `yaml:"cmd"`
-	Layers       LayerConfig       `yaml:"layers"`
-	To           Tag               `yaml:"to"`
-	Insecure     bool              `yaml:"insecure"`
+	APIVersion   string                    `yaml:"apiVersion"`
+	Kind         string                    `yaml:"kind"`
+	From         FromConfig                `yaml:"from"`
+	CreationTime string                    `yaml:"creationTime"`
+	Format       string                    `yaml:"format"`
+	Environment  map[string]string         `yaml:"environment"`
+	Labels       map[string]string         `yaml:"labels"`
+	Volumes      []string                  `yaml:"volumes"`
+	ExposedPorts []string                  `yaml:"exposedPorts"`
+	User         string                    `yaml:"user"`
+	WorkingDir   string                    `yaml:"workingDirectory"`
+	Entrypoint   []string                  `yaml:"entrypoint"`
+	Cmd          []string                  `yaml:"cmd"`
+	Healthcheck  *HealthcheckConfig        `yaml:"healthcheck"`
+	StopSignal   string                    `yaml:"stopSignal"`
+	Shell        []string                  `yaml:"shell"`
+	OnBuild      []string                  `yaml:"onBuild"`
+	ArgsEscaped  bool                      `yaml:"argsEscaped"`
+	Remove       RemoveConfig              `yaml:"remove"`
+	Inherit      InheritConfig             `yaml:"inherit"`
+	Annotations  AnnotationsConfig         `yaml:"annotations"`
+	History      HistoryConfig             `yaml:"history"`
+	Layers       LayerConfig               `yaml:"layers"`
+	To           Tag                       `yaml:"to"`
+	Insecure     bool                      `yaml:"insecure"`
+	Proxy        *ProxyConfig              `yaml:"proxy"`
+	Registries   map[string]RegistryConfig `yaml:"registries"`
+
+	// environmentOrder 为 environment 在配置文件中的键顺序，见 EnvironmentKeys
+	environmentOrder []string
 }
 
 type Tag struct {
@@ -54,6 +66,51 @@ func (t *Tag) UnmarshalYAML(value *yaml.Node) error {
 	return fmt.Errorf("unsupported tag type: %s", value.Tag)
 }
 
+// RemoveConfig 定义了从基础镜像中删除的环境变量、标签、卷和端口，在合并配置文件中的值之前删除。
+// 同一个键不能既删除又在对应字段中设置，Validate 报告这种情况（见 checkRemove）
+type RemoveConfig struct {
+	Environment  []string `yaml:"environment"`
+	Labels       []string `yaml:"labels"`
+	Volumes      []string `yaml:"volumes"`
+	ExposedPorts []string `yaml:"exposedPorts"`
+}
+
+// InheritConfig 定义了是否继承基础镜像中对应字段的值，未设置时为继承。
+// environment、labels、volumes 和 exposedPorts 继承时合并配置文件中的值，不继承时替换为配置文件中的值，
+// 配置文件中未设置则清空该字段。也可以写作 true 或 false，同时设置这四个集合字段。
+//
+// Cmd 未设置时与 Docker 一致：配置文件设置了 entrypoint 而没有设置 cmd 时清空基础镜像的 cmd，
+// 显式设置为 true 时保留
+type InheritConfig struct {
+	Environment  *bool `yaml:"environment"`
+	Labels       *bool `yaml:"labels"`
+	Volumes      *bool `yaml:"volumes"`
+	ExposedPorts *bool `yaml:"exposedPorts"`
+	Entrypoint   *bool `yaml:"entrypoint"`
+	Cmd          *bool `yaml:"cmd"`
+}
+
+func (i *InheritConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var inherit bool
+		if err := value.Decode(&inherit); err != nil {
+			return fmt.Errorf("invalid inherit %q, expected true, false or a mapping", value.Value)
+		}
+		i.Environment, i.Labels, i.Volumes, i.ExposedPorts = &inherit, &inherit, &inherit, &inherit
+		return nil
+	}
+	type rawInherit InheritConfig
+	return value.Decode((*rawInherit)(i))
+}
+
+// Inherits 判断是否继承基础镜像的值，未设置时返回 def
+func Inherits(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
 // FromConfig 定义了基础镜像的配置
 type FromConfig struct {
 	Image     string        `yaml:"image"`
@@ -75,9 +132,18 @@ type LayerProperties struct {
 	Timestamp            string `yaml:"timestamp"`
 }
 
-// LayerEntry 定义了单个层的配置
+// HistoryConfig 定义了镜像历史记录的生成方式
+type HistoryConfig struct {
+	// Author 为新增历史记录的作者
+	Author string `yaml:"author"`
+	// ConfigChanges 为 true 时为配置文件修改的每个镜像配置字段（如 ENV、EXPOSE）添加一条 empty_layer 历史记录
+	ConfigChanges bool `yaml:"configChanges"`
+}
+
+// LayerEntry 定义了单个层的配置，Comment 为该层历史记录的说明
 type LayerEntry struct {
 	Name       string          `yaml:"name"`
+	Comment    string          `yaml:"comment"`
 	Properties LayerProperties `yaml:"properties"`
 	Files      []FileConfig    `yaml:"files"`
 }
@@ -91,98 +157,113 @@ type FileConfig struct {
 	Properties LayerProperties `yaml:"properties"`
 }
 
+// 变量来源，见 BuildVarPoolWithSources
+const (
+	SourceEnv     = "env"
+	SourceBuiltin = "builtin"
+	SourceVal     = "--val"
+)
+
+// VarPoolOptions 控制变量池的构建方式
+type VarPoolOptions struct {
+	// NoEnv 为 true 时不导入进程的环境变量，仍可以通过 ${env:NAME} 显式读取
+	NoEnv bool
+	// Lenient 为 true 时跳过无法读取或解析的变量文件，并通过 Warn 报告错误
+	Lenient bool
+	// Warn 接收 Lenient 时跳过的变量文件的错误，为 nil 时忽略
+	Warn func(err error)
+}
+
 // BuildVarPool 构建变量池，从环境变量、变量文件和命令行参数中收集变量
-func BuildVarPool(valFiles []string, vals map[string]string) map[string]string {
+func BuildVarPool(valFiles []string, vals map[string]string, opts VarPoolOptions) (map[string]string, error) {
+	pool, _, err := BuildVarPoolWithSources(valFiles, vals, opts)
+	return pool, err
+}
+
+// BuildVarPoolWithSources 构建变量池，同时返回每个变量最终取值的来源：
+// SourceEnv、SourceBuiltin、SourceVal 或 "--valf <文件路径>"。
+// 变量文件读取或解析失败时返回错误（opts.Lenient 时跳过该文件），格式见 LoadVarFile
+func BuildVarPoolWithSources(valFiles []string, vals map[string]string, opts VarPoolOptions) (map[string]string, map[string]string, error) {
 	// 1. 初始化变量池，包含环境变量和默认的时间戳
 	now := time.Now()
 	defaultTimestamp := fmt.Sprintf("%d%02d%02d%02d%02d%02d",
 		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second())
 
 	pool := make(map[string]string)
+	sources := make(map[string]string)
 	// 添加环境变量
-	for _, env := range os.Environ() {
-		parts := strings.SplitN(env, "=", 2)
-		if len(parts) == 2 {
-			pool[parts[0]] = parts[1]
+	if !opts.NoEnv {
+		for _, env := range os.Environ() {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) == 2 {
+				pool[parts[0]] = parts[1]
+				sources[parts[0]] = SourceEnv
+			}
 		}
 	}
 	// 添加默认时间戳
 	pool["TimestampTag"] = defaultTimestamp
+	sources["TimestampTag"] = SourceBuiltin
 
 	// 2. 添加变量文件中的变量
 	for _, file := range valFiles {
-		content, err := os.ReadFile(file)
+		fileVars, err := LoadVarFile(file)
 		if err != nil {
-			fmt.Printf("Warning: failed to read variable file %s: %v\n", file, err)
-			continue
-		}
-
-		var fileVars map[string]string
-		if err := yaml.Unmarshal(content, &fileVars); err != nil {
-			fmt.Printf("Warning: failed to parse variable file %s: %v\n", file, err)
+			if !opts.Lenient {
+				return nil, nil, err
+			}
+			if opts.Warn != nil {
+				opts.Warn(err)
+			}
 			continue
 		}
 
 		for k, v := range fileVars {
 			pool[k] = v
+			sources[k] = "--valf " + file
 		}
 	}
 
 	// 3. 添加命令行参数中的变量（优先级最高）
 	for k, v := range vals {
 		pool[k] = v
+		sources[k] = SourceVal
 	}
 
-	return pool
+	return pool, sources, nil
 }
 
-// ReplaceVars 替换字符串中的变量，格式为 ${var}
-func ReplaceVars(str string, pool map[string]string) (string, error) {
-	re := regexp.MustCompile(`\$\{(.*?)\}`)
-	var err error
-	result := re.ReplaceAllStringFunc(str, func(match string) string {
-		key := strings.Trim(match, "${}")
-		if val, ok := pool[key]; ok {
-			return val
-		}
-		err = fmt.Errorf("undefined variable: ${%s}", key)
-		return match
-	})
-	return result, err
-}
-
-// ParseConfig 解析配置文件并应用变量替换
-func ParseConfig(configPath string, varPool map[string]string) (*Config, error) {
-	// 1. 检查配置文件是否存在
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file %s does not exist", configPath)
-	}
-
-	// 2. 读取配置文件内容
-	content, err := os.ReadFile(configPath)
+// ParseConfig 解析配置文件并应用变量替换，支持通过 extends/include 组合多个文件（见 LoadConfigNode），
+// 并按顺序应用 profiles 中选中的 profile（见 ApplyProfiles）
+func ParseConfig(configPath string, varPool map[string]string, profiles ...string) (*Config, error) {
+	// 1. 读取配置文件，应用变量替换并合并引用的文件
+	node, sources, err := LoadConfigNodeWithSources(configPath, varPool, LoadOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
-	// 3. 应用变量替换到配置文件内容
-	contentStr, err := ReplaceVars(string(content), varPool)
+	// 2. 应用 profile
+	node, _, err = ApplyProfiles(node, profiles)
 	if err != nil {
 		return nil, err
 	}
 
-	// 4. 解析 YAML 配置
-	var cfg Config
-	if err := yaml.Unmarshal([]byte(contentStr), &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
-	}
+	return DecodeConfig(node, sources)
+}
 
-	// 5. 验证必要字段
-	if cfg.From.Image == "" {
-		return nil, errors.New("from.image field is required in config file")
-	}
-	if cfg.To.Repository == "" {
-		return nil, errors.New("to field is required in config file")
+// DecodeConfig 检查合并后的配置节点（见 Validate）并解析为 Config，有问题时返回 Diagnostics。
+// sources 用于报告问题所在的文件，可以为 nil
+func DecodeConfig(node *yaml.Node, sources *Sources) (*Config, error) {
+	// 1. 检查配置，包括未知字段
+	if diags := Validate(node, sources); len(diags) > 0 {
+		return nil, diags
 	}
 
+	// 2. 解析 YAML 配置
+	var cfg Config
+	if err := node.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	cfg.setEnvironmentOrder(node)
 	return &cfg, nil
 }
@@ -1,20 +1,28 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 // TestBuildVarPool 测试构建变量池功能
 func TestBuildVarPool(t *testing.T) {
 	// 测试用例：空输入
-	vars := BuildVarPool(nil, nil)
+	vars, err := BuildVarPool(nil, nil, VarPoolOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 	if vars == nil {
 		t.Error("Expected non-nil vars map")
 	}
 
 	// 测试用例：添加命令行参数
 	cmdVars := map[string]string{"TestVar": "test-value"}
-	vars = BuildVarPool(nil, cmdVars)
+	vars, err = BuildVarPool(nil, cmdVars, VarPoolOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 	if vars["TestVar"] != "test-value" {
 		t.Errorf("Expected TestVar=test-value, got %s=%s", "TestVar", vars["TestVar"])
 	}
@@ -61,3 +69,61 @@ func TestReplaceVars(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+// TestLoadRegistries 测试加载仓库配置文件
+func TestLoadRegistries(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "registries.yaml")
+	content := `registries:
+  registry.internal:5000:
+    caCerts:
+      - /etc/ssl/internal-ca.pem
+    clientCert: /etc/ssl/client.pem
+    clientKey: /etc/ssl/client-key.pem
+  localhost:5000:
+    plainHttp: true
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write registry config: %v", err)
+	}
+
+	rf, err := LoadRegistries(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	regs := rf.Registries
+	if len(regs["registry.internal:5000"].CACerts) != 1 {
+		t.Errorf("Expected 1 CA bundle, got %v", regs["registry.internal:5000"].CACerts)
+	}
+	if !regs["localhost:5000"].PlainHTTP {
+		t.Error("Expected plainHttp for localhost:5000")
+	}
+
+	// 测试用例：客户端证书缺少私钥
+	content = `registries:
+  registry.internal:
+    clientCert: /etc/ssl/client.pem
+`
+	os.WriteFile(file, []byte(content), 0644)
+	if _, err := LoadRegistries(file); err == nil {
+		t.Error("Expected error for client cert without key, got nil")
+	}
+}
+
+// TestMergeRegistries 测试合并仓库配置
+func TestMergeRegistries(t *testing.T) {
+	base := map[string]RegistryConfig{
+		"registry.internal": {CACerts: []string{"a.pem"}},
+	}
+	override := map[string]RegistryConfig{
+		"registry.internal": {CACerts: []string{"b.pem"}, PlainHTTP: true},
+		"other":             {Insecure: true},
+	}
+	merged := MergeRegistries(base, override)
+	if got := merged["registry.internal"]; len(got.CACerts) != 2 || !got.PlainHTTP {
+		t.Errorf("Unexpected merge result: %+v", got)
+	}
+	if !merged["other"].Insecure {
+		t.Error("Expected other registry to be insecure")
+	}
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvironmentKeys 返回 environment 中的变量名，按配置文件中的顺序排列。
+// 配置不是由 DecodeConfig 解析时没有顺序信息，按名称排序
+func (c *Config) EnvironmentKeys() []string {
+	if len(c.environmentOrder) == len(c.Environment) {
+		return c.environmentOrder
+	}
+	keys := make([]string, 0, len(c.Environment))
+	for k := range c.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setEnvironmentOrder 从配置节点中记录 environment 的键顺序
+func (c *Config) setEnvironmentOrder(root *yaml.Node) {
+	env := child(root, "environment")
+	if env == nil || env.Kind != yaml.MappingNode {
+		return
+	}
+	c.environmentOrder = make([]string, 0, len(env.Content)/2)
+	for i := 0; i < len(env.Content); i += 2 {
+		c.environmentOrder = append(c.environmentOrder, env.Content[i].Value)
+	}
+}
+
+// BuildEnv 按配置修改基础镜像的环境变量，返回新的环境变量和 remove 中基础镜像没有的变量名。
+//
+// 基础镜像中的变量保持原有顺序，配置文件中新增的变量按配置文件中的顺序追加在后面，
+// 使相同的配置总是得到相同的镜像配置。配置中的值按 ExpandEnv 展开，
+// 可以引用基础镜像和配置文件中前面定义的变量，如 PATH: /app/bin:$PATH
+func BuildEnv(base []string, cfg *Config) ([]string, []string, error) {
+	var names []string
+	values := make(map[string]string)
+	set := func(k, v string) {
+		if _, ok := values[k]; !ok {
+			names = append(names, k)
+		}
+		values[k] = v
+	}
+	if Inherits(cfg.Inherit.Environment, true) {
+		for _, e := range base {
+			k, v, _ := strings.Cut(e, "=")
+			set(k, v)
+		}
+	}
+
+	// 1. 删除基础镜像中的变量
+	var missing []string
+	for _, k := range cfg.Remove.Environment {
+		if _, ok := values[k]; !ok {
+			missing = append(missing, k)
+			continue
+		}
+		delete(values, k)
+		for i, name := range names {
+			if name == k {
+				names = append(names[:i], names[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// 2. 按顺序设置配置文件中的变量，每个值可以引用前面的变量
+	lookup := func(name string) (string, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+	for _, k := range cfg.EnvironmentKeys() {
+		v, err := ExpandEnv(cfg.Environment[k], lookup)
+		if err != nil {
+			return nil, nil, fmt.Errorf("environment %s: %w", k, err)
+		}
+		set(k, v)
+	}
+
+	env := make([]string, 0, len(names))
+	for _, k := range names {
+		env = append(env, k+"="+values[k])
+	}
+	return env, missing, nil
+}
+
+// ExpandEnv 按 Dockerfile ENV 的规则展开字符串中对环境变量的引用：
+//
+//	$VAR、${VAR}    变量的值，未定义时为空
+//	${VAR:-word}    变量未定义或为空时使用 word
+//	${VAR:+word}    变量已定义且非空时使用 word，否则为空
+//	\$              字面量 $
+//
+// 配置文件加载时 ${...} 已按变量池替换，需要在构建时展开的 ${...} 写作 $${...}
+func ExpandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		if s[i+1] != '{' {
+			n := envNameLen(s[i+1:])
+			if n == 0 {
+				b.WriteByte(c)
+				continue
+			}
+			v, _ := lookup(s[i+1 : i+1+n])
+			b.WriteString(v)
+			i += n
+			continue
+		}
+
+		end := matchingBrace(s, i+1)
+		if end < 0 {
+			return "", fmt.Errorf("missing '}' in %q", s)
+		}
+		v, err := expandBraced(s[i+2:end], lookup)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		i = end
+	}
+	return b.String(), nil
+}
+
+// expandBraced 展开 ${...} 中的内容
+func expandBraced(expr string, lookup func(string) (string, bool)) (string, error) {
+	n := envNameLen(expr)
+	if n == 0 {
+		return "", fmt.Errorf("invalid variable name in ${%s}", expr)
+	}
+	name, rest := expr[:n], expr[n:]
+	v, ok := lookup(name)
+	switch {
+	case rest == "":
+		return v, nil
+	case strings.HasPrefix(rest, ":-"):
+		if ok && v != "" {
+			return v, nil
+		}
+		return ExpandEnv(rest[2:], lookup)
+	case strings.HasPrefix(rest, ":+"):
+		if ok && v != "" {
+			return ExpandEnv(rest[2:], lookup)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported modifier in ${%s}, expected :- or :+", expr)
+}
+
+// envNameLen 返回 s 开头的变量名长度，变量名由字母、数字和下划线组成，不以数字开头
+func envNameLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// matchingBrace 返回 s[open] 处的 { 对应的 } 的位置，没有时返回 -1
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExpandEnv 测试按 Dockerfile ENV 规则展开环境变量引用
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"PATH": "/usr/bin", "HOME": "/root", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	tests := map[string]string{
+		"/app/bin:$PATH":          "/app/bin:/usr/bin",
+		"${HOME}/.cache":          "/root/.cache",
+		"$HOME$PATH":              "/root/usr/bin",
+		"$NOPE:x":                 ":x",
+		"${NOPE:-/tmp}":           "/tmp",
+		"${EMPTY:-$HOME}":         "/root",
+		"${HOME:+set}${NOPE:+no}": "set",
+		`price: \$5`:              "price: $5",
+		"50% $ off $":             "50% $ off $",
+		"$1":                      "$1",
+	}
+	for in, expected := range tests {
+		got, err := ExpandEnv(in, lookup)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", in, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("ExpandEnv(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+
+	for in, msg := range map[string]string{
+		"${HOME":    "missing '}'",
+		"${1}":      "invalid variable name",
+		"${HOME:?}": "unsupported modifier",
+	} {
+		if _, err := ExpandEnv(in, lookup); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected error containing %q for %q, got %v", msg, in, err)
+		}
+	}
+}
+
+// TestBuildEnv 测试环境变量保持基础镜像的顺序，新增变量按配置文件的顺序追加
+func TestBuildEnv(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"build.yaml": `from: {image: alpine}
+to: r/app:v1
+environment:
+  ZETA: z
+  APP_HOME: /app
+  PATH: $APP_HOME/bin:$PATH
+  ALPHA: a
+remove:
+  environment: [DEBUG, MISSING]
+`,
+	})
+	cfg, err := ParseConfig(filepath.Join(dir, "build.yaml"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	base := []string{"PATH=/usr/bin", "DEBUG=1", "LANG=C"}
+	for i := 0; i < 10; i++ {
+		env, missing, err := BuildEnv(base, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{"PATH=/app/bin:/usr/bin", "LANG=C", "ZETA=z", "APP_HOME=/app", "ALPHA=a"}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected %v, got %v", expected, env)
+		}
+		if !reflect.DeepEqual(missing, []string{"MISSING"}) {
+			t.Errorf("Expected MISSING to be reported, got %v", missing)
+		}
+	}
+
+	// 不继承时只使用配置文件中的变量，引用基础镜像的变量为空
+	inherit := false
+	cfg.Inherit.Environment = &inherit
+	cfg.Remove.Environment = nil
+	env, _, err := BuildEnv(base, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"ZETA=z", "APP_HOME=/app", "PATH=/app/bin:", "ALPHA=a"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected %v, got %v", expected, env)
+	}
+
+	// 没有顺序信息时按名称排序
+	env, _, err = BuildEnv(nil, &Config{Environment: map[string]string{"B": "2", "A": "1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(env, []string{"A=1", "B=2"}) {
+		t.Errorf("Expected sorted environment, got %v", env)
+	}
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Format 定义了配置文件的格式
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// ParseFormat 解析配置文件格式字符串，空字符串表示按扩展名识别
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "":
+		return "", nil
+	case FormatYAML, "yml":
+		return FormatYAML, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatTOML:
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("invalid config format %q, expected yaml, json or toml", s)
+}
+
+// DetectFormat 按扩展名识别配置文件格式：.json 为 JSON，.toml 为 TOML，其他为 YAML
+func DetectFormat(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatYAML
+}
+
+// parseDocument 按格式解析配置文件，返回顶层映射节点。
+// JSON 和 TOML 同样转换为 YAML 节点，以便使用相同的合并、检查和解析逻辑
+func parseDocument(content []byte, format Format) (*yaml.Node, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSONNode(content)
+	case FormatTOML:
+		return parseTOMLNode(content)
+	}
+	return parseNode(content)
+}
+
+// parseJSONNode 解析 JSON 文档。JSON 是 YAML 的子集，先按 JSON 检查语法，
+// 使不符合 JSON 的内容（如注释、单引号）报错，再按 YAML 解析以保留行号和列号
+func parseJSONNode(content []byte) (*yaml.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var se *json.SyntaxError
+			if errors.As(err, &se) {
+				// Offset 为读取出错字符之后的偏移量
+				line, col := offsetPosition(content, int(se.Offset)-1)
+				return nil, fmt.Errorf("line %d, column %d: %v", line, col, se)
+			}
+			return nil, err
+		}
+	}
+	return parseNode(content)
+}
+
+// parseTOMLNode 解析 TOML 文档，转换为 YAML 映射节点并保留行号和列号。
+// 先由 go-toml 按 TOML 1.0 完整解码，检查语法以及重复定义的键和表，
+// 再遍历 go-toml 的语法树按文档顺序构建节点；日期时间作为字符串保留原文
+func parseTOMLNode(content []byte) (*yaml.Node, error) {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal(content, &doc); err != nil {
+		var de *toml.DecodeError
+		if errors.As(err, &de) {
+			line, col := de.Position()
+			return nil, fmt.Errorf("line %d, column %d: %s", line, col, strings.TrimPrefix(de.Error(), "toml: "))
+		}
+		// 重复定义的键和表等错误没有位置
+		return nil, errors.New(strings.TrimPrefix(err.Error(), "toml: "))
+	}
+
+	b := &tomlBuilder{}
+	b.p.Reset(content)
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	table := root
+	for b.p.NextExpression() {
+		expr := b.p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = b.table(root, expr)
+		case unstable.KeyValue:
+			b.keyValue(table, expr)
+		}
+	}
+	if err := b.p.Error(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// tomlBuilder 将 go-toml 的语法树转换为 YAML 节点，文档已通过解码检查，不再检查重复定义
+type tomlBuilder struct {
+	p unstable.Parser
+}
+
+// position 返回语法树节点在文档中的行号和列号，节点没有原文位置时返回 0
+func (b *tomlBuilder) position(n *unstable.Node) (int, int) {
+	raw := n.Raw
+	if raw.Length == 0 && n.Kind != unstable.String && len(n.Data) > 0 {
+		// 布尔值和日期时间没有 Raw，其 Data 引用原文
+		raw = b.p.Range(n.Data)
+	}
+	if raw.Length == 0 {
+		return 0, 0
+	}
+	start := b.p.Shape(raw).Start
+	return start.Line, start.Column
+}
+
+// table 返回 [表] 或 [[表数组]] 表头对应的映射节点，表数组追加一个新的元素
+func (b *tomlBuilder) table(root *yaml.Node, expr *unstable.Node) *yaml.Node {
+	keys := expr.Key()
+	node := root
+	for keys.Next() {
+		key := keys.Node()
+		last := keys.IsLast()
+		if last && expr.Kind == unstable.ArrayTable {
+			array := b.child(node, key, yaml.SequenceNode)
+			line, col := b.position(key)
+			elem := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: col}
+			array.Content = append(array.Content, elem)
+			return elem
+		}
+		node = b.child(node, key, yaml.MappingNode)
+		// 表头中的表数组指向其最后一个元素
+		if node.Kind == yaml.SequenceNode {
+			node = node.Content[len(node.Content)-1]
+		}
+	}
+	return node
+}
+
+// keyValue 将键值对添加到 table，点分键的中间部分创建为嵌套的映射
+func (b *tomlBuilder) keyValue(table *yaml.Node, expr *unstable.Node) {
+	keys := expr.Key()
+	for keys.Next() {
+		key := keys.Node()
+		if !keys.IsLast() {
+			table = b.child(table, key, yaml.MappingNode)
+			continue
+		}
+		line, col := b.position(key)
+		value := b.value(expr.Value(), line, col)
+		table.Content = append(table.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(key.Data), Line: line, Column: col}, value)
+	}
+}
+
+// child 返回 table 中 key 对应的值，不存在时创建 kind 类型的节点
+func (b *tomlBuilder) child(table *yaml.Node, key *unstable.Node, kind yaml.Kind) *yaml.Node {
+	if i := mappingIndex(table, string(key.Data)); i >= 0 {
+		return table.Content[i+1]
+	}
+	line, col := b.position(key)
+	node := &yaml.Node{Kind: kind, Tag: "!!map", Line: line, Column: col}
+	if kind == yaml.SequenceNode {
+		node.Tag = "!!seq"
+	}
+	table.Content = append(table.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(key.Data), Line: line, Column: col}, node)
+	return node
+}
+
+// value 转换值节点，line 和 col 为值没有原文位置（如数组）时使用的位置
+func (b *tomlBuilder) value(n *unstable.Node, line, col int) *yaml.Node {
+	if l, c := b.position(n); l > 0 {
+		line, col = l, c
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line, Column: col}
+	data := string(n.Data)
+	switch n.Kind {
+	case unstable.String:
+		node.Tag, node.Value = "!!str", data
+	case unstable.Bool:
+		node.Tag, node.Value = "!!bool", data
+	case unstable.Integer:
+		// 十六进制、八进制和二进制转换为十进制
+		v, _ := strconv.ParseInt(strings.ReplaceAll(data, "_", ""), 0, 64)
+		node.Tag, node.Value = "!!int", strconv.FormatInt(v, 10)
+	case unstable.Float:
+		node.Tag, node.Value = "!!float", tomlFloat(data)
+	case unstable.Array:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		it := n.Children()
+		for it.Next() {
+			node.Content = append(node.Content, b.value(it.Node(), line, col))
+		}
+	case unstable.InlineTable:
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		it := n.Children()
+		for it.Next() {
+			b.keyValue(node, it.Node())
+		}
+	default:
+		// 日期、时间和日期时间
+		node.Tag, node.Value = "!!str", data
+	}
+	return node
+}
+
+// tomlFloat 返回 TOML 浮点数在 YAML 中对应的文本
+func tomlFloat(s string) string {
+	switch strings.TrimPrefix(s, "+") {
+	case "inf":
+		return ".inf"
+	case "-inf":
+		return "-.inf"
+	case "nan", "-nan":
+		return ".nan"
+	}
+	return strings.ReplaceAll(s, "_", "")
+}
+
+// offsetPosition 返回字节偏移量所在的行号和列号（按字符计算），均从 1 开始
+func offsetPosition(content []byte, offset int) (int, int) {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := bytes.Count(content[:offset], []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(content[:offset], '\n') + 1
+	return line, utf8.RuneCount(content[lineStart:offset]) + 1
+}
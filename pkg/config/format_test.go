@@ -0,0 +1,244 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestParseConfigFormats 测试 JSON 和 TOML 配置与 YAML 配置解析结果相同
+func TestParseConfigFormats(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"build.yaml": `from:
+  image: alpine:3.19
+  platforms: [linux/amd64, {os: linux, architecture: arm64}]
+to: ${REGISTRY}/app:v1
+creationTime: 2000
+environment:
+  LOG_LEVEL: debug
+layers:
+  properties:
+    filePermissions: "644"
+  entries:
+    - name: app
+      files:
+        - src: bin
+          dest: /app/bin
+`,
+		"build.json": `{
+  "from": {"image": "alpine:3.19", "platforms": ["linux/amd64", {"os": "linux", "architecture": "arm64"}]},
+  "to": "${REGISTRY}/app:v1",
+  "creationTime": 2000,
+  "environment": {"LOG_LEVEL": "debug"},
+  "layers": {
+    "properties": {"filePermissions": "644"},
+    "entries": [{"name": "app", "files": [{"src": "bin", "dest": "/app/bin"}]}]
+  }
+}
+`,
+		"build.toml": `to = "${REGISTRY}/app:v1"
+creationTime = 2000
+
+[from]
+image = "alpine:3.19"
+platforms = ["linux/amd64", { os = "linux", architecture = "arm64" }]
+
+[environment]
+LOG_LEVEL = "debug"
+
+[layers.properties]
+filePermissions = "644"
+
+[[layers.entries]]
+name = "app"
+
+[[layers.entries.files]]
+src = "bin"
+dest = "/app/bin"
+`,
+	})
+	pool := map[string]string{"REGISTRY": "reg.example.com"}
+
+	expected, err := ParseConfig(filepath.Join(dir, "build.yaml"), pool)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected.To.Repository != "reg.example.com/app" {
+		t.Fatalf("Expected to to be parsed from the string form, got %+v", expected.To)
+	}
+	for _, name := range []string{"build.json", "build.toml"} {
+		cfg, err := ParseConfig(filepath.Join(dir, name), pool)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("%s: expected %+v, got %+v", name, expected, cfg)
+		}
+	}
+}
+
+// TestParseTOML 测试 TOML 的各种写法
+func TestParseTOML(t *testing.T) {
+	root, err := parseTOMLNode([]byte(`# comment
+int = 1_000
+hex = 0xff
+float = 1.5e3
+bool = true
+date = 1979-05-27 07:32:00Z
+literal = 'C:\path'
+basic = "tab\there \u00e9"
+multi = """
+a \
+  b"""
+raw = '''
+line'''
+a.b.c = "dotted"
+"quoted key" = 1
+arr = [
+  1,
+  2, # comment
+]
+inline = { x = 1, y.z = 2 }
+
+[table."sub table"]
+k = "v"
+
+[[list]]
+n = 1
+[list.sub]
+m = 1
+[[list]]
+n = 2
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := root.Decode(&got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"int":        1000,
+		"hex":        255,
+		"float":      1500.0,
+		"bool":       true,
+		"date":       "1979-05-27 07:32:00Z",
+		"literal":    `C:\path`,
+		"basic":      "tab\there é",
+		"multi":      "a b",
+		"raw":        "line",
+		"a":          map[string]interface{}{"b": map[string]interface{}{"c": "dotted"}},
+		"quoted key": 1,
+		"arr":        []interface{}{1, 2},
+		"inline":     map[string]interface{}{"x": 1, "y": map[string]interface{}{"z": 2}},
+		"table":      map[string]interface{}{"sub table": map[string]interface{}{"k": "v"}},
+		"list": []interface{}{
+			map[string]interface{}{"n": 1, "sub": map[string]interface{}{"m": 1}},
+			map[string]interface{}{"n": 2},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// 节点保留位置
+	if key := root.Content[mappingIndex(root, "bool")]; key.Line != 5 || key.Column != 1 {
+		t.Errorf("Expected bool at 5:1, got %d:%d", key.Line, key.Column)
+	}
+	for _, tt := range []struct {
+		key       string
+		line, col int
+	}{{"bool", 5, 8}, {"date", 6, 8}, {"basic", 8, 9}} {
+		if v := child(root, tt.key); v.Line != tt.line || v.Column != tt.col {
+			t.Errorf("Expected %s value at %d:%d, got %d:%d", tt.key, tt.line, tt.col, v.Line, v.Column)
+		}
+	}
+}
+
+// TestParseTOMLNestedArrayTables 测试表数组中嵌套的表数组属于最近的元素
+func TestParseTOMLNestedArrayTables(t *testing.T) {
+	root, err := parseTOMLNode([]byte(`[[a]]
+x = 1
+[[a.b]]
+y = 1
+[[a]]
+x = 2
+[[a.b]]
+y = 2
+[[a.b]]
+y = 3
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := root.Decode(&got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"a": []interface{}{
+		map[string]interface{}{"x": 1, "b": []interface{}{map[string]interface{}{"y": 1}}},
+		map[string]interface{}{"x": 2, "b": []interface{}{map[string]interface{}{"y": 2}, map[string]interface{}{"y": 3}}},
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestParseTOMLErrors 测试 TOML 错误的信息，语法错误带有位置
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		msg     string
+	}{
+		{"a = 1\na = 2\n", "key a is already defined"},
+		{"[t]\n[t]\n", "table t already exists"},
+		{"a = \"x\n", "line 1, column 7: basic strings cannot have new lines"},
+		{"a = 1 b = 2\n", "line 1, column 7: expected newline but got U+0062 'b'"},
+		{"a = [1, 2\n", "line 2, column 1: expected character ] but the document ended here"},
+		{"a = nope\n", "line 1, column 5: expected 'nan'"},
+		{"a = 017\n", "line 1, column 6: expected newline but got U+0031 '1'"},
+		{"a = { b = 1 }\n[a]\n", "key a should be a table, not a value"},
+		{"a = \"\\q\"\n", "line 1, column 7: invalid escaped character U+0071 'q'"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOMLNode([]byte(tt.content))
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("Expected error %q for %q, got %v", tt.msg, tt.content, err)
+		}
+	}
+}
+
+// TestParseDocumentJSON 测试 JSON 配置按 JSON 检查语法并保留位置
+func TestParseDocumentJSON(t *testing.T) {
+	_, err := parseDocument([]byte("{\"a\": 1,\n  // comment\n}"), FormatJSON)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2, column 3: ") {
+		t.Errorf("Expected syntax error at line 2, column 3, got %v", err)
+	}
+
+	root, err := parseDocument([]byte("{\n  \"a\": {\"b\": true}\n}"), FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b := child(child(root, "a"), "b")
+	if b == nil || b.Tag != "!!bool" || b.Line != 2 || b.Column != 14 {
+		t.Errorf("Expected bool at 2:14, got %+v", b)
+	}
+	if root.Kind != yaml.MappingNode {
+		t.Errorf("Expected mapping, got %v", root.Kind)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		format Format
+	}{{"a.json", FormatJSON}, {"a.TOML", FormatTOML}, {"a.yml", FormatYAML}, {"a", FormatYAML}} {
+		if f := DetectFormat(tt.path); f != tt.format {
+			t.Errorf("Expected %s for %s, got %s", tt.format, tt.path, f)
+		}
+	}
+	if _, err := ParseFormat("ini"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
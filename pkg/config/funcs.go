@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/git"
+)
+
+// unavailableError 表示模板函数当前没有值（如 HEAD 上没有 tag），按未定义变量处理，
+// 因此可以使用 ${git.tag:-dev} 这样的默认值
+type unavailableError struct {
+	reason string
+}
+
+// Error 实现了 error 接口
+func (e *unavailableError) Error() string {
+	return e.reason
+}
+
+// IsTemplateFunc 判断 name 是否为模板函数（不计算函数的值）
+func IsTemplateFunc(name string) bool {
+	fn, _, hasArg := strings.Cut(name, ":")
+	switch fn {
+	case "git.sha", "git.shortSha", "git.branch", "git.tag":
+		return !hasArg
+	case "date", "env", "file", "sha256file":
+		return hasArg
+	}
+	return false
+}
+
+// localFuncs 为读取本地文件或环境变量的模板函数，受限的 oci:// 模板中不能使用
+var localFuncs = map[string]bool{"env": true, "file": true, "sha256file": true}
+
+// callFunc 计算模板函数的值，name 不是模板函数时 ok 为 false。支持的函数：
+//
+//	git.sha、git.shortSha、git.branch、git.tag  当前目录所在 git 仓库的信息
+//	date:LAYOUT        当前时间，LAYOUT 为 Go 时间格式，如 date:2006.01.02
+//	env:NAME           环境变量
+//	file:PATH          文件内容（去掉末尾换行）
+//	sha256file:PATH    文件内容的 SHA-256（十六进制）
+func callFunc(name string, now time.Time) (val string, ok bool, err error) {
+	fn, arg, hasArg := strings.Cut(name, ":")
+	switch {
+	case strings.HasPrefix(fn, "git.") && !hasArg:
+		val, ok, err = callGit(fn)
+	case fn == "date" && hasArg:
+		val, ok = now.Format(arg), true
+	case fn == "env" && hasArg:
+		v, found := os.LookupEnv(arg)
+		if !found {
+			return "", true, &unavailableError{reason: fmt.Sprintf("environment variable %s is not set", arg)}
+		}
+		val, ok = v, true
+	case fn == "file" && hasArg:
+		content, readErr := os.ReadFile(arg)
+		if readErr != nil {
+			return "", true, readErr
+		}
+		val, ok = strings.TrimRight(string(content), "\r\n"), true
+	case fn == "sha256file" && hasArg:
+		content, readErr := os.ReadFile(arg)
+		if readErr != nil {
+			return "", true, readErr
+		}
+		sum := sha256.Sum256(content)
+		val, ok = hex.EncodeToString(sum[:]), true
+	}
+	return val, ok, err
+}
+
+// callGit 计算 git.* 函数的值
+func callGit(fn string) (string, bool, error) {
+	switch fn {
+	case "git.sha", "git.shortSha", "git.branch", "git.tag":
+	default:
+		return "", false, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", true, err
+	}
+	repo, err := git.Open(wd)
+	if err != nil {
+		return "", true, &unavailableError{reason: err.Error()}
+	}
+
+	switch fn {
+	case "git.sha", "git.shortSha":
+		sha, err := repo.Head()
+		if err != nil {
+			return "", true, &unavailableError{reason: err.Error()}
+		}
+		if fn == "git.shortSha" {
+			sha = sha[:7]
+		}
+		return sha, true, nil
+	case "git.branch":
+		branch := repo.Branch()
+		if branch == "" {
+			return "", true, &unavailableError{reason: "HEAD is detached"}
+		}
+		return branch, true, nil
+	default: // git.tag
+		tag, err := repo.Tag()
+		if err != nil {
+			return "", true, &unavailableError{reason: err.Error()}
+		}
+		return tag, true, nil
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// 健康检查命令的类型，即 test 的第一个元素
+const (
+	HealthcheckNone     = "NONE"
+	HealthcheckCmd      = "CMD"
+	HealthcheckCmdShell = "CMD-SHELL"
+)
+
+// HealthcheckConfig 定义了容器的健康检查，与 Dockerfile 的 HEALTHCHECK 对应。
+// 时间为 Go 的时长格式，如 30s、1m30s，未设置时由容器运行时使用默认值
+type HealthcheckConfig struct {
+	// Test 为检查命令：[NONE] 禁用基础镜像的健康检查，[CMD, 程序, 参数...] 直接执行，
+	// [CMD-SHELL, 命令] 通过默认 shell 执行
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval"`
+	Timeout     string   `yaml:"timeout"`
+	StartPeriod string   `yaml:"startPeriod"`
+	Retries     int      `yaml:"retries"`
+}
+
+// HealthConfig 将健康检查转换为镜像配置中的 HealthConfig
+func (h *HealthcheckConfig) HealthConfig() (*v1.HealthConfig, error) {
+	if err := checkHealthcheckTest(h.Test); err != nil {
+		return nil, err
+	}
+	if h.Retries < 0 {
+		return nil, fmt.Errorf("invalid healthcheck retries %d, must not be negative", h.Retries)
+	}
+	hc := &v1.HealthConfig{Test: h.Test, Retries: h.Retries}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"interval", h.Interval, &hc.Interval},
+		{"timeout", h.Timeout, &hc.Timeout},
+		{"startPeriod", h.StartPeriod, &hc.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := parseHealthDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck %s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+	return hc, nil
+}
+
+// checkHealthcheckTest 检查健康检查命令的类型和参数个数
+func checkHealthcheckTest(test []string) error {
+	if len(test) == 0 {
+		return fmt.Errorf("healthcheck test is empty, expected [NONE], [CMD, ...] or [CMD-SHELL, command]")
+	}
+	switch test[0] {
+	case HealthcheckNone:
+		if len(test) != 1 {
+			return fmt.Errorf("healthcheck test %s takes no arguments", HealthcheckNone)
+		}
+	case HealthcheckCmd:
+		if len(test) < 2 {
+			return fmt.Errorf("healthcheck test %s requires a command", HealthcheckCmd)
+		}
+	case HealthcheckCmdShell:
+		if len(test) != 2 {
+			return fmt.Errorf("healthcheck test %s requires exactly one command string", HealthcheckCmdShell)
+		}
+	default:
+		return fmt.Errorf("invalid healthcheck test type %q, expected %s, %s or %s",
+			test[0], HealthcheckNone, HealthcheckCmd, HealthcheckCmdShell)
+	}
+	return nil
+}
+
+// parseHealthDuration 解析健康检查的时长，不能为负数
+func parseHealthDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected a value such as 30s or 1m30s", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q, must not be negative", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// TestHealthConfig 测试健康检查及相关字段的解析和转换
+func TestHealthConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"build.yaml": `from: {image: nginx}
+to: r/app:v1
+healthcheck:
+  test: [CMD-SHELL, "curl -f http://localhost/ || exit 1"]
+  interval: 30s
+  timeout: 5s
+  startPeriod: 1m30s
+  retries: 3
+stopSignal: SIGQUIT
+shell: [/bin/bash, -c]
+onBuild: ["RUN echo hello"]
+argsEscaped: true
+`,
+	})
+
+	cfg, err := ParseConfig(filepath.Join(dir, "build.yaml"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.StopSignal != "SIGQUIT" || !reflect.DeepEqual(cfg.Shell, []string{"/bin/bash", "-c"}) ||
+		!reflect.DeepEqual(cfg.OnBuild, []string{"RUN echo hello"}) || !cfg.ArgsEscaped {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	hc, err := cfg.Healthcheck.HealthConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &v1.HealthConfig{
+		Test:        []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"},
+		Interval:    30 * time.Second,
+		Timeout:     5 * time.Second,
+		StartPeriod: 90 * time.Second,
+		Retries:     3,
+	}
+	if !reflect.DeepEqual(hc, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, hc)
+	}
+}
+
+// TestHealthConfigErrors 测试无效的健康检查
+func TestHealthConfigErrors(t *testing.T) {
+	tests := []struct {
+		hc  HealthcheckConfig
+		msg string
+	}{
+		{HealthcheckConfig{}, "healthcheck test is empty"},
+		{HealthcheckConfig{Test: []string{"NONE", "x"}}, "takes no arguments"},
+		{HealthcheckConfig{Test: []string{"CMD"}}, "requires a command"},
+		{HealthcheckConfig{Test: []string{"NONE"}, Interval: "-1s"}, `invalid healthcheck interval: invalid duration "-1s", must not be negative`},
+		{HealthcheckConfig{Test: []string{"NONE"}, Retries: -1}, "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.hc.HealthConfig()
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Expected error containing %q for %+v, got %v", tt.msg, tt.hc, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NormalizePort 返回端口在镜像配置中的键，未指定协议时为 tcp，如 80 为 80/tcp
+func NormalizePort(port string) string {
+	p, proto, ok := strings.Cut(port, "/")
+	if !ok || proto == "" {
+		return p + "/tcp"
+	}
+	return p + "/" + strings.ToLower(proto)
+}
+
+// ExpandPort 检查端口格式（见 checkPort），返回规范化后的端口键，端口范围展开为每个端口，
+// 如 8000-8002/udp 为 8000/udp、8001/udp、8002/udp
+func ExpandPort(port string) ([]string, error) {
+	if err := checkPort(port); err != nil {
+		return nil, err
+	}
+	m := portPattern.FindStringSubmatch(port)
+	proto := strings.ToLower(m[3])
+	if proto == "" {
+		proto = "tcp"
+	}
+	start, _ := strconv.Atoi(m[1])
+	end := start
+	if m[2] != "" {
+		end, _ = strconv.Atoi(m[2])
+	}
+	keys := make([]string, 0, end-start+1)
+	for p := start; p <= end; p++ {
+		keys = append(keys, strconv.Itoa(p)+"/"+proto)
+	}
+	return keys, nil
+}
+
+// BuildPorts 按配置修改基础镜像暴露的端口，返回新的端口和 remove 中基础镜像没有的端口。
+// 所有端口（包括基础镜像中的）都规范化为 端口/协议 的形式，端口范围展开为每个端口；
+// 继承时配置文件中的端口合并到基础镜像的端口中，不继承时只使用配置文件中的端口
+func BuildPorts(base map[string]struct{}, cfg *Config) (map[string]struct{}, []string, error) {
+	ports := make(map[string]struct{})
+	if Inherits(cfg.Inherit.ExposedPorts, true) {
+		for port := range base {
+			ports[NormalizePort(port)] = struct{}{}
+		}
+	}
+
+	var missing []string
+	for _, port := range cfg.Remove.ExposedPorts {
+		keys, err := ExpandPort(port)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range keys {
+			if _, ok := ports[key]; !ok {
+				missing = append(missing, key)
+			}
+			delete(ports, key)
+		}
+	}
+
+	for _, port := range cfg.ExposedPorts {
+		keys, err := ExpandPort(port)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range keys {
+			ports[key] = struct{}{}
+		}
+	}
+	return ports, missing, nil
+}
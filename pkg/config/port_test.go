@@ -0,0 +1,73 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestExpandPort 测试端口的规范化和端口范围的展开
+func TestExpandPort(t *testing.T) {
+	tests := map[string][]string{
+		"456":           {"456/tcp"},
+		"53/UDP":        {"53/udp"},
+		"8000-8002/tcp": {"8000/tcp", "8001/tcp", "8002/tcp"},
+		"9000-9000":     {"9000/tcp"},
+	}
+	for port, expected := range tests {
+		keys, err := ExpandPort(port)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", port, err)
+			continue
+		}
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("ExpandPort(%q) = %v, expected %v", port, keys, expected)
+		}
+	}
+
+	for _, port := range []string{"http", "0", "10-5", "80/icmp"} {
+		if _, err := ExpandPort(port); err == nil {
+			t.Errorf("Expected error for %q", port)
+		}
+	}
+}
+
+// TestBuildPorts 测试端口合并到基础镜像的端口中，以及 remove 和 inherit
+func TestBuildPorts(t *testing.T) {
+	base := map[string]struct{}{"22": {}, "80/tcp": {}, "53/udp": {}}
+	tests := []struct {
+		config   string
+		expected []string
+		missing  []string
+	}{
+		{"exposedPorts: [\"8080-8081\"]\n", []string{"22/tcp", "53/udp", "80/tcp", "8080/tcp", "8081/tcp"}, nil},
+		{"exposedPorts: [\"443\"]\nremove: {exposedPorts: [\"22\", 52-53/udp]}\n", []string{"443/tcp", "80/tcp"}, []string{"52/udp"}},
+		{"exposedPorts: [\"443\"]\ninherit: {exposedPorts: false}\n", []string{"443/tcp"}, nil},
+		{"exposedPorts: [\"443\"]\ninherit: false\n", []string{"443/tcp"}, nil},
+		{"inherit: false\n", []string{}, nil},
+	}
+
+	for _, tt := range tests {
+		dir := writeConfigFiles(t, map[string]string{
+			"build.yaml": "from: {image: alpine}\nto: r/app:v1\n" + tt.config,
+		})
+		cfg, err := ParseConfig(filepath.Join(dir, "build.yaml"), nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ports, missing, err := BuildPorts(base, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := make(map[string]struct{})
+		for _, port := range tt.expected {
+			expected[port] = struct{}{}
+		}
+		if !reflect.DeepEqual(ports, expected) {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.config, ports)
+		}
+		if !reflect.DeepEqual(missing, tt.missing) {
+			t.Errorf("Expected missing %v for %q, got %v", tt.missing, tt.config, missing)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyProfiles 为配置中定义 profile 的键，应用 profile 后会从结果中移除
+const keyProfiles = "profiles"
+
+// ProfileOverride 记录一个 profile 覆盖或新增的字段（以 . 连接的路径，如 to.tags）
+type ProfileOverride struct {
+	Profile string
+	Fields  []string
+}
+
+// ApplyProfiles 从配置中移除 profiles，并按 names 的顺序将选中的 profile 合并到配置上，
+// 合并规则与 extends 相同（见 MergeNodes）。不修改 root，names 中有未定义的 profile 时返回错误
+func ApplyProfiles(root *yaml.Node, names []string) (*yaml.Node, []ProfileOverride, error) {
+	out := copyNode(root)
+	out.Content = append([]*yaml.Node{}, root.Content...)
+	profiles := takeKey(out, keyProfiles)
+	if profiles != nil && profiles.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("line %d: %s must be a mapping of profile names to overrides", profiles.Line, keyProfiles)
+	}
+
+	overrides := make([]ProfileOverride, 0, len(names))
+	for _, name := range names {
+		idx := -1
+		if profiles != nil {
+			idx = mappingIndex(profiles, name)
+		}
+		if idx < 0 {
+			return nil, nil, unknownProfile(name, profiles)
+		}
+
+		overlay := profiles.Content[idx+1]
+		if overlay.Tag == "!!null" {
+			// 空的 profile
+			overrides = append(overrides, ProfileOverride{Profile: name})
+			continue
+		}
+		if overlay.Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("line %d: profile %s must be a mapping", overlay.Line, name)
+		}
+		for _, key := range []string{keyProfiles, keyExtends, keyInclude} {
+			if i := mappingIndex(overlay, key); i >= 0 {
+				return nil, nil, fmt.Errorf("line %d: %s is not allowed in profile %s", overlay.Content[i].Line, key, name)
+			}
+		}
+
+		var changed []string
+		out = mergeNodes(out, overlay, "", &changed)
+		overrides = append(overrides, ProfileOverride{Profile: name, Fields: changed})
+	}
+	return out, overrides, nil
+}
+
+// unknownProfile 返回未定义 profile 的错误，列出已定义的 profile 并给出相近的名称
+func unknownProfile(name string, profiles *yaml.Node) error {
+	if profiles == nil || len(profiles.Content) == 0 {
+		return fmt.Errorf("unknown profile %q: no profiles are defined", name)
+	}
+	available := make(map[string]string)
+	names := make([]string, 0, len(profiles.Content)/2)
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		available[profiles.Content[i].Value] = ""
+		names = append(names, profiles.Content[i].Value)
+	}
+	sort.Strings(names)
+	msg := fmt.Sprintf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	if s := suggest(name, available); s != "" {
+		msg += fmt.Sprintf(", did you mean %q?", s)
+	}
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RegistryConfig 定义了单个镜像仓库的连接配置
+type RegistryConfig struct {
+	// Insecure 跳过 TLS 证书校验，并允许回退到 HTTP
+	Insecure bool `yaml:"insecure"`
+	// PlainHTTP 允许使用 HTTP 访问该仓库，但仍校验 HTTPS 证书
+	PlainHTTP bool `yaml:"plainHttp"`
+	// CACerts 额外信任的 CA 证书文件（PEM 格式），在系统证书之外追加
+	CACerts []string `yaml:"caCerts"`
+	// ClientCert 双向 TLS 使用的客户端证书文件（PEM 格式）
+	ClientCert string `yaml:"clientCert"`
+	// ClientKey 双向 TLS 使用的客户端私钥文件（PEM 格式）
+	ClientKey string `yaml:"clientKey"`
+	// Proxy 访问该仓库使用的代理，设置后替代全局代理配置
+	Proxy *ProxyConfig `yaml:"proxy"`
+}
+
+// ProxyConfig 定义了 HTTP(S) 代理配置
+type ProxyConfig struct {
+	// HTTP 用于 HTTP 请求的代理地址，如 http://proxy.example.com:3128
+	HTTP string `yaml:"http"`
+	// HTTPS 用于 HTTPS 请求的代理地址，未设置时使用 HTTP
+	HTTPS string `yaml:"https"`
+	// NoProxy 不使用代理的主机，支持域名后缀（.example.com、*.example.com）、IP、CIDR 和 *
+	NoProxy []string `yaml:"noProxy"`
+	// Username 代理认证用户名
+	Username string `yaml:"username"`
+	// Password 代理认证密码
+	Password string `yaml:"password"`
+}
+
+// IsZero 判断代理配置是否为空
+func (p ProxyConfig) IsZero() bool {
+	return p.HTTP == "" && p.HTTPS == "" && len(p.NoProxy) == 0
+}
+
+// RegistriesFile 定义了 --registry-config 指定的仓库配置文件结构
+type RegistriesFile struct {
+	Proxy      ProxyConfig               `yaml:"proxy"`
+	Registries map[string]RegistryConfig `yaml:"registries"`
+}
+
+// Merge 合并两个仓库配置，override 中设置的字段优先级更高
+func (r RegistryConfig) Merge(override RegistryConfig) RegistryConfig {
+	result := r
+
+	if override.Insecure {
+		result.Insecure = true
+	}
+	if override.PlainHTTP {
+		result.PlainHTTP = true
+	}
+	if len(override.CACerts) > 0 {
+		result.CACerts = append(append([]string{}, r.CACerts...), override.CACerts...)
+	}
+	if override.ClientCert != "" {
+		result.ClientCert = override.ClientCert
+	}
+	if override.ClientKey != "" {
+		result.ClientKey = override.ClientKey
+	}
+	if override.Proxy != nil {
+		result.Proxy = override.Proxy
+	}
+
+	return result
+}
+
+// Validate 检查仓库配置是否完整
+func (r RegistryConfig) Validate() error {
+	if (r.ClientCert == "") != (r.ClientKey == "") {
+		return fmt.Errorf("clientCert and clientKey must be set together")
+	}
+	return nil
+}
+
+// MergeRegistries 按仓库地址合并两组仓库配置，override 优先级更高
+func MergeRegistries(base, override map[string]RegistryConfig) map[string]RegistryConfig {
+	result := make(map[string]RegistryConfig, len(base)+len(override))
+	for host, rc := range base {
+		result[host] = rc
+	}
+	for host, rc := range override {
+		result[host] = result[host].Merge(rc)
+	}
+	return result
+}
+
+// LoadRegistries 从 YAML 文件中加载仓库配置
+func LoadRegistries(path string) (*RegistriesFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry config %s: %w", path, err)
+	}
+
+	var file RegistriesFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse registry config %s: %w", path, err)
+	}
+
+	for host, rc := range file.Registries {
+		if err := rc.Validate(); err != nil {
+			return nil, fmt.Errorf("registry %s: %w", host, err)
+		}
+	}
+
+	return &file, nil
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// varPattern 匹配包含变量引用的值，变量替换前无法检查这类值的格式
+const varPattern = `\$\{`
+
+// Schema 返回 apiVersion 对应的构建配置文件的 JSON Schema（draft-07），由 Config 的结构生成，
+// 可用于编辑器（如 yaml-language-server）的补全和检查。
+//
+// Schema 描述的是变量替换前的源文件：包含 ${...} 的值不检查格式，
+// 也包含 extends、include 和 profiles；合并后才能确定的必填字段（如 from.image）不在其中
+func Schema(apiVersion string) (map[string]interface{}, error) {
+	if apiVersion != APIVersionV1Alpha1 {
+		return nil, fmt.Errorf("unsupported apiVersion %q, expected %q", apiVersion, APIVersionV1Alpha1)
+	}
+
+	root := schemaFor(reflect.TypeOf(Config{}), "")
+	props := root["properties"].(map[string]interface{})
+
+	// profile 的结构与配置文件相同，但不能再包含 profiles、extends 和 include
+	profile := map[string]interface{}{
+		"type":                 "object",
+		"properties":           copySchema(props),
+		"additionalProperties": false,
+	}
+	props[keyExtends] = map[string]interface{}{
+		"type":        "string",
+		"description": "Build file to merge before this one, relative to this file",
+	}
+	props[keyInclude] = map[string]interface{}{
+		"description": "Build files to merge after extends and before this one, relative to this file",
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+	props[keyProfiles] = map[string]interface{}{
+		"type":                 "object",
+		"description":          "Named overlays selected with --profile",
+		"additionalProperties": map[string]interface{}{"$ref": "#/definitions/profile"},
+	}
+
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = fmt.Sprintf("crane-jib-tool build file (%s)", apiVersion)
+	root["definitions"] = map[string]interface{}{"profile": profile}
+	return root, nil
+}
+
+// schemaConstraints 为按路径附加到生成结果上的约束，列表元素的路径以 [] 结尾
+var schemaConstraints = map[string]map[string]interface{}{
+	"apiVersion":                    {"enum": []interface{}{APIVersionV1Alpha1}},
+	"kind":                          {"enum": []interface{}{KindBuildFile}},
+	"exposedPorts[]":                {"pattern": portPattern.String() + "|" + varPattern},
+	"stopSignal":                    {"pattern": stopSignalPattern.String() + "|" + varPattern},
+	"healthcheck":                   {"required": []interface{}{"test"}},
+	"annotations.platforms":         {"propertyNames": map[string]interface{}{"pattern": platformPattern.String()}},
+	"healthcheck.test":              {"minItems": 1},
+	"healthcheck.test[]":            {"type": "string"},
+	"healthcheck.interval":          {"pattern": durationPattern},
+	"healthcheck.timeout":           {"pattern": durationPattern},
+	"healthcheck.startPeriod":       {"pattern": durationPattern},
+	"layers.entries[].files[]":      {"required": []interface{}{"src", "dest"}},
+	"layers.entries[].files[].dest": {"pattern": "^/|" + varPattern},
+}
+
+// durationPattern 匹配 Go 的时长格式，如 30s、1m30s
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|` + varPattern
+
+// scalarForms 为自定义解析的结构体类型可以使用的标量形式
+var scalarForms = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(Tag{}):           {"type": "string", "pattern": "^.+:[^:/]+$|" + varPattern},
+	reflect.TypeOf(InheritConfig{}): {"type": "boolean"},
+}
+
+// platformSchema 为 from.platforms 中的元素：os/architecture[/variant] 字符串或映射
+var platformSchema = map[string]interface{}{
+	"anyOf": []interface{}{
+		map[string]interface{}{"type": "string", "pattern": platformPattern.String() + "|" + varPattern},
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"os":           map[string]interface{}{"type": "string"},
+				"architecture": map[string]interface{}{"type": "string"},
+				"variant":      map[string]interface{}{"type": "string"},
+			},
+			"required":             []interface{}{"os", "architecture"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// schemaFor 生成类型 t 的 JSON Schema，path 为以 . 连接的字段路径
+func schemaFor(t reflect.Type, path string) map[string]interface{} {
+	if path == "from.platforms[]" {
+		return copySchema(platformSchema)
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var s map[string]interface{}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := yamlFields(t)
+		props := make(map[string]interface{}, len(fields))
+		for name, field := range fields {
+			props[name] = schemaFor(field, joinKey(path, name))
+		}
+		s = map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		// 自定义解析的类型同时接受标量形式，如 to 的 image:tag 和 inherit 的 true/false
+		if scalar, ok := scalarForms[t]; ok {
+			s = map[string]interface{}{
+				"anyOf": []interface{}{copySchema(scalar), s},
+			}
+		}
+	case reflect.Map:
+		s = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem(), path+".*"),
+		}
+	case reflect.Slice:
+		s = map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(t.Elem(), path+"[]"),
+		}
+	case reflect.Interface:
+		s = map[string]interface{}{}
+	case reflect.Bool:
+		s = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "boolean"},
+				map[string]interface{}{"type": "string", "pattern": varPattern},
+			},
+		}
+	case reflect.Int:
+		s = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "integer"},
+				map[string]interface{}{"type": "string", "pattern": varPattern},
+			},
+		}
+	default:
+		// YAML 中未加引号的数字（如 filePermissions: 644）同样可以解析为字符串
+		s = map[string]interface{}{"type": []interface{}{"string", "number", "boolean"}}
+	}
+
+	for k, v := range schemaConstraints[path] {
+		s[k] = v
+	}
+	switch lastKey(path) {
+	case "filePermissions", "directoryPermissions":
+		s["pattern"] = permissionsPattern.String() + "|" + varPattern
+	}
+	return s
+}
+
+// lastKey 返回路径的最后一个键
+func lastKey(path string) string {
+	return path[strings.LastIndex(path, ".")+1:]
+}
+
+// copySchema 深拷贝 schema 中的映射，避免多处引用同一个对象
+func copySchema(s map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copySchema(m)
+		}
+		out[k] = v
+	}
+	return out
+}
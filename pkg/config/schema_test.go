@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+// TestSchema 测试生成的 JSON Schema 覆盖配置结构及字符串/映射两种写法
+func TestSchema(t *testing.T) {
+	schema, err := Schema(APIVersionV1Alpha1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 通过 JSON 往返，按生成的文档检查
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	get := func(v interface{}, keys ...string) interface{} {
+		for _, key := range keys {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected object at %v", keys)
+			}
+			v = m[key]
+		}
+		return v
+	}
+
+	props := get(doc, "properties").(map[string]interface{})
+	for _, key := range []string{"apiVersion", "kind", "from", "to", "workingDirectory", "layers", "registries", "extends", "include", "profiles"} {
+		if _, ok := props[key]; !ok {
+			t.Errorf("Expected property %s in schema", key)
+		}
+	}
+	if get(doc, "additionalProperties") != false {
+		t.Error("Expected unknown top level fields to be rejected")
+	}
+
+	// to 接受 image:tag 字符串或映射
+	to := get(props, "to", "anyOf").([]interface{})
+	if len(to) != 2 || get(to[0], "type") != "string" || get(to[1], "properties", "tags", "type") != "array" {
+		t.Errorf("Expected to to accept a string or a mapping, got %v", to)
+	}
+
+	// from.platforms 的元素接受 os/arch 字符串或映射
+	platform := get(props, "from", "properties", "platforms", "items", "anyOf").([]interface{})
+	pattern := regexp.MustCompile(get(platform[0], "pattern").(string))
+	if !pattern.MatchString("linux/arm64/v8") || pattern.MatchString("linux") {
+		t.Errorf("Unexpected platform pattern %s", pattern)
+	}
+	if get(platform[1], "properties", "architecture", "type") != "string" {
+		t.Errorf("Expected platform mapping with architecture, got %v", platform[1])
+	}
+
+	dest := get(props, "layers", "properties", "entries", "items", "properties", "files", "items", "properties", "dest", "pattern").(string)
+	if re := regexp.MustCompile(dest); !re.MatchString("/app") || !re.MatchString("${DEST}") || re.MatchString("app") {
+		t.Errorf("Unexpected dest pattern %s", dest)
+	}
+
+	// inherit 接受布尔值或映射
+	if inherit := get(props, "inherit", "anyOf").([]interface{}); get(inherit[0], "type") != "boolean" || get(inherit[1], "properties", "cmd") == nil {
+		t.Errorf("Expected inherit to accept a boolean or a mapping, got %v", inherit)
+	}
+
+	// healthcheck 的时长和重试次数
+	healthcheck := get(props, "healthcheck", "properties").(map[string]interface{})
+	interval := regexp.MustCompile(get(healthcheck, "interval", "pattern").(string))
+	if !interval.MatchString("1m30s") || interval.MatchString("30") {
+		t.Errorf("Unexpected interval pattern %s", interval)
+	}
+	if retries := get(healthcheck, "retries", "anyOf").([]interface{}); get(retries[0], "type") != "integer" {
+		t.Errorf("Expected retries to be an integer, got %v", retries)
+	}
+
+	// profile 中不能再定义 profiles
+	if _, ok := get(doc, "definitions", "profile", "properties").(map[string]interface{})["profiles"]; ok {
+		t.Error("Expected profiles to be absent from the profile definition")
+	}
+
+	if _, err := Schema("jib/v2"); err == nil {
+		t.Error("Expected error for unsupported apiVersion")
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// StdinPath 作为配置文件路径时表示从标准输入读取
+	StdinPath = "-"
+	// OCIPrefix 为存放在镜像仓库中的配置模板的前缀，如 oci://registry.example.com/templates/java:1.2
+	OCIPrefix = "oci://"
+)
+
+// LoadOptions 控制配置文件的读取方式
+type LoadOptions struct {
+	// Format 为顶层配置文件的格式，为空时按扩展名识别；引用的文件总是按扩展名识别
+	Format Format
+	// Stdin 为配置文件路径是 - 时读取的内容，为 nil 时不支持从标准输入读取
+	Stdin io.Reader
+	// Fetch 拉取 oci:// 引用（不含前缀）指向的配置模板，返回内容和文件名（用于识别格式），
+	// 为 nil 时不支持 oci:// 引用
+	Fetch func(ref string) ([]byte, string, error)
+	// TrustTemplates 为 true 时 oci:// 模板与本地配置文件一样不受限制，
+	// 否则模板不能读取本地文件和环境变量，见 restricted
+	TrustTemplates bool
+	// VarSources 为变量池中每个变量的来源（见 BuildVarPoolWithSources），用于区分来自环境变量的变量，
+	// 为 nil 时变量池中的变量都视为不是环境变量
+	VarSources map[string]string
+}
+
+// restricted 判断 path 指向的配置文件是否受限。未设置 TrustTemplates 时 oci:// 模板：
+//
+//   - 不能使用读取本地文件和环境变量的模板函数（env、file、sha256file），
+//     变量池中来自环境变量的变量（见 VarSources）按未定义处理
+//   - extends/include 只能引用 oci:// 模板
+//   - 不能设置层的 src、仓库的证书文件（caCerts、clientCert、clientKey），
+//     以及代理和跳过 TLS 校验的字段（proxy、insecure、plainHttp），见 checkTemplate
+func (o LoadOptions) restricted(path string) bool {
+	return !o.TrustTemplates && strings.HasPrefix(path, OCIPrefix)
+}
+
+// read 读取配置文件内容，返回内容和用于识别格式的文件名；from 为引用它的文件，顶层文件为空
+func (o LoadOptions) read(path, from string) ([]byte, string, error) {
+	switch {
+	case path == StdinPath:
+		if o.Stdin == nil {
+			return nil, "", errors.New("reading the config file from stdin is not supported here")
+		}
+		content, err := io.ReadAll(o.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read config file from stdin: %w", err)
+		}
+		return content, "", nil
+	case strings.HasPrefix(path, OCIPrefix):
+		if o.Fetch == nil {
+			return nil, "", fmt.Errorf("cannot load %s: oci:// config templates are not supported here", path)
+		}
+		return o.Fetch(strings.TrimPrefix(path, OCIPrefix))
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if from != "" {
+			return nil, "", fmt.Errorf("config file %s (referenced from %s) does not exist", path, displayPath(from))
+		}
+		return nil, "", fmt.Errorf("config file %s does not exist", path)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	return content, path, nil
+}
+
+// format 返回配置文件的格式：顶层文件（from 为空）优先使用 Format，否则按文件名的扩展名识别
+func (o LoadOptions) format(name, from string) Format {
+	if from == "" && o.Format != "" {
+		return o.Format
+	}
+	return DetectFormat(name)
+}
+
+// resolvePath 返回 from 中引用的 parent 的路径：oci:// 引用和绝对路径原样使用，
+// 相对路径相对于 from 所在目录，from 为标准输入时相对于当前目录。
+// oci:// 模板中只能使用 oci:// 引用或绝对路径，模板受限时只能使用 oci:// 引用
+func (o LoadOptions) resolvePath(parent, from string) (string, error) {
+	switch {
+	case parent == StdinPath:
+		return "", fmt.Errorf("%s: stdin can only be used as the top-level config file", displayPath(from))
+	case strings.HasPrefix(parent, OCIPrefix):
+		return parent, nil
+	case o.restricted(from):
+		return "", fmt.Errorf("%s: local file %s cannot be referenced from an oci:// config template, use an oci:// reference or --trust-templates", from, parent)
+	case filepath.IsAbs(parent):
+		return parent, nil
+	case strings.HasPrefix(from, OCIPrefix):
+		return "", fmt.Errorf("%s: relative path %s cannot be resolved in an oci:// config template, use an oci:// reference", from, parent)
+	case from == StdinPath:
+		return parent, nil
+	}
+	return filepath.Join(filepath.Dir(from), parent), nil
+}
+
+// templateFields 为受限的 oci:// 模板中不能设置的顶层字段，它们会改变访问镜像仓库的方式
+var templateFields = []string{"insecure", "proxy"}
+
+// templateRegistryFields 为受限的 oci:// 模板中不能为仓库设置的字段：
+// 证书文件指向本地文件，其余字段会降低 TLS 安全性或把请求发往模板指定的代理
+var templateRegistryFields = []string{"caCerts", "clientCert", "clientKey", "insecure", "plainHttp", "proxy"}
+
+// checkTemplate 检查受限的 oci:// 模板中（包括其中的 profile）没有指向本地文件
+// 或改变访问镜像仓库方式的字段
+func checkTemplate(root *yaml.Node, path string) error {
+	bodies := []*yaml.Node{root}
+	if profiles := child(root, keyProfiles); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			bodies = append(bodies, profiles.Content[i])
+		}
+	}
+	for _, body := range bodies {
+		for _, entry := range items(child(child(body, "layers"), "entries")) {
+			for _, file := range items(child(entry, "files")) {
+				if src := child(file, "src"); src != nil {
+					return fmt.Errorf("%s: line %d: layer files cannot be set in an oci:// config template, set them in a local config file or use --trust-templates", path, src.Line)
+				}
+			}
+		}
+		for _, key := range templateFields {
+			if n := child(body, key); n != nil {
+				return fmt.Errorf("%s: line %d: %s cannot be set in an oci:// config template, set it in a local config file or use --trust-templates", path, n.Line, key)
+			}
+		}
+		registries := child(body, "registries")
+		if registries == nil || registries.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(registries.Content); i += 2 {
+			for _, key := range templateRegistryFields {
+				if n := child(registries.Content[i], key); n != nil {
+					return fmt.Errorf("%s: line %d: %s cannot be set in an oci:// config template, set it in a local config file or use --trust-templates", path, n.Line, key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sourceKey 返回用于识别同一个配置文件的键：本地文件为绝对路径，其他为原始路径
+func sourceKey(path string) (string, error) {
+	if path == StdinPath || strings.HasPrefix(path, OCIPrefix) {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// BaseDir 返回 build-all 中配置文件里相对路径（如层的 src）的基准目录：本地文件为所在目录的绝对路径，
+// 标准输入和 oci:// 模板没有所在目录，使用当前目录
+func BaseDir(path string) (string, error) {
+	if path == StdinPath || strings.HasPrefix(path, OCIPrefix) {
+		return os.Getwd()
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(abs), nil
+}
+
+// displayPath 返回错误信息中使用的配置文件名称
+func displayPath(path string) string {
+	if path == StdinPath {
+		return "<stdin>"
+	}
+	return path
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// TestLoadConfigNodeSources 测试从标准输入和 oci:// 模板读取配置
+func TestLoadConfigNodeSources(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"local.yaml": "labels: {local: \"yes\"}\n",
+	})
+	templates := map[string]string{
+		"reg.example.com/templates/base:1":   "from: {image: alpine}\nlabels: {tier: base}\ninclude: oci://reg.example.com/templates/common:1\n",
+		"reg.example.com/templates/common:1": `{"labels": {"owner": "ops"}}`,
+	}
+	var fetched []string
+	opts := LoadOptions{
+		Stdin: strings.NewReader("extends: oci://reg.example.com/templates/base:1\ninclude: " + filepath.Join(dir, "local.yaml") + "\nto: ${REGISTRY}/app:v1\n"),
+		Fetch: func(ref string) ([]byte, string, error) {
+			fetched = append(fetched, ref)
+			content, ok := templates[ref]
+			if !ok {
+				return nil, "", errors.New("not found")
+			}
+			name := "build.yaml"
+			if strings.HasSuffix(ref, "common:1") {
+				name = "common.json"
+			}
+			return []byte(content), name, nil
+		},
+	}
+
+	node, sources, err := LoadConfigNodeWithSources(StdinPath, map[string]string{"REGISTRY": "reg.example.com"}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg, err := DecodeConfig(node, sources)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.From.Image != "alpine" || cfg.To.Repository != "reg.example.com/app" {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	expectedLabels := map[string]string{"tier": "base", "owner": "ops", "local": "yes"}
+	for k, v := range expectedLabels {
+		if cfg.Labels[k] != v {
+			t.Errorf("Expected label %s=%s, got %v", k, v, cfg.Labels)
+		}
+	}
+	if len(fetched) != 2 {
+		t.Errorf("Expected 2 templates to be fetched, got %v", fetched)
+	}
+	if f := sources.File(child(child(node, "labels"), "owner")); f != "oci://reg.example.com/templates/common:1" {
+		t.Errorf("Expected owner label to come from the common template, got %s", f)
+	}
+	if f := sources.File(child(node, "to")); f != "<stdin>" {
+		t.Errorf("Expected to to come from stdin, got %s", f)
+	}
+}
+
+// TestLoadConfigNodeSourceErrors 测试不支持的配置来源和 oci:// 模板中的相对路径
+func TestLoadConfigNodeSourceErrors(t *testing.T) {
+	fetch := func(ref string) ([]byte, string, error) {
+		return []byte("extends: base.yaml\n"), "build.yaml", nil
+	}
+	tests := []struct {
+		path string
+		opts LoadOptions
+		msg  string
+	}{
+		{StdinPath, LoadOptions{}, "stdin is not supported"},
+		{"oci://reg.example.com/t:1", LoadOptions{}, "oci:// config templates are not supported"},
+		{"oci://reg.example.com/t:1", LoadOptions{Fetch: fetch}, "local file base.yaml cannot be referenced from an oci:// config template"},
+		{"oci://reg.example.com/t:1", LoadOptions{Fetch: fetch, TrustTemplates: true}, "relative path base.yaml cannot be resolved in an oci:// config template"},
+		{StdinPath, LoadOptions{Stdin: strings.NewReader("extends: \"-\"\n")}, "<stdin>: stdin can only be used as the top-level config file"},
+	}
+	for _, tt := range tests {
+		_, _, err := LoadConfigNodeWithSources(tt.path, nil, tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Expected error containing %q for %s, got %v", tt.msg, tt.path, err)
+		}
+	}
+}
+
+// TestLoadConfigNodeTemplateRestrictions 测试 oci:// 模板不能读取本地文件和环境变量，
+// 也不能设置指向本地文件、代理和跳过 TLS 校验的字段，TrustTemplates 时不受限制
+func TestLoadConfigNodeTemplateRestrictions(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"secret.txt": "s3cr3t\n",
+		"local.yaml": "labels: {local: \"yes\"}\n",
+	})
+	t.Setenv("TEMPLATE_SECRET", "s3cr3t")
+	secret := filepath.Join(dir, "secret.txt")
+	pool, sources, err := BuildVarPoolWithSources(nil, map[string]string{"APP": "demo"}, VarPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		template string
+		msg      string
+	}{
+		{"labels: {secret: \"${file:" + secret + "}\"}\n", "file is not allowed in oci:// config templates"},
+		{"labels: {secret: \"${sha256file:" + secret + "}\"}\n", "sha256file is not allowed in oci:// config templates"},
+		{"labels: {secret: \"${env:TEMPLATE_SECRET}\"}\n", "env is not allowed in oci:// config templates"},
+		// 变量池中来自环境变量的变量同样不能读取
+		{"labels: {secret: \"${TEMPLATE_SECRET}\"}\n", "undefined variable: ${TEMPLATE_SECRET} (environment variables are not available to oci:// config templates"},
+		{"include: " + filepath.Join(dir, "local.yaml") + "\n", "cannot be referenced from an oci:// config template"},
+		{"layers: {entries: [{name: keys, files: [{src: /root/.ssh, dest: /keys}]}]}\n", "layer files cannot be set in an oci:// config template"},
+		{"profiles: {dev: {layers: {entries: [{name: keys, files: [{src: /root/.ssh, dest: /keys}]}]}}}\n", "layer files cannot be set in an oci:// config template"},
+		{"registries: {reg.example.com: {clientKey: /root/key.pem}}\n", "clientKey cannot be set in an oci:// config template"},
+		{"proxy: {https: http://proxy.example.com:3128}\n", "proxy cannot be set in an oci:// config template"},
+		{"insecure: true\n", "insecure cannot be set in an oci:// config template"},
+		{"profiles: {dev: {insecure: true}}\n", "insecure cannot be set in an oci:// config template"},
+		{"registries: {reg.example.com: {insecure: true}}\n", "insecure cannot be set in an oci:// config template"},
+		{"registries: {reg.example.com: {plainHttp: true}}\n", "plainHttp cannot be set in an oci:// config template"},
+		{"registries: {reg.example.com: {proxy: {https: http://proxy.example.com:3128}}}\n", "proxy cannot be set in an oci:// config template"},
+	}
+	for _, tt := range tests {
+		opts := LoadOptions{VarSources: sources, Fetch: func(ref string) ([]byte, string, error) {
+			return []byte(tt.template), "build.yaml", nil
+		}}
+		node, _, err := LoadConfigNodeWithSources("oci://reg.example.com/t:1", pool, opts)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Expected error containing %q for %q, got %v", tt.msg, tt.template, err)
+		}
+		if node != nil {
+			t.Errorf("Expected no config for %q", tt.template)
+		}
+
+		// 信任模板时与本地文件相同
+		opts.TrustTemplates = true
+		if _, _, err := LoadConfigNodeWithSources("oci://reg.example.com/t:1", pool, opts); err != nil {
+			t.Errorf("Unexpected error for a trusted template %q: %v", tt.template, err)
+		}
+	}
+
+	// 模板可以使用 --val 等显式传入的变量，环境变量按未定义处理，可以使用默认值
+	opts := LoadOptions{VarSources: sources, Fetch: func(ref string) ([]byte, string, error) {
+		return []byte("labels: {app: \"${APP}\", secret: \"${TEMPLATE_SECRET:-none}\"}\n"), "build.yaml", nil
+	}}
+	node, _, err := LoadConfigNodeWithSources("oci://reg.example.com/t:1", pool, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if app, secret := child(child(node, "labels"), "app"), child(child(node, "labels"), "secret"); app == nil || app.Value != "demo" || secret == nil || secret.Value != "none" {
+		t.Errorf("Expected app=demo and secret=none, got %v and %v", app, secret)
+	}
+
+	// 本地配置文件继承模板时，本地文件中的内容不受限制
+	opts = LoadOptions{
+		Stdin: strings.NewReader("extends: oci://reg.example.com/t:1\nlabels: {secret: \"${file:" + secret + "}\"}\n"),
+		Fetch: func(ref string) ([]byte, string, error) {
+			return []byte("from: {image: alpine}\n"), "build.yaml", nil
+		},
+	}
+	node, _, err = LoadConfigNodeWithSources(StdinPath, nil, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := child(child(node, "labels"), "secret"); got == nil || got.Value != "s3cr3t" {
+		t.Errorf("Expected the local file to be read by the local config, got %v", got)
+	}
+}
+
+// TestReadArtifact 测试从 OCI artifact 中选择配置文件
+func TestReadArtifact(t *testing.T) {
+	file := func(content, title string, mt types.MediaType) mutate.Addendum {
+		a := mutate.Addendum{Layer: static.NewLayer([]byte(content), mt)}
+		if title != "" {
+			a.Annotations = map[string]string{annotationTitle: title}
+		}
+		return a
+	}
+
+	tests := []struct {
+		files   []mutate.Addendum
+		content string
+		name    string
+		msg     string
+	}{
+		{[]mutate.Addendum{file("a: 1", "", "application/yaml")}, "a: 1", "", ""},
+		{[]mutate.Addendum{file("{}", "", "application/json")}, "{}", "config.json", ""},
+		{[]mutate.Addendum{file("readme", "README.md", "text/plain"), file("a = 1", "build.toml", "application/toml")}, "a = 1", "build.toml", ""},
+		{[]mutate.Addendum{file("readme", "README.md", "text/plain"), file("x", "LICENSE", "text/plain")}, "", "", "none of the 2 files"},
+		{[]mutate.Addendum{file("a: 1", "a.yaml", "application/yaml"), file("b: 1", "b.yml", "application/yaml")}, "", "", "several build files (a.yaml, b.yml)"},
+		{nil, "", "", "artifact contains no files"},
+	}
+	for i, tt := range tests {
+		img, err := mutate.Append(empty.Image, tt.files...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, name, err := ReadArtifact(img)
+		if tt.msg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("%d: expected error containing %q, got %v", i, tt.msg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if string(content) != tt.content || name != tt.name {
+			t.Errorf("%d: expected %q (%s), got %q (%s)", i, tt.content, tt.name, content, name)
+		}
+	}
+}
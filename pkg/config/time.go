@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 时间字段（creationTime 和层属性 timestamp）支持的关键字，与 Jib 一致
+const (
+	// TimeEpoch 为 Unix 纪元 1970-01-01T00:00:00Z
+	TimeEpoch = "EPOCH"
+	// TimeEpochPlusSecond 为 Unix 纪元后一秒，Jib 中文件时间戳的默认值
+	TimeEpochPlusSecond = "EPOCH_PLUS_SECOND"
+	// TimeCurrent 为构建时的当前时间
+	TimeCurrent = "USE_CURRENT_TIMESTAMP"
+)
+
+// EnvSourceDateEpoch 为可重复构建约定的环境变量，值为秒级时间戳，
+// 设置后作为未配置的时间字段的默认值，见 https://reproducible-builds.org/specs/source-date-epoch/
+const EnvSourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// ParseTime 解析配置中的时间字符串（如 creationTime、层属性 timestamp），支持：
+//
+//   - 关键字 EPOCH、EPOCH_PLUS_SECOND 和 USE_CURRENT_TIMESTAMP
+//   - 毫秒时间戳
+//   - ISO 8601 格式，如 2024-01-02T03:04:05Z、2024-01-02，未指定时区时为 UTC
+func ParseTime(value string) (time.Time, error) {
+	return ParseTimeAt(value, time.Now())
+}
+
+// ParseTimeAt 与 ParseTime 相同，但 USE_CURRENT_TIMESTAMP 解析为 now，
+// 一次构建中的所有时间字段使用同一个当前时间
+func ParseTimeAt(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case TimeEpoch:
+		return time.Unix(0, 0), nil
+	case TimeEpochPlusSecond:
+		return time.Unix(1, 0), nil
+	case TimeCurrent:
+		return now, nil
+	}
+
+	// 尝试解析为毫秒时间戳，确保整个字符串都是数字
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(ms, 10) == value {
+		return time.UnixMilli(ms), nil
+	}
+
+	// 尝试解析为 ISO 8601 格式，支持多种变体
+	formats := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+		// 忽略时区
+		"2006-01-02T15:04:05",
+	}
+
+	for _, format := range formats {
+		if ts, err := time.Parse(format, value); err == nil {
+			return ts, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse time: %s", value)
+}
+
+// SourceDateEpoch 返回环境变量 SOURCE_DATE_EPOCH 指定的时间，未设置时 ok 为 false，
+// 设置的值不是非负整数时返回错误
+func SourceDateEpoch() (t time.Time, ok bool, err error) {
+	value := os.Getenv(EnvSourceDateEpoch)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || sec < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q, expected seconds since the epoch", EnvSourceDateEpoch, value)
+	}
+	return time.Unix(sec, 0), true, nil
+}
+
+// ResolveTime 解析时间字段，value 为空时使用 SOURCE_DATE_EPOCH，也未设置时返回 now；
+// USE_CURRENT_TIMESTAMP 同样为 now
+func ResolveTime(value string, now time.Time) (time.Time, error) {
+	if value != "" {
+		return ParseTimeAt(value, now)
+	}
+	if t, ok, err := SourceDateEpoch(); err != nil || ok {
+		return t, err
+	}
+	return now, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseTime 测试时间关键字、毫秒时间戳和 ISO 8601 格式
+func TestParseTime(t *testing.T) {
+	tests := map[string]time.Time{
+		"EPOCH":                     time.Unix(0, 0),
+		"EPOCH_PLUS_SECOND":         time.Unix(1, 0),
+		"1000":                      time.Unix(1, 0),
+		"1700000000123":             time.UnixMilli(1700000000123),
+		"2024-01-02T03:04:05Z":      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2024-01-02T11:04:05+08:00": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2024-01-02":                time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for value, expected := range tests {
+		ts, err := ParseTime(value)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", value, err)
+			continue
+		}
+		if !ts.Equal(expected) {
+			t.Errorf("ParseTime(%q) = %v, expected %v", value, ts, expected)
+		}
+	}
+
+	before := time.Now()
+	if ts, err := ParseTime("USE_CURRENT_TIMESTAMP"); err != nil || ts.Before(before) {
+		t.Errorf("Expected current time, got %v (%v)", ts, err)
+	}
+	for _, value := range []string{"soon", "epoch", "10s"} {
+		if _, err := ParseTime(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+// TestResolveTime 测试未设置时间时使用 SOURCE_DATE_EPOCH 和默认值
+func TestResolveTime(t *testing.T) {
+	fallback := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Setenv(EnvSourceDateEpoch, "")
+	if ts, err := ResolveTime("", fallback); err != nil || !ts.Equal(fallback) {
+		t.Errorf("Expected fallback, got %v (%v)", ts, err)
+	}
+
+	t.Setenv(EnvSourceDateEpoch, "1700000000")
+	if ts, err := ResolveTime("", fallback); err != nil || !ts.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected SOURCE_DATE_EPOCH, got %v (%v)", ts, err)
+	}
+	// 配置中的值优先于 SOURCE_DATE_EPOCH
+	if ts, err := ResolveTime("EPOCH", fallback); err != nil || !ts.Equal(time.Unix(0, 0)) {
+		t.Errorf("Expected EPOCH, got %v (%v)", ts, err)
+	}
+	// USE_CURRENT_TIMESTAMP 使用传入的当前时间
+	if ts, err := ResolveTime("USE_CURRENT_TIMESTAMP", fallback); err != nil || !ts.Equal(fallback) {
+		t.Errorf("Expected the given current time, got %v (%v)", ts, err)
+	}
+
+	t.Setenv(EnvSourceDateEpoch, "yesterday")
+	if _, err := ResolveTime("", fallback); err == nil {
+		t.Error("Expected error for invalid SOURCE_DATE_EPOCH")
+	}
+}
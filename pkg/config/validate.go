@@ -0,0 +1,525 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的 apiVersion 和 kind
+const (
+	APIVersionV1Alpha1 = "jib/v1alpha1"
+	KindBuildFile      = "BuildFile"
+)
+
+var (
+	// permissionsPattern 匹配八进制权限字符串，如 644、0755
+	permissionsPattern = regexp.MustCompile(`^[0-7]{3,4}$`)
+	// portPattern 匹配端口、端口范围和协议，如 8080、8000-8010/udp
+	portPattern = regexp.MustCompile(`^(\d+)(?:-(\d+))?(?:/([A-Za-z]+))?$`)
+	// platformPattern 匹配 os/architecture[/variant] 形式的平台
+	platformPattern = regexp.MustCompile(`^[^/]+/[^/]+(/[^/]+)?$`)
+	// stopSignalPattern 匹配信号名或信号编号，如 SIGQUIT、QUIT、3
+	stopSignalPattern = regexp.MustCompile(`^(SIG)?[A-Z][A-Z0-9+-]*$|^[0-9]+$`)
+
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// Diagnostic 描述配置中的一个问题及其位置
+type Diagnostic struct {
+	// File 为问题所在的配置文件，没有来源信息时为空
+	File   string
+	Line   int
+	Column int
+	// Path 为字段以 . 连接的路径，如 layers.entries.0.files.1.dest
+	Path string
+	Msg  string
+}
+
+// Error 实现了 error 接口
+func (d *Diagnostic) Error() string {
+	if d.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Path, d.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", d.Line, d.Column, d.Path, d.Msg)
+}
+
+// Diagnostics 是配置中的所有问题，按文件和位置排序
+type Diagnostics []*Diagnostic
+
+// Error 实现了 error 接口，每个问题占一行
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap 使 errors.As 可以取出其中的 *Diagnostic
+func (ds Diagnostics) Unwrap() []error {
+	errs := make([]error, 0, len(ds))
+	for _, d := range ds {
+		errs = append(errs, d)
+	}
+	return errs
+}
+
+// Validate 检查合并后的配置节点，返回发现的所有问题：
+//
+//   - 未知字段和类型不匹配的字段
+//   - apiVersion 和 kind 的取值
+//   - 必填字段 from.image、to 以及文件的 src、dest
+//   - 权限为八进制字符串，dest 为绝对路径
+//   - exposedPorts 的格式（端口、端口范围和协议）
+//   - 层名称不重复
+//   - creationTime 和层属性 timestamp 的格式（见 ParseTime）
+//   - healthcheck 的命令和时长，stopSignal 的格式
+//   - remove 中的键没有同时在对应字段中设置
+//   - environment 中对环境变量的引用（见 ExpandEnv）
+//   - annotations.platforms 的键为 os/architecture[/variant] 形式的平台
+//   - 仓库配置（见 RegistryConfig.Validate）
+//
+// sources 用于报告问题所在的文件，可以为 nil
+func Validate(root *yaml.Node, sources *Sources) Diagnostics {
+	v := &validator{sources: sources}
+	v.checkType(root, reflect.TypeOf(Config{}), "")
+	v.checkValues(root)
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		a, b := v.diags[i], v.diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.diags
+}
+
+// validator 收集配置检查中发现的问题
+type validator struct {
+	sources *Sources
+	diags   Diagnostics
+}
+
+// report 记录 node 所在位置的问题
+func (v *validator) report(node *yaml.Node, path, format string, args ...interface{}) {
+	v.diags = append(v.diags, &Diagnostic{
+		File:   v.sources.File(node),
+		Line:   node.Line,
+		Column: node.Column,
+		Path:   path,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// checkType 按 yaml 标签检查节点的结构与类型 t 是否一致，报告未知字段
+func (v *validator) checkType(node *yaml.Node, t reflect.Type, path string) {
+	if isNull(node) {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// 自定义解析的类型（如 to）同时接受标量
+	if node.Kind == yaml.ScalarNode && reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.report(node, path, "expected a mapping, got %s", describe(node))
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q", key.Value)
+				if s := suggestField(key.Value, fields); s != "" {
+					msg += fmt.Sprintf(", did you mean %q?", s)
+				}
+				v.report(key, joinKey(path, key.Value), "%s", msg)
+				continue
+			}
+			v.checkType(value, field, joinKey(path, key.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.report(node, path, "expected a mapping, got %s", describe(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.checkType(node.Content[i+1], t.Elem(), joinKey(path, node.Content[i].Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.report(node, path, "expected a list, got %s", describe(node))
+			return
+		}
+		for i, item := range node.Content {
+			v.checkType(item, t.Elem(), joinKey(path, strconv.Itoa(i)))
+		}
+	case reflect.Interface:
+		// 任意值
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.report(node, path, "expected true or false, got %s", describe(node))
+		}
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.report(node, path, "expected an integer, got %s", describe(node))
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.report(node, path, "expected a string, got %s", describe(node))
+		}
+	}
+}
+
+// checkValues 检查字段的取值
+func (v *validator) checkValues(root *yaml.Node) {
+	if n := child(root, "apiVersion"); isScalar(n) && n.Value != APIVersionV1Alpha1 {
+		v.report(n, "apiVersion", "unsupported apiVersion %q, expected %q", n.Value, APIVersionV1Alpha1)
+	}
+	if n := child(root, "kind"); isScalar(n) && n.Value != KindBuildFile {
+		v.report(n, "kind", "unsupported kind %q, expected %q", n.Value, KindBuildFile)
+	}
+
+	// 必填字段
+	from := child(root, "from")
+	if value(child(from, "image")) == "" {
+		v.report(orNode(from, root), "from.image", "required field is missing")
+	}
+	switch to := child(root, "to"); {
+	case to == nil || isNull(to):
+		v.report(root, "to", "required field is missing")
+	case to.Kind == yaml.MappingNode && value(child(to, "image")) == "":
+		v.report(to, "to.image", "required field is missing")
+	}
+
+	if n := child(root, "creationTime"); value(n) != "" {
+		if _, err := ParseTime(n.Value); err != nil {
+			v.report(n, "creationTime", "%s", timeError(n.Value))
+		}
+	}
+
+	for i, port := range items(child(root, "exposedPorts")) {
+		if isScalar(port) {
+			if err := checkPort(port.Value); err != nil {
+				v.report(port, joinKey("exposedPorts", strconv.Itoa(i)), "%v", err)
+			}
+		}
+	}
+
+	v.checkRemove(root)
+	if n := child(root, "inherit"); isScalar(n) && n.Tag != "!!bool" {
+		v.report(n, "inherit", "expected true, false or a mapping, got %s", describe(n))
+	}
+	if env := child(root, "environment"); env != nil && env.Kind == yaml.MappingNode {
+		noEnv := func(string) (string, bool) { return "", false }
+		for i := 0; i+1 < len(env.Content); i += 2 {
+			if n := env.Content[i+1]; isScalar(n) {
+				if _, err := ExpandEnv(n.Value, noEnv); err != nil {
+					v.report(n, joinKey("environment", env.Content[i].Value), "%v", err)
+				}
+			}
+		}
+	}
+	if platforms := child(child(root, "annotations"), "platforms"); platforms != nil && platforms.Kind == yaml.MappingNode {
+		for i := 0; i < len(platforms.Content); i += 2 {
+			if key := platforms.Content[i]; !platformPattern.MatchString(key.Value) {
+				v.report(key, joinKey("annotations.platforms", key.Value), "invalid platform %q, expected os/architecture[/variant]", key.Value)
+			}
+		}
+	}
+	v.checkHealthcheck(child(root, "healthcheck"))
+	if n := child(root, "stopSignal"); value(n) != "" && !stopSignalPattern.MatchString(n.Value) {
+		v.report(n, "stopSignal", "invalid stop signal %q, expected a signal name such as SIGQUIT or a number", n.Value)
+	}
+
+	layers := child(root, "layers")
+	v.checkProperties(child(layers, "properties"), "layers.properties")
+	names := make(map[string]string)
+	for i, entry := range items(child(layers, "entries")) {
+		path := fmt.Sprintf("layers.entries.%d", i)
+		if name := child(entry, "name"); value(name) != "" {
+			if prev, ok := names[name.Value]; ok {
+				v.report(name, path+".name", "duplicate layer name %q, already used by %s", name.Value, prev)
+			} else {
+				names[name.Value] = path
+			}
+		}
+		v.checkProperties(child(entry, "properties"), path+".properties")
+
+		for j, file := range items(child(entry, "files")) {
+			if file.Kind != yaml.MappingNode {
+				continue
+			}
+			filePath := fmt.Sprintf("%s.files.%d", path, j)
+			if value(child(file, "src")) == "" {
+				v.report(file, filePath+".src", "required field is missing")
+			}
+			switch dest := child(file, "dest"); {
+			case value(dest) == "":
+				v.report(file, filePath+".dest", "required field is missing")
+			case !strings.HasPrefix(dest.Value, "/"):
+				v.report(dest, filePath+".dest", "must be an absolute path, got %q", dest.Value)
+			}
+			v.checkProperties(child(file, "properties"), filePath+".properties")
+		}
+	}
+
+	registries := child(root, "registries")
+	if registries != nil && registries.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(registries.Content); i += 2 {
+			key := registries.Content[i]
+			var rc RegistryConfig
+			if err := registries.Content[i+1].Decode(&rc); err != nil {
+				// 类型错误已由 checkType 报告
+				continue
+			}
+			if err := rc.Validate(); err != nil {
+				v.report(key, joinKey("registries", key.Value), "%v", err)
+			}
+		}
+	}
+}
+
+// checkRemove 检查 remove 中的端口格式，以及删除的键是否同时在对应字段中设置。
+// remove 在合并配置文件的值之前执行，同时设置时删除不起作用，通常是配置错误
+func (v *validator) checkRemove(root *yaml.Node) {
+	remove := child(root, "remove")
+	for _, field := range []string{"environment", "labels", "volumes", "exposedPorts"} {
+		set := make(map[string]bool)
+		switch n := child(root, field); {
+		case n == nil:
+		case n.Kind == yaml.MappingNode:
+			for i := 0; i < len(n.Content); i += 2 {
+				set[n.Content[i].Value] = true
+			}
+		case n.Kind == yaml.SequenceNode:
+			for _, item := range n.Content {
+				for _, key := range removeKeys(field, item.Value) {
+					set[key] = true
+				}
+			}
+		}
+
+		for i, item := range items(child(remove, field)) {
+			if !isScalar(item) {
+				continue
+			}
+			path := joinKey(joinKey("remove", field), strconv.Itoa(i))
+			if field == "exposedPorts" {
+				if err := checkPort(item.Value); err != nil {
+					v.report(item, path, "%v", err)
+					continue
+				}
+			}
+			for _, key := range removeKeys(field, item.Value) {
+				if set[key] {
+					v.report(item, path, "%q is removed from the base image and also set in %s", item.Value, field)
+					break
+				}
+			}
+		}
+	}
+}
+
+// removeKeys 返回 remove 中的值对应的键，端口规范化并展开端口范围
+func removeKeys(field, value string) []string {
+	if field != "exposedPorts" {
+		return []string{value}
+	}
+	keys, err := ExpandPort(value)
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// checkHealthcheck 检查健康检查的命令、时长和重试次数
+func (v *validator) checkHealthcheck(hc *yaml.Node) {
+	if hc == nil || hc.Kind != yaml.MappingNode {
+		return
+	}
+	switch test := child(hc, "test"); {
+	case test == nil || isNull(test):
+		v.report(hc, "healthcheck.test", "required field is missing")
+	case test.Kind == yaml.SequenceNode:
+		args := make([]string, 0, len(test.Content))
+		for _, item := range test.Content {
+			args = append(args, item.Value)
+		}
+		if err := checkHealthcheckTest(args); err != nil {
+			v.report(test, "healthcheck.test", "%v", err)
+		}
+	}
+	for _, key := range []string{"interval", "timeout", "startPeriod"} {
+		if n := child(hc, key); value(n) != "" {
+			if _, err := parseHealthDuration(n.Value); err != nil {
+				v.report(n, joinKey("healthcheck", key), "%v", err)
+			}
+		}
+	}
+	if n := child(hc, "retries"); isScalar(n) && n.Tag == "!!int" {
+		if retries, err := strconv.Atoi(n.Value); err == nil && retries < 0 {
+			v.report(n, "healthcheck.retries", "must not be negative, got %d", retries)
+		}
+	}
+}
+
+// checkProperties 检查层属性中的权限和时间戳
+func (v *validator) checkProperties(props *yaml.Node, path string) {
+	for _, key := range []string{"filePermissions", "directoryPermissions"} {
+		n := child(props, key)
+		if value(n) != "" && !permissionsPattern.MatchString(n.Value) {
+			v.report(n, joinKey(path, key), "invalid permissions %q, expected an octal string such as \"644\"", n.Value)
+		}
+	}
+	if n := child(props, "timestamp"); value(n) != "" {
+		if _, err := ParseTime(n.Value); err != nil {
+			v.report(n, joinKey(path, "timestamp"), "%s", timeError(n.Value))
+		}
+	}
+}
+
+// timeError 返回时间格式错误的说明
+func timeError(value string) string {
+	return fmt.Sprintf("invalid time %q, expected %s, %s, %s, milliseconds since the epoch or an ISO 8601 time",
+		value, TimeEpoch, TimeEpochPlusSecond, TimeCurrent)
+}
+
+// checkPort 检查端口格式：PORT[-END][/PROTOCOL]，协议为 tcp、udp 或 sctp
+func checkPort(port string) error {
+	m := portPattern.FindStringSubmatch(port)
+	if m == nil {
+		return fmt.Errorf("invalid port %q, expected PORT, PORT/PROTOCOL or START-END/PROTOCOL", port)
+	}
+	start, err := strconv.Atoi(m[1])
+	if err != nil || start < 1 || start > 65535 {
+		return fmt.Errorf("invalid port %q, port must be between 1 and 65535", port)
+	}
+	if m[2] != "" {
+		end, err := strconv.Atoi(m[2])
+		if err != nil || end < 1 || end > 65535 {
+			return fmt.Errorf("invalid port %q, port must be between 1 and 65535", port)
+		}
+		if end < start {
+			return fmt.Errorf("invalid port range %q, end is smaller than start", port)
+		}
+	}
+	switch strings.ToLower(m[3]) {
+	case "", "tcp", "udp", "sctp":
+		return nil
+	}
+	return fmt.Errorf("invalid protocol in port %q, expected tcp, udp or sctp", port)
+}
+
+// yamlFields 返回结构体中 yaml 键到字段类型的映射
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggestField 返回与 name 最接近的字段名，也会匹配互为前缀的名称（如 workingDir 和 workingDirectory）
+func suggestField(name string, fields map[string]reflect.Type) string {
+	names := make(map[string]string, len(fields))
+	for field := range fields {
+		names[field] = ""
+	}
+	if s := suggest(name, names); s != "" {
+		return s
+	}
+	lower := strings.ToLower(name)
+	best := ""
+	for field := range fields {
+		f := strings.ToLower(field)
+		if strings.HasPrefix(f, lower) || strings.HasPrefix(lower, f) {
+			if best == "" || field < best {
+				best = field
+			}
+		}
+	}
+	return best
+}
+
+// describe 返回节点的简短描述，用于错误信息
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return strconv.Quote(node.Value)
+}
+
+// child 返回映射中 key 对应的值，node 不是映射或没有该键时返回 nil
+func child(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	if idx := mappingIndex(node, key); idx >= 0 {
+		return node.Content[idx+1]
+	}
+	return nil
+}
+
+// items 返回列表中的元素，node 不是列表时返回 nil
+func items(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// value 返回标量的值，node 不是标量或为 null 时返回空字符串
+func value(node *yaml.Node) string {
+	if !isScalar(node) {
+		return ""
+	}
+	return node.Value
+}
+
+// isScalar 判断节点是否为非 null 的标量
+func isScalar(node *yaml.Node) bool {
+	return node != nil && node.Kind == yaml.ScalarNode && !isNull(node)
+}
+
+// isNull 判断节点是否为 null
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// orNode 返回 node，为 nil 时返回 fallback
+func orNode(node, fallback *yaml.Node) *yaml.Node {
+	if node == nil {
+		return fallback
+	}
+	return node
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidate 测试配置检查报告的问题及其位置
+func TestValidate(t *testing.T) {
+	const valid = "from: {image: alpine}\nto: r/app:v1\n"
+	tests := []struct {
+		content string
+		line    int
+		column  int
+		path    string
+		msg     string
+	}{
+		{valid + "workingDir: /app\n", 3, 1, "workingDir", `unknown field "workingDir", did you mean "workingDirectory"?`},
+		{valid + "layers: {entries: [{name: a, propertys: {}}]}\n", 3, 30, "layers.entries.0.propertys", `unknown field "propertys", did you mean "properties"?`},
+		{valid + "apiVersion: v2\n", 3, 13, "apiVersion", `unsupported apiVersion "v2"`},
+		{valid + "kind: Image\n", 3, 7, "kind", `unsupported kind "Image"`},
+		{valid + "creationTime: soon\n", 3, 15, "creationTime", `invalid time "soon"`},
+		{valid + "layers: {properties: {timestamp: epoch}}\n", 3, 34, "layers.properties.timestamp", `invalid time "epoch", expected EPOCH`},
+		{valid + "exposedPorts: [\"80/tcp\", \"8080-8081/udp\", \"0\"]\n", 3, 43, "exposedPorts.2", "port must be between 1 and 65535"},
+		{valid + "exposedPorts: [\"http\"]\n", 3, 16, "exposedPorts.0", `invalid port "http"`},
+		{valid + "layers: {properties: {directoryPermissions: \"789\"}}\n", 3, 45, "layers.properties.directoryPermissions", "expected an octal string"},
+		{valid + "layers:\n  entries:\n    - name: a\n      files: [{src: x, dest: x}]\n", 6, 30, "layers.entries.0.files.0.dest", `must be an absolute path, got "x"`},
+		{valid + "layers:\n  entries:\n    - name: a\n    - name: a\n", 6, 13, "layers.entries.1.name", `duplicate layer name "a", already used by layers.entries.0`},
+		{valid + "volumes: /data\n", 3, 10, "volumes", "expected a list, got \"/data\""},
+		{valid + "insecure: yes\n", 3, 11, "insecure", `expected true or false, got "yes"`},
+		{valid + "healthcheck: {test: [CMD-SHELL, a, b]}\n", 3, 21, "healthcheck.test", "requires exactly one command string"},
+		{valid + "healthcheck: {test: [HTTP, /]}\n", 3, 21, "healthcheck.test", `invalid healthcheck test type "HTTP"`},
+		{valid + "healthcheck: {interval: 30s}\n", 3, 14, "healthcheck.test", "required field is missing"},
+		{valid + "healthcheck: {test: [NONE], timeout: 5}\n", 3, 38, "healthcheck.timeout", `invalid duration "5"`},
+		{valid + "healthcheck: {test: [NONE], retries: -1}\n", 3, 38, "healthcheck.retries", "must not be negative"},
+		{valid + "healthcheck: {test: [NONE], retries: three}\n", 3, 38, "healthcheck.retries", `expected an integer, got "three"`},
+		{valid + "stopSignal: sig quit\n", 3, 13, "stopSignal", `invalid stop signal "sig quit"`},
+		{valid + "labels: {a: x}\nremove: {labels: [b, a]}\n", 4, 22, "remove.labels.1", `"a" is removed from the base image and also set in labels`},
+		{valid + "exposedPorts: [\"80\"]\nremove: {exposedPorts: [80/TCP]}\n", 4, 25, "remove.exposedPorts.0", "also set in exposedPorts"},
+		{valid + "remove: {exposedPorts: [ssh]}\n", 3, 25, "remove.exposedPorts.0", `invalid port "ssh"`},
+		{valid + "exposedPorts: [8000-8010]\nremove: {exposedPorts: [8005/tcp]}\n", 4, 25, "remove.exposedPorts.0", "also set in exposedPorts"},
+		{valid + "inherit: no\n", 3, 10, "inherit", `expected true, false or a mapping, got "no"`},
+		{valid + "inherit: {cmd: no}\n", 3, 16, "inherit.cmd", `expected true or false, got "no"`},
+		{valid + "environment: {PATH: \"/app:${PATH\"}\n", 3, 21, "environment.PATH", "missing '}'"},
+		{valid + "annotations: {platforms: {arm64: {a: b}}}\n", 3, 27, "annotations.platforms.arm64", `invalid platform "arm64"`},
+		{"to: r/app:v1\n", 1, 1, "from.image", "required field is missing"},
+		{"from: {image: alpine}\nto: {tags: [v1]}\n", 2, 5, "to.image", "required field is missing"},
+	}
+
+	for _, tt := range tests {
+		root, err := parseNode([]byte(tt.content))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		diags := Validate(root, nil)
+		if len(diags) != 1 {
+			t.Errorf("Expected 1 problem for %q, got %v", tt.content, diags)
+			continue
+		}
+		d := diags[0]
+		if d.Line != tt.line || d.Column != tt.column || d.Path != tt.path || !strings.Contains(d.Msg, tt.msg) {
+			t.Errorf("Expected %d:%d %s: %s for %q, got %d:%d %s: %s", tt.line, tt.column, tt.path, tt.msg, tt.content, d.Line, d.Column, d.Path, d.Msg)
+		}
+	}
+}
+
+// TestNormalizePort 测试端口在镜像配置中的键
+func TestNormalizePort(t *testing.T) {
+	tests := map[string]string{
+		"80":       "80/tcp",
+		"80/":      "80/tcp",
+		"53/UDP":   "53/udp",
+		"132/sctp": "132/sctp",
+	}
+	for port, expected := range tests {
+		if got := NormalizePort(port); got != expected {
+			t.Errorf("NormalizePort(%q) = %q, expected %q", port, got, expected)
+		}
+	}
+}
+
+// TestParseConfigDiagnostics 测试解析配置时报告所有问题所在的文件
+func TestParseConfigDiagnostics(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": "from:\n  image: alpine\n  imag: typo\n",
+		"build.yaml": `extends: base.yaml
+to: r/app:v1
+layers:
+  entries:
+    - name: app
+      files: [{src: a, dest: app}]
+`,
+	})
+
+	_, err := ParseConfig(filepath.Join(dir, "build.yaml"), nil)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("Expected Diagnostics, got %v", err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", diags)
+	}
+	expected := []string{
+		filepath.Join(dir, "base.yaml") + `:3:3: from.imag: unknown field "imag", did you mean "image"?`,
+		filepath.Join(dir, "build.yaml") + `:6:30: layers.entries.0.files.0.dest: must be an absolute path, got "app"`,
+	}
+	for i, d := range diags {
+		if d.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], d.Error())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadVarFile 读取变量文件，按扩展名识别格式：
+//
+//	.env         每行一个 KEY=VALUE，支持 export 前缀、# 注释和引号
+//	.json        JSON 对象
+//	其他（.yaml） YAML 映射
+//
+// JSON 和 YAML 中的嵌套映射展开为以 . 连接的键（如 a.b.c），列表以下标作为键（如 a.0）
+func LoadVarFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variable file %s: %w", path, err)
+	}
+
+	var vars map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".env":
+		vars, err = parseDotEnv(content)
+	case ".json":
+		vars, err = parseJSONVars(content)
+	default:
+		vars, err = parseYAMLVars(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse variable file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseDotEnv 解析 .env 格式
+func parseDotEnv(content []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value, err := dotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+// dotEnvValue 解析 .env 中的值：双引号内支持转义，单引号内为字面量，
+// 不带引号时 " #" 之后为注释
+func dotEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", errors.New("unterminated double quote")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated single quote")
+		}
+		return value[1 : end+1], nil
+	}
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value, nil
+}
+
+// closingQuote 返回双引号字符串中结束引号的位置，找不到时返回 -1
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseJSONVars 解析 JSON 对象，数字保持原始文本
+func parseJSONVars(content []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("top level must be an object")
+	}
+	vars := make(map[string]string)
+	flattenJSON("", obj, vars)
+	return vars, nil
+}
+
+// flattenJSON 将 JSON 值展开到 vars
+func flattenJSON(prefix string, value interface{}, vars map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			flattenJSON(joinKey(prefix, k), child, vars)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenJSON(joinKey(prefix, strconv.Itoa(i)), child, vars)
+		}
+	case nil:
+		vars[prefix] = ""
+	default:
+		vars[prefix] = fmt.Sprint(v)
+	}
+}
+
+// parseYAMLVars 解析 YAML 映射，标量保持原始文本（如 1.10 不会变成 1.1）
+func parseYAMLVars(content []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	// 空文件
+	if len(doc.Content) == 0 {
+		return vars, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: top level must be a mapping", root.Line)
+	}
+	if err := flattenYAML("", root, vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// flattenYAML 将 YAML 节点展开到 vars
+func flattenYAML(prefix string, node *yaml.Node, vars map[string]string) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return flattenYAML(prefix, node.Alias, vars)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+			}
+			if err := flattenYAML(joinKey(prefix, key.Value), node.Content[i+1], vars); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := flattenYAML(joinKey(prefix, strconv.Itoa(i)), child, vars); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			vars[prefix] = ""
+		} else {
+			vars[prefix] = node.Value
+		}
+	}
+	return nil
+}
+
+// joinKey 以 . 连接嵌套的键
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVarFile 在临时目录中写入变量文件
+func writeVarFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadVarFile 测试各种格式的变量文件
+func TestLoadVarFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]string
+	}{
+		{
+			name: "vars.yaml",
+			content: `APP_VERSION: 1.10
+replicas: 3
+enabled: true
+empty:
+image:
+  repo: example.com/app
+  tags: [latest, stable]
+`,
+			expected: map[string]string{
+				"APP_VERSION":  "1.10",
+				"replicas":     "3",
+				"enabled":      "true",
+				"empty":        "",
+				"image.repo":   "example.com/app",
+				"image.tags.0": "latest",
+				"image.tags.1": "stable",
+			},
+		},
+		{
+			name:    "vars.json",
+			content: `{"version": 1.10, "nested": {"a": {"b": "c"}}, "list": [1, null]}`,
+			expected: map[string]string{
+				"version":    "1.10",
+				"nested.a.b": "c",
+				"list.0":     "1",
+				"list.1":     "",
+			},
+		},
+		{
+			name: "build.env",
+			content: `# comment
+export APP_VERSION=1.0.0
+PLAIN=value # trailing comment
+DOUBLE="line1\nline2 # kept"
+SINGLE='${not_expanded}'
+EMPTY=
+`,
+			expected: map[string]string{
+				"APP_VERSION": "1.0.0",
+				"PLAIN":       "value",
+				"DOUBLE":      "line1\nline2 # kept",
+				"SINGLE":      "${not_expanded}",
+				"EMPTY":       "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		vars, err := LoadVarFile(writeVarFile(t, tt.name, tt.content))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(vars) != len(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, vars)
+		}
+		for k, v := range tt.expected {
+			if vars[k] != v {
+				t.Errorf("%s: expected %s=%q, got %q", tt.name, k, v, vars[k])
+			}
+		}
+	}
+}
+
+// TestLoadVarFileErrors 测试无法解析的变量文件返回错误
+func TestLoadVarFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		msg     string
+	}{
+		{"list.yaml", "- a\n- b\n", "top level must be a mapping"},
+		{"bad.yaml", "a: [\n", "failed to parse variable file"},
+		{"array.json", "[1, 2]", "top level must be an object"},
+		{"bad.env", "A=1\nnot a pair\n", "line 2: expected KEY=VALUE"},
+		{"quote.env", "A=\"unterminated\n", "line 1: unterminated double quote"},
+	}
+	for _, tt := range tests {
+		_, err := LoadVarFile(writeVarFile(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.msg, err)
+		}
+	}
+
+	if _, err := LoadVarFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+// TestBuildVarPoolOptions 测试变量文件错误、跳过出错的变量文件和不导入环境变量
+func TestBuildVarPoolOptions(t *testing.T) {
+	if _, err := BuildVarPool([]string{filepath.Join(t.TempDir(), "missing.yaml")}, nil, VarPoolOptions{}); err == nil {
+		t.Error("Expected error for missing variable file")
+	}
+
+	// Lenient 时跳过出错的文件，继续读取其他文件
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	valid := writeVarFile(t, "vars.env", "A=1\n")
+	var warned []error
+	pool, err := BuildVarPool([]string{missing, valid}, nil, VarPoolOptions{Lenient: true, Warn: func(err error) { warned = append(warned, err) }})
+	if err != nil {
+		t.Fatalf("Unexpected error with Lenient: %v", err)
+	}
+	if pool["A"] != "1" {
+		t.Errorf("Expected variables from the valid file, got %q", pool["A"])
+	}
+	if len(warned) != 1 || !strings.Contains(warned[0].Error(), "missing.yaml") {
+		t.Errorf("Expected a warning for the missing file, got %v", warned)
+	}
+
+	t.Setenv("POOL_ENV_TEST", "env")
+	pool, err = BuildVarPool(nil, nil, VarPoolOptions{NoEnv: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := pool["POOL_ENV_TEST"]; ok {
+		t.Error("Expected environment to be excluded with NoEnv")
+	}
+	if _, ok := pool["TimestampTag"]; !ok {
+		t.Error("Expected TimestampTag with NoEnv")
+	}
+}
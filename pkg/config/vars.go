@@ -0,0 +1,366 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VarError 描述变量替换失败的位置和原因
+type VarError struct {
+	// File 为配置文件路径，替换普通字符串时为空
+	File   string
+	Line   int
+	Column int
+	Name   string
+	Msg    string
+}
+
+// Error 实现了 error 接口
+func (e *VarError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// VarErrors 是一次替换中出现的所有错误，按出现位置排序
+type VarErrors []*VarError
+
+// Error 实现了 error 接口，每个错误占一行
+func (es VarErrors) Error() string {
+	lines := make([]string, 0, len(es))
+	for _, e := range es {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap 使 errors.As 可以取出其中的 *VarError
+func (es VarErrors) Unwrap() []error {
+	errs := make([]error, 0, len(es))
+	for _, e := range es {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// SetFile 为所有错误设置配置文件路径
+func (es VarErrors) SetFile(file string) {
+	for _, e := range es {
+		e.File = file
+	}
+}
+
+// VarRef 描述配置中对一个变量的引用
+type VarRef struct {
+	// File 为引用所在的配置文件，只由 FindConfigVars 设置
+	File   string
+	Name   string
+	Line   int
+	Column int
+	// Op 为修饰符（:-、:? 或 :+），没有时为空
+	Op string
+}
+
+// ReplaceVars 替换字符串中的变量，支持以下写法：
+//
+//	${VAR}          变量的值，未定义时报错
+//	${VAR:-default} 变量未定义或为空时使用 default
+//	${VAR:?message} 变量未定义或为空时以 message 报错
+//	${VAR:+alt}     变量已定义且非空时使用 alt，否则为空
+//	$${VAR}         转义，输出字面量 ${VAR}
+//
+// default、message 和 alt 中可以再引用变量。
+// 变量池中没有的名称会尝试作为模板函数计算，如 ${git.sha}、${date:2006.01.02}，见 callFunc。
+// 出错时返回 VarErrors，包含所有出错占位符的行号和列号，未定义的变量会给出变量池中相近的名称
+func ReplaceVars(str string, pool map[string]string) (string, error) {
+	return replaceVars(str, pool, nil, false)
+}
+
+// replaceVars 与 ReplaceVars 相同，sources 为变量池中每个变量的来源（见 BuildVarPoolWithSources），
+// 可以为 nil；restricted 时不能使用读取本地文件和环境变量的模板函数，用于 oci:// 模板，见 LoadOptions.restricted
+func replaceVars(str string, pool, sources map[string]string, restricted bool) (string, error) {
+	e := &expander{src: str, pool: pool, sources: sources, now: time.Now(), restricted: restricted}
+	result := e.expand(0, len(str))
+	if len(e.errs) > 0 {
+		sort.SliceStable(e.errs, func(i, j int) bool {
+			if e.errs[i].Line != e.errs[j].Line {
+				return e.errs[i].Line < e.errs[j].Line
+			}
+			return e.errs[i].Column < e.errs[j].Column
+		})
+		return result, e.errs
+	}
+	return result, nil
+}
+
+// FindVars 返回字符串中引用的所有变量（包括默认值等修饰内容中的引用），按出现顺序排列
+func FindVars(str string) ([]VarRef, error) {
+	e := &expander{src: str}
+	var refs []VarRef
+	var visit func(pos, start, end int)
+	visit = func(pos, start, end int) {
+		name, op, word := splitPlaceholder(str[start:end])
+		line, col := e.position(pos)
+		refs = append(refs, VarRef{Name: name, Line: line, Column: col, Op: op})
+		if op != "" {
+			e.walk(start+word, end, visit)
+		}
+	}
+	e.walk(0, len(str), visit)
+	if len(e.errs) > 0 {
+		return refs, e.errs
+	}
+	return refs, nil
+}
+
+// expander 在 src 上进行变量替换，偏移量均相对于 src，以便报告位置
+type expander struct {
+	src  string
+	pool map[string]string
+	// sources 为变量池中每个变量的来源，用于区分环境变量，为 nil 时都视为不是环境变量
+	sources map[string]string
+	// now 为 date 函数使用的时间，同一次替换中保持一致
+	now time.Time
+	// restricted 为 true 时不能使用 localFuncs 中的模板函数
+	restricted bool
+	// errs 收集替换过程中的所有错误
+	errs VarErrors
+}
+
+// expand 替换 src[start:end] 中的变量，出错的占位符原样保留并记录错误
+func (e *expander) expand(start, end int) string {
+	var b strings.Builder
+	last := start
+	e.walk(start, end, func(pos, bodyStart, bodyEnd int) {
+		b.WriteString(unescape(e.src[last:pos]))
+		val, err := e.resolve(pos, bodyStart, bodyEnd)
+		if err != nil {
+			e.errs = append(e.errs, err)
+			val = e.src[pos : bodyEnd+1]
+		}
+		b.WriteString(val)
+		last = bodyEnd + 1
+	})
+	if last < end {
+		b.WriteString(unescape(e.src[last:end]))
+	}
+	return b.String()
+}
+
+// walk 依次对 src[start:end] 中的每个占位符调用 fn，pos 为 $ 的位置，
+// src[bodyStart:bodyEnd] 为花括号内的内容；遇到未闭合的 ${ 时记录错误并停止
+func (e *expander) walk(start, end int, fn func(pos, bodyStart, bodyEnd int)) {
+	for i := start; i < end; {
+		switch {
+		case strings.HasPrefix(e.src[i:end], "$${"):
+			// 转义，跳过
+			i += 3
+		case strings.HasPrefix(e.src[i:end], "${"):
+			close := e.matchBrace(i+2, end)
+			if close < 0 {
+				e.errs = append(e.errs, e.errorf(i, "", "unterminated variable reference, missing '}'"))
+				return
+			}
+			fn(i, i+2, close)
+			i = close + 1
+		default:
+			i++
+		}
+	}
+}
+
+// unescape 将转义的 $${ 还原为 ${
+func unescape(s string) string {
+	return strings.ReplaceAll(s, "$${", "${")
+}
+
+// matchBrace 返回与 ${ 配对的 } 的位置，支持嵌套的 ${...}，找不到时返回 -1
+func (e *expander) matchBrace(start, end int) int {
+	depth := 0
+	for i := start; i < end; i++ {
+		switch {
+		case strings.HasPrefix(e.src[i:end], "${"):
+			depth++
+			i++
+		case e.src[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// splitPlaceholder 将花括号内的内容拆分为变量名、修饰符和修饰内容的起始偏移，
+// 第一个 :-、:? 或 :+ 之前为变量名
+func splitPlaceholder(body string) (name, op string, word int) {
+	for i := 0; i+1 < len(body); i++ {
+		if body[i] == ':' && strings.IndexByte("-?+", body[i+1]) >= 0 {
+			return body[:i], body[i : i+2], i + 2
+		}
+	}
+	return body, "", len(body)
+}
+
+// resolve 计算一个占位符的值，pos 为 $ 的位置，src[start:end] 为花括号内的内容。
+// 修饰内容中的错误由 expand 记录，返回的错误只针对占位符本身
+func (e *expander) resolve(pos, start, end int) (string, *VarError) {
+	body := e.src[start:end]
+	name, op, word := splitPlaceholder(body)
+	word += start
+	if name == "" {
+		return "", e.errorf(pos, name, "empty variable name in ${%s}", body)
+	}
+
+	val, ok, err := e.lookup(name)
+	var ue *unavailableError
+	if errors.As(err, &ue) {
+		// 按未定义处理，保留原因用于错误信息
+		err = nil
+	}
+	if err != nil {
+		return "", e.errorf(pos, name, "${%s}: %v", name, err)
+	}
+	switch op {
+	case "":
+		if !ok {
+			msg := fmt.Sprintf("undefined variable: ${%s}", name)
+			if ue != nil {
+				msg += fmt.Sprintf(" (%s)", ue.reason)
+			} else if s := e.suggestVar(name); s != "" {
+				msg += fmt.Sprintf(", did you mean ${%s}?", s)
+			}
+			return "", e.errorf(pos, name, "%s", msg)
+		}
+		return val, nil
+	case ":-":
+		if ok && val != "" {
+			return val, nil
+		}
+		return e.expand(word, end), nil
+	case ":?":
+		if ok && val != "" {
+			return val, nil
+		}
+		msg := e.expand(word, end)
+		if msg == "" {
+			msg = "variable is required"
+		}
+		return "", e.errorf(pos, name, "${%s}: %s", name, msg)
+	default: // ":+"
+		if ok && val != "" {
+			return e.expand(word, end), nil
+		}
+		return "", nil
+	}
+}
+
+// lookup 查找变量，变量池优先，其次为模板函数。
+// restricted 时变量池中来自环境变量的变量按未定义处理
+func (e *expander) lookup(name string) (string, bool, error) {
+	if val, ok := e.pool[name]; ok {
+		if e.restricted && e.sources[name] == SourceEnv {
+			return "", false, &unavailableError{reason: "environment variables are not available to oci:// config templates, use --trust-templates to allow them"}
+		}
+		return val, true, nil
+	}
+	if fn, _, ok := strings.Cut(name, ":"); ok && e.restricted && localFuncs[fn] {
+		return "", false, fmt.Errorf("%s is not allowed in oci:// config templates, use --trust-templates to allow it", fn)
+	}
+	val, ok, err := callFunc(name, e.now)
+	if err != nil {
+		return "", false, err
+	}
+	return val, ok, nil
+}
+
+// position 返回 pos 所在的行号和列号（按字符计算），均从 1 开始
+func (e *expander) position(pos int) (int, int) {
+	line := strings.Count(e.src[:pos], "\n") + 1
+	lineStart := strings.LastIndex(e.src[:pos], "\n") + 1
+	return line, utf8.RuneCountInString(e.src[lineStart:pos]) + 1
+}
+
+// errorf 创建带有 pos 所在行号和列号的错误
+func (e *expander) errorf(pos int, name, format string, args ...interface{}) *VarError {
+	line, col := e.position(pos)
+	return &VarError{
+		Line:   line,
+		Column: col,
+		Name:   name,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// minSuggestLen 为给出相近名称的最短名称长度，更短的名称（如 ${v}）与任何名称的编辑距离都很小
+const minSuggestLen = 3
+
+// suggest 返回变量池中与 name 最接近的变量名，没有足够接近的时返回空字符串。
+// 忽略大小写比较编辑距离，允许的距离随名称长度增加；name 或候选名称短于 minSuggestLen 时不参与比较
+func suggest(name string, pool map[string]string) string {
+	target := strings.ToLower(name)
+	if utf8.RuneCountInString(target) < minSuggestLen {
+		return ""
+	}
+	limit := len(target)/4 + 1
+	best, bestDist := "", limit+1
+	for key := range pool {
+		if utf8.RuneCountInString(key) < minSuggestLen {
+			continue
+		}
+		d := editDistance(target, strings.ToLower(key))
+		if d < bestDist || (d == bestDist && key < best) {
+			best, bestDist = key, d
+		}
+	}
+	if bestDist > limit {
+		return ""
+	}
+	return best
+}
+
+// suggestVar 为未定义的变量给出相近的名称，优先选择来自变量文件和命令行参数的变量，
+// 其中没有足够接近的名称时才考虑进程的环境变量；restricted 时不考虑环境变量
+func (e *expander) suggestVar(name string) string {
+	defined := make(map[string]string)
+	env := make(map[string]string)
+	for k, v := range e.pool {
+		if e.sources[k] == SourceEnv {
+			env[k] = v
+		} else {
+			defined[k] = v
+		}
+	}
+	if s := suggest(name, defined); s != "" || e.restricted {
+		return s
+	}
+	return suggest(name, env)
+}
+
+// editDistance 计算两个字符串的编辑距离（Levenshtein）
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReplaceVarsSyntax 测试默认值、必填、替代值和转义
+func TestReplaceVarsSyntax(t *testing.T) {
+	pool := map[string]string{
+		"NAME":  "app",
+		"EMPTY": "",
+		"TAG":   "v1",
+	}
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"${NAME}", "app"},
+		{"${EMPTY}", ""},
+		{"${MISSING:-default}", "default"},
+		{"${EMPTY:-default}", "default"},
+		{"${NAME:-default}", "app"},
+		{"${MISSING:-}", ""},
+		{"${MISSING:-${NAME}-${TAG}}", "app-v1"},
+		{"${NAME:?name is required}", "app"},
+		{"${NAME:+-${TAG}}", "-v1"},
+		{"${EMPTY:+alt}", ""},
+		{"${MISSING:+alt}", ""},
+		{"$${NAME}", "${NAME}"},
+		{"proxy_set_header Host $host; $${upstream}", "proxy_set_header Host $host; ${upstream}"},
+		{"$$ and $", "$$ and $"},
+		{"${MISSING:-a:-b}", "a:-b"},
+	}
+	for _, tt := range tests {
+		result, err := ReplaceVars(tt.in, pool)
+		if err != nil {
+			t.Errorf("ReplaceVars(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("ReplaceVars(%q): expected %q, got %q", tt.in, tt.expected, result)
+		}
+	}
+}
+
+// TestReplaceVarsErrors 测试错误信息中的位置
+func TestReplaceVarsErrors(t *testing.T) {
+	pool := map[string]string{"EMPTY": ""}
+
+	tests := []struct {
+		in     string
+		line   int
+		column int
+		msg    string
+	}{
+		{"a: 1\nb: ${MISSING}", 2, 4, "undefined variable: ${MISSING}"},
+		{"x: ${EMPTY:?must be set}", 1, 4, "${EMPTY}: must be set"},
+		{"x: ${MISSING:?}", 1, 4, "${MISSING}: variable is required"},
+		{"x: ${MISSING:-${ALSO_MISSING}}", 1, 15, "undefined variable: ${ALSO_MISSING}"},
+		{"名称: ${X", 1, 5, "unterminated variable reference, missing '}'"},
+		{"x: ${}", 1, 4, "empty variable name in ${}"},
+	}
+	for _, tt := range tests {
+		_, err := ReplaceVars(tt.in, pool)
+		var ve *VarError
+		if !errors.As(err, &ve) {
+			t.Errorf("ReplaceVars(%q): expected VarError, got %v", tt.in, err)
+			continue
+		}
+		if ve.Line != tt.line || ve.Column != tt.column || ve.Msg != tt.msg {
+			t.Errorf("ReplaceVars(%q): expected %d:%d %q, got %d:%d %q", tt.in, tt.line, tt.column, tt.msg, ve.Line, ve.Column, ve.Msg)
+		}
+	}
+}
+
+// TestParseConfigVarError 测试配置文件中的变量错误包含文件路径
+func TestParseConfigVarError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "from:\n  image: ${BASE_IMAGE}\nto: example.com/app:v1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseConfig(path, map[string]string{})
+	if err == nil || !strings.HasPrefix(err.Error(), path+":2:10: ") {
+		t.Errorf("Expected error with position %s:2:10, got %v", path, err)
+	}
+}
+
+// TestReplaceVarsFuncs 测试模板函数
+func TestReplaceVarsFuncs(t *testing.T) {
+	dir := t.TempDir()
+	versionFile := filepath.Join(dir, "VERSION")
+	if err := os.WriteFile(versionFile, []byte("1.2.3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FUNC_TEST_ENV", "from-env")
+	// 临时目录不在 git 仓库中
+	t.Chdir(dir)
+
+	pool := map[string]string{"git.sha": "overridden"}
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"${env:FUNC_TEST_ENV}", "from-env"},
+		{"${env:FUNC_TEST_UNSET:-fallback}", "fallback"},
+		{"${file:VERSION}", "1.2.3"},
+		{"${sha256file:" + versionFile + "}", "d82f34ae9aa41bc4a0cb529a1ac0898fed09d6b479fb1cc44cb66c34f15ee84d"},
+		{"${git.tag:-dev}", "dev"},
+		{"${git.sha}", "overridden"},
+	}
+	for _, tt := range tests {
+		result, err := ReplaceVars(tt.in, pool)
+		if err != nil {
+			t.Errorf("ReplaceVars(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("ReplaceVars(%q): expected %q, got %q", tt.in, tt.expected, result)
+		}
+	}
+
+	// date 在同一次替换中使用同一时间
+	result, err := ReplaceVars("${date:2006.01.02 15:04:05.000000000}|${date:2006.01.02 15:04:05.000000000}", nil)
+	parts := strings.Split(result, "|")
+	if err != nil || len(parts) != 2 || parts[0] != parts[1] {
+		t.Errorf("Expected identical dates, got %q (%v)", result, err)
+	}
+	if _, err := time.Parse("2006.01.02 15:04:05", parts[0]); err != nil {
+		t.Errorf("Unexpected date format %q: %v", parts[0], err)
+	}
+
+	// 函数不可用时报告原因
+	_, err = ReplaceVars("${git.branch}", nil)
+	if err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("Expected not a git repository error, got %v", err)
+	}
+	_, err = ReplaceVars("${file:missing.txt}", nil)
+	if err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
+
+// TestReplaceVarsAllErrors 测试报告所有未定义的变量并给出相近的名称
+func TestReplaceVarsAllErrors(t *testing.T) {
+	pool := map[string]string{"APP_VERSION": "1.0.0", "IMAGE": "app"}
+	_, err := ReplaceVars("to: ${IMAGE}:${APP_VERSON}\nlabel: ${MISSING}\nname: ${image}", pool)
+
+	var ve VarErrors
+	if !errors.As(err, &ve) {
+		t.Fatalf("Expected VarErrors, got %v", err)
+	}
+	expected := []string{
+		"line 1, column 14: undefined variable: ${APP_VERSON}, did you mean ${APP_VERSION}?",
+		"line 2, column 8: undefined variable: ${MISSING}",
+		"line 3, column 7: undefined variable: ${image}, did you mean ${IMAGE}?",
+	}
+	if len(ve) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(ve), err)
+	}
+	for i, e := range ve {
+		if e.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], e.Error())
+		}
+	}
+}
+
+// TestSuggestVar 测试短名称不给出相近名称，相近名称按变量来源优先选择环境变量以外的变量
+func TestSuggestVar(t *testing.T) {
+	// 取值与环境变量相同的 --val 变量同样不是环境变量
+	t.Setenv("APP_VERSION", "1.0.0")
+	pool := map[string]string{"_": "/usr/bin/env", "APP_VERSIOM": "1.0.0", "BUILD_NUMBER": "42", "APP_VERSION": "1.0.0", "V": "1"}
+	sources := map[string]string{"_": SourceEnv, "APP_VERSIOM": SourceEnv, "BUILD_NUMBER": SourceEnv, "APP_VERSION": SourceVal, "V": SourceVal}
+	e := &expander{pool: pool, sources: sources}
+
+	for _, test := range []struct {
+		name     string
+		expected string
+	}{
+		{"v", ""},
+		{"vv", ""},
+		// 与两者距离相同，选择不是环境变量的 APP_VERSION
+		{"APP_VERSIO", "APP_VERSION"},
+		{"BUILD_NUMBR", "BUILD_NUMBER"},
+	} {
+		if got := e.suggestVar(test.name); got != test.expected {
+			t.Errorf("suggestVar(%q) = %q, expected %q", test.name, got, test.expected)
+		}
+	}
+
+	_, err := ReplaceVars("${v}", pool)
+	if err == nil || err.Error() != "line 1, column 1: undefined variable: ${v}" {
+		t.Errorf("Expected no suggestion for a short name, got %v", err)
+	}
+}
+
+// TestFindVars 测试查找配置中引用的变量
+func TestFindVars(t *testing.T) {
+	refs, err := FindVars("a: ${A}\nb: ${B:-${C}} $${D}\nc: ${git.sha}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []VarRef{
+		{Name: "A", Line: 1, Column: 4},
+		{Name: "B", Line: 2, Column: 4, Op: ":-"},
+		{Name: "C", Line: 2, Column: 9},
+		{Name: "git.sha", Line: 3, Column: 4},
+	}
+	if len(refs) != len(expected) {
+		t.Fatalf("Expected %d refs, got %+v", len(expected), refs)
+	}
+	for i, ref := range refs {
+		if ref != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], ref)
+		}
+	}
+}
+
+// TestBuildVarPoolWithSources 测试变量来源
+func TestBuildVarPoolWithSources(t *testing.T) {
+	t.Setenv("SOURCE_TEST", "env")
+	valFile := filepath.Join(t.TempDir(), "vars.yaml")
+	if err := os.WriteFile(valFile, []byte("SOURCE_TEST: file\nFILE_ONLY: file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, sources, err := BuildVarPoolWithSources([]string{valFile}, map[string]string{"VAL_ONLY": "val"}, VarPoolOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pool["SOURCE_TEST"] != "file" || sources["SOURCE_TEST"] != "--valf "+valFile {
+		t.Errorf("Expected SOURCE_TEST from file, got %q from %q", pool["SOURCE_TEST"], sources["SOURCE_TEST"])
+	}
+	if sources["VAL_ONLY"] != SourceVal || sources["TimestampTag"] != SourceBuiltin {
+		t.Errorf("Unexpected sources: VAL_ONLY=%q TimestampTag=%q", sources["VAL_ONLY"], sources["TimestampTag"])
+	}
+
+	t.Setenv("ENV_ONLY", "env")
+	_, sources, _ = BuildVarPoolWithSources(nil, nil, VarPoolOptions{})
+	if sources["ENV_ONLY"] != SourceEnv {
+		t.Errorf("Expected ENV_ONLY from env, got %q", sources["ENV_ONLY"])
+	}
+}
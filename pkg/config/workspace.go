@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workspace 定义了 build-all 一次构建的多个配置文件，例如：
+//
+//	jobs: 4
+//	vals:
+//	  VERSION: 1.2.3
+//	builds:
+//	  - config: services/*/jib.yaml
+//	  - config: tools/migrator/jib.yaml
+//	    name: migrator
+//	    profiles: [prod]
+//	    vals:
+//	      MODULE: migrator
+type Workspace struct {
+	// Jobs 为同时进行的构建数，为 0 时由命令行参数决定
+	Jobs int `yaml:"jobs"`
+	// Vals 为所有构建共用的变量
+	Vals map[string]string `yaml:"vals"`
+	// Profiles 为所有构建都应用的 profile，先于构建自己的 profile 应用
+	Profiles []string `yaml:"profiles"`
+	// Builds 为要构建的配置文件
+	Builds []WorkspaceBuild `yaml:"builds"`
+}
+
+// WorkspaceBuild 定义了 workspace 中的一个构建
+type WorkspaceBuild struct {
+	// Name 为构建在日志和结果中的名称，默认为配置文件路径
+	Name string `yaml:"name"`
+	// Config 为配置文件路径，相对于 workspace 文件所在目录，支持通配符，见 Glob
+	Config string `yaml:"config"`
+	// Profiles 为该构建应用的 profile
+	Profiles []string `yaml:"profiles"`
+	// Vals 为该构建的变量，覆盖 workspace 中的同名变量
+	Vals map[string]string `yaml:"vals"`
+}
+
+// LoadWorkspace 读取 workspace 文件，相对的配置文件路径转换为相对于 workspace 文件所在目录
+func LoadWorkspace(file string) (*Workspace, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace file %s: %w", file, err)
+	}
+
+	var ws Workspace
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&ws); err != nil {
+		return nil, fmt.Errorf("failed to parse workspace file %s: %w", file, err)
+	}
+	if ws.Jobs < 0 {
+		return nil, fmt.Errorf("workspace file %s: jobs must not be negative", file)
+	}
+	if len(ws.Builds) == 0 {
+		return nil, fmt.Errorf("workspace file %s: no builds", file)
+	}
+
+	dir := filepath.Dir(file)
+	for i, b := range ws.Builds {
+		switch {
+		case b.Config == "":
+			return nil, fmt.Errorf("workspace file %s: builds[%d]: config is required", file, i)
+		case b.Config == StdinPath:
+			return nil, fmt.Errorf("workspace file %s: builds[%d]: reading the config file from stdin is not supported", file, i)
+		case strings.HasPrefix(b.Config, OCIPrefix), filepath.IsAbs(b.Config):
+		default:
+			ws.Builds[i].Config = filepath.Join(dir, b.Config)
+		}
+	}
+	return &ws, nil
+}
+
+// Expand 展开配置文件路径中的通配符，返回每个配置文件的构建，
+// 构建的 profile 和变量已合并 workspace 中共用的部分
+//
+// 不含通配符的路径和 oci:// 引用原样使用；通配符没有匹配任何文件、
+// 为匹配多个文件的构建设置了 name 以及构建名称重复时返回错误
+func (w *Workspace) Expand() ([]WorkspaceBuild, error) {
+	var builds []WorkspaceBuild
+	names := make(map[string]bool)
+	for _, b := range w.Builds {
+		configs := []string{b.Config}
+		if !strings.HasPrefix(b.Config, OCIPrefix) && hasMeta(b.Config) {
+			matches, err := Glob(b.Config)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", b.Config, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("pattern %s matches no files", b.Config)
+			}
+			if b.Name != "" && len(matches) > 1 {
+				return nil, fmt.Errorf("build %s: name cannot be used with a pattern matching %d files", b.Name, len(matches))
+			}
+			configs = matches
+		}
+
+		for _, c := range configs {
+			build := WorkspaceBuild{
+				Name:     b.Name,
+				Config:   c,
+				Profiles: append(append([]string{}, w.Profiles...), b.Profiles...),
+				Vals:     make(map[string]string, len(w.Vals)+len(b.Vals)),
+			}
+			if build.Name == "" {
+				build.Name = c
+			}
+			if names[build.Name] {
+				return nil, fmt.Errorf("duplicate build %s, set a distinct name for each build of the same config file", build.Name)
+			}
+			names[build.Name] = true
+			for k, v := range w.Vals {
+				build.Vals[k] = v
+			}
+			for k, v := range b.Vals {
+				build.Vals[k] = v
+			}
+			builds = append(builds, build)
+		}
+	}
+	return builds, nil
+}
+
+// Glob 返回匹配 pattern 的文件，按路径排序。支持 filepath.Match 的语法，
+// 此外单独作为路径段的 ** 匹配任意层目录（包括零层），如 services/**/jib.yaml
+func Glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	segs := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	for _, seg := range segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// 从第一个含通配符的路径段之前的目录开始遍历
+	n := 0
+	for n < len(segs) && !hasMeta(segs[n]) {
+		n++
+	}
+	root := filepath.FromSlash(strings.Join(segs[:n], "/"))
+	switch {
+	case n == 0:
+		root = "."
+	case root == "":
+		root = string(filepath.Separator)
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// 不进入 git 仓库的元数据目录
+			if d.Name() == ".git" && file != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segs[n:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, file)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchSegments 逐段匹配路径，** 匹配零个或多个路径段
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// hasMeta 判断路径中是否含有通配符
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[`)
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree 在 dir 中创建文件，files 为相对路径
+func writeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("from:\n  image: alpine\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestGlob 测试通配符和 ** 匹配
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir,
+		"jib.yaml",
+		"services/api/jib.yaml",
+		"services/web/jib.yaml",
+		"services/web/nested/jib.yaml",
+		"services/web/README.md",
+		".git/jib.yaml",
+	)
+	rel := func(paths []string) []string {
+		out := make([]string, 0, len(paths))
+		for _, p := range paths {
+			r, err := filepath.Rel(dir, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, filepath.ToSlash(r))
+		}
+		return out
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"services/*/jib.yaml", []string{"services/api/jib.yaml", "services/web/jib.yaml"}},
+		{"services/**/jib.yaml", []string{"services/api/jib.yaml", "services/web/jib.yaml", "services/web/nested/jib.yaml"}},
+		{"**/jib.yaml", []string{"jib.yaml", "services/api/jib.yaml", "services/web/jib.yaml", "services/web/nested/jib.yaml"}},
+		{"services/w*/**", []string{"services/web/README.md", "services/web/jib.yaml", "services/web/nested/jib.yaml"}},
+		{"missing/**/jib.yaml", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			matches, err := Glob(filepath.Join(dir, tt.pattern))
+			if err != nil {
+				t.Fatalf("Glob failed: %v", err)
+			}
+			if got := rel(matches); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := Glob(filepath.Join(dir, "**", "[")); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+// TestLoadWorkspace 测试读取 workspace 文件和展开构建
+func TestLoadWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "services/api/jib.yaml", "services/web/jib.yaml", "tools/migrator/jib.yaml")
+	file := filepath.Join(dir, "workspace.yaml")
+	content := `jobs: 2
+vals:
+  VERSION: 1.2.3
+  MODULE: shared
+profiles: [ci]
+builds:
+  - config: services/*/jib.yaml
+  - config: tools/migrator/jib.yaml
+    name: migrator
+    profiles: [prod]
+    vals:
+      MODULE: migrator
+  - config: oci://registry.example.com/templates/java:1
+    name: template
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := LoadWorkspace(file)
+	if err != nil {
+		t.Fatalf("LoadWorkspace failed: %v", err)
+	}
+	if ws.Jobs != 2 {
+		t.Errorf("Expected jobs 2, got %d", ws.Jobs)
+	}
+	builds, err := ws.Expand()
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+
+	api := filepath.Join(dir, "services", "api", "jib.yaml")
+	migrator := filepath.Join(dir, "tools", "migrator", "jib.yaml")
+	expected := []WorkspaceBuild{
+		{Name: api, Config: api, Profiles: []string{"ci"}, Vals: map[string]string{"VERSION": "1.2.3", "MODULE": "shared"}},
+		{Name: filepath.Join(dir, "services", "web", "jib.yaml"), Config: filepath.Join(dir, "services", "web", "jib.yaml"), Profiles: []string{"ci"}, Vals: map[string]string{"VERSION": "1.2.3", "MODULE": "shared"}},
+		{Name: "migrator", Config: migrator, Profiles: []string{"ci", "prod"}, Vals: map[string]string{"VERSION": "1.2.3", "MODULE": "migrator"}},
+		{Name: "template", Config: "oci://registry.example.com/templates/java:1", Profiles: []string{"ci"}, Vals: map[string]string{"VERSION": "1.2.3", "MODULE": "shared"}},
+	}
+	if !reflect.DeepEqual(builds, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, builds)
+	}
+}
+
+// TestWorkspaceErrors 测试 workspace 文件和展开构建时的错误
+func TestWorkspaceErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a/jib.yaml", "b/jib.yaml")
+
+	loadTests := []struct {
+		content string
+		errMsg  string
+	}{
+		{"builds: []\n", "no builds"},
+		{"jobs: -1\nbuilds:\n  - config: a/jib.yaml\n", "jobs must not be negative"},
+		{"builds:\n  - name: a\n", "config is required"},
+		{"builds:\n  - config: '-'\n", "stdin is not supported"},
+		{"builds:\n  - confg: a/jib.yaml\n", "field confg not found"},
+	}
+	for _, tt := range loadTests {
+		file := filepath.Join(dir, "workspace.yaml")
+		if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadWorkspace(file); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("Expected error containing %q for %q, got %v", tt.errMsg, tt.content, err)
+		}
+	}
+
+	expandTests := []struct {
+		builds []WorkspaceBuild
+		errMsg string
+	}{
+		{[]WorkspaceBuild{{Config: filepath.Join(dir, "c", "*.yaml")}}, "matches no files"},
+		{[]WorkspaceBuild{{Name: "all", Config: filepath.Join(dir, "*", "jib.yaml")}}, "name cannot be used"},
+		{[]WorkspaceBuild{{Config: filepath.Join(dir, "a", "jib.yaml")}, {Config: filepath.Join(dir, "*", "jib.yaml")}}, "duplicate build"},
+	}
+	for _, tt := range expandTests {
+		ws := &Workspace{Builds: tt.builds}
+		if _, err := ws.Expand(); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Package event 提供构建过程中的结构化事件输出，支持文本和 JSON 两种格式
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format 定义了事件的输出格式
+type Format string
+
+const (
+	// FormatText 面向人阅读的文本格式
+	FormatText Format = "text"
+	// FormatJSON 每行一个 JSON 对象，便于日志系统采集
+	FormatJSON Format = "json"
+)
+
+// Level 定义了事件级别
+type Level string
+
+const (
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Fields 事件附带的结构化字段
+type Fields map[string]interface{}
+
+// ParseFormat 解析输出格式字符串
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("invalid log format %q, expected text or json", s)
+}
+
+// Logger 输出结构化事件，nil Logger 会丢弃所有事件
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format Format
+	quiet  bool
+	plain  bool
+	now    func() time.Time
+
+	// status 为文本格式下显示在输出末尾、可原地刷新的状态行
+	status []string
+
+	// parent 不为 nil 时为 With 创建的子 Logger，事件附加 prefix 和 fields 后由 parent 输出
+	parent *Logger
+	prefix string
+	fields Fields
+}
+
+// New 创建一个 Logger，默认输出文本格式
+func New(out io.Writer) *Logger {
+	return &Logger{out: out, format: FormatText, now: time.Now}
+}
+
+// With 返回一个子 Logger，其输出的每个事件都附带 fields，文本格式下消息前加上 [prefix]，
+// 用于并发构建时区分事件属于哪个构建
+func (l *Logger) With(prefix string, fields Fields) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{parent: l, prefix: prefix, fields: fields, now: l.now}
+}
+
+// Configure 设置输出格式；quiet 时只输出警告和错误；plain 时文本格式不输出图标
+func (l *Logger) Configure(format Format, quiet, plain bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+	l.quiet = quiet
+	l.plain = plain
+}
+
+// JSON 判断是否为 JSON 输出格式
+func (l *Logger) JSON() bool {
+	if l == nil {
+		return false
+	}
+	if l.parent != nil {
+		return l.parent.JSON()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.format == FormatJSON
+}
+
+// Info 输出普通事件
+func (l *Logger) Info(name, msg string, fields Fields) {
+	l.emit(LevelInfo, name, msg, fields, -1)
+}
+
+// Warn 输出警告事件
+func (l *Logger) Warn(name, msg string, fields Fields) {
+	l.emit(LevelWarn, name, msg, fields, -1)
+}
+
+// Error 输出错误事件
+func (l *Logger) Error(name, msg string, fields Fields) {
+	l.emit(LevelError, name, msg, fields, -1)
+}
+
+// Step 表示一个有耗时的构建步骤
+type Step struct {
+	l      *Logger
+	name   string
+	msg    string
+	fields Fields
+	start  time.Time
+}
+
+// Start 开始一个步骤并输出开始事件，调用 Done 时输出带耗时的结束事件
+func (l *Logger) Start(name, msg string, fields Fields) *Step {
+	if l == nil {
+		return &Step{}
+	}
+	l.emit(LevelInfo, name+".start", msg, fields, -1)
+	return &Step{l: l, name: name, msg: msg, fields: fields, start: l.now()}
+}
+
+// Done 结束步骤，输出带 duration_ms 的结束事件，fields 会与开始时的字段合并
+// 文本格式下 msg 为空时输出开始时的消息（去掉末尾的 ...）加 done 和耗时，开始时的消息也为空时不输出
+func (s *Step) Done(msg string, fields Fields) {
+	if s.l == nil {
+		return
+	}
+	merged := Fields{}
+	for k, v := range s.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	if msg == "" && s.msg != "" && !s.l.JSON() {
+		msg = strings.TrimSuffix(s.msg, "...") + " done"
+	}
+	s.l.emit(LevelInfo, s.name+".done", msg, merged, s.l.now().Sub(s.start))
+}
+
+// emit 按格式输出事件，duration 小于 0 表示没有耗时
+func (l *Logger) emit(level Level, name, msg string, fields Fields, duration time.Duration) {
+	l.emitPrefixed(level, name, "", msg, fields, duration)
+}
+
+// emitPrefixed 输出事件，子 Logger 合并自己的前缀和字段后交给 parent 输出
+func (l *Logger) emitPrefixed(level Level, name, prefix, msg string, fields Fields, duration time.Duration) {
+	if l == nil {
+		return
+	}
+	if l.parent != nil {
+		merged := make(Fields, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		if prefix == "" {
+			prefix = l.prefix
+		} else if l.prefix != "" {
+			prefix = l.prefix + "/" + prefix
+		}
+		l.parent.emitPrefixed(level, name, prefix, msg, merged, duration)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.quiet && level == LevelInfo {
+		return
+	}
+
+	if l.format == FormatJSON {
+		record := make(map[string]interface{}, len(fields)+5)
+		for k, v := range fields {
+			record[k] = v
+		}
+		record["time"] = l.now().Format(time.RFC3339Nano)
+		record["level"] = level
+		record["event"] = name
+		if msg != "" {
+			record["msg"] = msg
+		}
+		if duration >= 0 {
+			record["duration_ms"] = duration.Milliseconds()
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			fmt.Fprintf(l.out, `{"level":"error","event":"event.encode","msg":%q}`+"\n", err.Error())
+			return
+		}
+		fmt.Fprintln(l.out, string(line))
+		return
+	}
+
+	if msg == "" {
+		return
+	}
+	if prefix != "" {
+		msg = "[" + prefix + "] " + msg
+	}
+	// 先清除状态行，输出事件后再重新绘制
+	l.clearStatus()
+	fmt.Fprintln(l.out, l.text(level, name, msg, duration))
+	l.drawStatus()
+}
+
+// Status 设置文本格式下显示在输出末尾的状态行（如进度条），传入空切片清除状态行
+// 状态行使用 ANSI 控制序列原地刷新，调用方需确认输出为支持控制序列的终端
+func (l *Logger) Status(lines []string) {
+	if l == nil {
+		return
+	}
+	if l.parent != nil {
+		l.parent.Status(lines)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.format != FormatText {
+		return
+	}
+	l.clearStatus()
+	l.status = lines
+	l.drawStatus()
+}
+
+// clearStatus 清除已绘制的状态行，调用方需持有锁
+func (l *Logger) clearStatus() {
+	if len(l.status) == 0 {
+		return
+	}
+	// 光标上移到状态区第一行并清除到屏幕末尾
+	fmt.Fprintf(l.out, "\033[%dA\r\033[J", len(l.status))
+}
+
+// drawStatus 绘制状态行，调用方需持有锁
+func (l *Logger) drawStatus() {
+	for _, line := range l.status {
+		fmt.Fprintln(l.out, line)
+	}
+}
+
+// text 生成文本格式的事件行
+func (l *Logger) text(level Level, name, msg string, duration time.Duration) string {
+	style := styleFor(name)
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("   ", style.indent))
+	switch {
+	case level == LevelWarn && l.plain:
+		b.WriteString("[WARNING] ")
+	case level == LevelWarn:
+		b.WriteString("⚠️  Warning: ")
+	case level == LevelError && l.plain:
+		b.WriteString("[ERROR] ")
+	case level == LevelError:
+		b.WriteString("❌ ")
+	case !l.plain && style.icon != "":
+		b.WriteString(style.icon + " ")
+	}
+	b.WriteString(msg)
+	if duration >= 0 {
+		fmt.Fprintf(&b, " (%s)", duration.Round(time.Millisecond))
+	}
+	return b.String()
+}
+
+// textStyle 定义了文本格式下事件的图标和缩进
+type textStyle struct {
+	icon   string
+	indent int
+}
+
+// textStyles 按事件名前缀定义文本样式，匹配最长前缀
+var textStyles = map[string]textStyle{
+	"vars":                 {"🔧", 0},
+	"config":               {"📄", 0},
+	"registries":           {"🔐", 0},
+	"proxy":                {"🌐", 0},
+	"platforms":            {"🎯", 0},
+	"tmpdir":               {"📁", 0},
+	"layers":               {"📦", 0},
+	"layer":                {"📦", 1},
+	"layer.skip":           {"🚫", 1},
+	"config.set":           {"⚙️ ", 1},
+	"config.remove":        {"➖", 1},
+	"config.reset":         {"🧹", 1},
+	"config.profile":       {"🔀", 1},
+	"config.template":      {"📥", 1},
+	"annotations":          {"🏷️ ", 0},
+	"platform":             {"🔨", 0},
+	"platform.pull":        {"📥", 1},
+	"platform.layer":       {"🧩", 1},
+	"platform.cfg":         {"📝", 1},
+	"platform.save":        {"💾", 1},
+	"platform.done":        {"✅", 1},
+	"platform.mismatch":    {"", 1},
+	"platform.annotations": {"🏷️ ", 1},
+	"platform.format":      {"📋", 1},
+	"index":                {"📦", 0},
+	"index.combine":        {"🛠️ ", 1},
+	"index.format":         {"📋", 1},
+	"index.annotations":    {"🏷️ ", 1},
+	"push":                 {"📤", 1},
+	"push.tag":             {"🏷️ ", 1},
+	"progress":             {"⏳", 1},
+	"progress.done":        {"📊", 1},
+	"workspace":            {"🗂️ ", 0},
+	"build":                {"🏗️ ", 0},
+	"build.done":           {"✅", 0},
+	"build.result":         {"🎉", 1},
+}
+
+// styleFor 返回事件名匹配的最长前缀样式
+func styleFor(name string) textStyle {
+	prefixes := make([]string, 0, len(textStyles))
+	for prefix := range textStyles {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return textStyle{}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return textStyles[prefixes[0]]
+}
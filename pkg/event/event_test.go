@@ -0,0 +1,131 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLogger 创建一个使用固定时钟的 Logger
+func newTestLogger(format Format, quiet, plain bool) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := New(&buf)
+	l.Configure(format, quiet, plain)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return l, &buf
+}
+
+// TestParseFormat 测试解析输出格式
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("JSON"); err != nil || f != FormatJSON {
+		t.Errorf("Expected json, got %v, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected error for invalid format, got nil")
+	}
+}
+
+// TestLoggerJSON 测试 JSON 格式事件
+func TestLoggerJSON(t *testing.T) {
+	l, buf := newTestLogger(FormatJSON, false, false)
+
+	step := l.Start("layer.create", "Creating layer", Fields{"layer": "scripts"})
+	step.Done("", Fields{"size": 1024})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %s", len(lines), buf.String())
+	}
+
+	var done map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &done); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if done["event"] != "layer.create.done" {
+		t.Errorf("Expected layer.create.done, got %v", done["event"])
+	}
+	if done["layer"] != "scripts" || done["size"] != float64(1024) {
+		t.Errorf("Expected merged fields, got %v", done)
+	}
+	if done["duration_ms"] != float64(1000) {
+		t.Errorf("Expected duration_ms=1000, got %v", done["duration_ms"])
+	}
+	if _, ok := done["time"]; !ok {
+		t.Error("Expected time field")
+	}
+}
+
+// TestLoggerText 测试文本格式和 quiet 模式
+func TestLoggerText(t *testing.T) {
+	l, buf := newTestLogger(FormatText, false, true)
+	l.Info("platform.pull", "Pulling base image: ubuntu", nil)
+	l.Warn("platform.mismatch", "actual platform differs", nil)
+	if got := buf.String(); got != "   Pulling base image: ubuntu\n   [WARNING] actual platform differs\n" {
+		t.Errorf("Unexpected text output: %q", got)
+	}
+
+	l, buf = newTestLogger(FormatText, true, false)
+	l.Info("vars", "Building variable pool...", nil)
+	l.Start("build", "Building", nil).Done("done", nil)
+	l.Warn("registries.insecure", "insecure", nil)
+	if got := buf.String(); got != "⚠️  Warning: insecure\n" {
+		t.Errorf("Expected only warnings in quiet mode, got %q", got)
+	}
+
+	// 测试用例：结束消息为空时使用开始消息并显示耗时，开始消息也为空时不输出
+	l, buf = newTestLogger(FormatText, false, true)
+	l.Start("vars", "Building variable pool...", nil).Done("", nil)
+	l.Start("build", "", nil).Done("", nil)
+	if got := buf.String(); got != "Building variable pool...\nBuilding variable pool done (1s)\n" {
+		t.Errorf("Unexpected text output: %q", got)
+	}
+
+	// 测试用例：nil Logger 不输出
+	var nl *Logger
+	nl.Info("vars", "ignored", nil)
+	nl.Start("build", "ignored", nil).Done("ignored", nil)
+}
+
+// TestLoggerWith 测试子 Logger 附加的前缀和字段
+func TestLoggerWith(t *testing.T) {
+	l, buf := newTestLogger(FormatText, false, true)
+	child := l.With("api", Fields{"build": "api"})
+	child.Info("platform.pull", "Pulling base image: ubuntu", nil)
+	child.With("amd64", nil).Warn("platform.mismatch", "actual platform differs", nil)
+	if got := buf.String(); got != "   [api] Pulling base image: ubuntu\n   [WARNING] [api/amd64] actual platform differs\n" {
+		t.Errorf("Unexpected text output: %q", got)
+	}
+
+	l, buf = newTestLogger(FormatJSON, false, false)
+	child = l.With("api", Fields{"build": "api", "layer": "ignored"})
+	if !child.JSON() {
+		t.Error("Expected child logger to use the parent's format")
+	}
+	child.Start("layer.create", "Creating layer", Fields{"layer": "scripts"}).Done("", nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %s", len(lines), buf.String())
+	}
+	var done map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &done); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if done["build"] != "api" || done["layer"] != "scripts" || done["msg"] != nil {
+		t.Errorf("Expected build field and event fields to take precedence, got %v", done)
+	}
+	if done["duration_ms"] != float64(1000) {
+		t.Errorf("Expected duration_ms=1000, got %v", done["duration_ms"])
+	}
+
+	var nl *Logger
+	if nl.With("api", nil) != nil {
+		t.Error("Expected nil child of nil Logger")
+	}
+}
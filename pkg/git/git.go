@@ -0,0 +1,390 @@
+// Package git 直接读取 .git 目录获取仓库信息（当前提交、分支、tag），不依赖 git 命令
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxPeelDepth 解析附注 tag 时最多跟随的层数（tag 可以指向另一个 tag）
+const maxPeelDepth = 8
+
+// Repo 表示一个本地 git 仓库
+type Repo struct {
+	// gitDir 为当前工作树的 git 目录，HEAD 位于其中
+	gitDir string
+	// commonDir 为 refs 和 objects 所在目录，使用 git worktree 时与 gitDir 不同
+	commonDir string
+}
+
+// Open 从 dir 开始逐级向上查找 .git，支持 .git 为文件（worktree、submodule）的情况
+func Open(dir string) (*Repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		gitDir, err := findGitDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if gitDir != "" {
+			return newRepo(gitDir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("not a git repository")
+		}
+		dir = parent
+	}
+}
+
+// findGitDir 返回 dir 下 .git 对应的 git 目录，不存在时返回空字符串
+func findGitDir(dir string) (string, error) {
+	path := filepath.Join(dir, ".git")
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return path, nil
+	}
+
+	// .git 文件的内容为 "gitdir: <path>"
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("invalid .git file %s", path)
+	}
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, nil
+}
+
+// newRepo 根据 git 目录创建 Repo，读取 commondir 以支持 worktree
+func newRepo(gitDir string) (*Repo, error) {
+	r := &Repo{gitDir: gitDir, commonDir: gitDir}
+	content, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		common := strings.TrimSpace(string(content))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		r.commonDir = common
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Head 返回 HEAD 指向的提交
+func (r *Repo) Head() (string, error) {
+	ref, sha, err := r.readHead()
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return sha, nil
+	}
+	sha, err = r.resolveRef(ref)
+	if err != nil {
+		return "", fmt.Errorf("HEAD does not point to a commit: %w", err)
+	}
+	return sha, nil
+}
+
+// Branch 返回当前分支名，HEAD 处于分离状态时返回空字符串
+func (r *Repo) Branch() string {
+	ref, _, err := r.readHead()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// Tag 返回指向 HEAD 的 tag，有多个时返回按名称排序的最后一个
+func (r *Repo) Tag() (string, error) {
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	refs, peeled, err := r.packedRefs()
+	if err != nil {
+		return "", err
+	}
+	if err := r.looseRefs("refs/tags", refs); err != nil {
+		return "", err
+	}
+
+	var tags []string
+	for ref, sha := range refs {
+		name, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok {
+			continue
+		}
+		commit, ok := peeled[ref]
+		if !ok {
+			commit = r.peel(sha)
+		}
+		if commit == head {
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) == 0 {
+		return "", errors.New("no tag points at HEAD")
+	}
+	sort.Strings(tags)
+	return tags[len(tags)-1], nil
+}
+
+// RemoteURL 返回 .git/config 中远程仓库 name（如 origin）的 url，有多个时返回第一个
+func (r *Repo) RemoteURL(name string) (string, error) {
+	f, err := os.Open(filepath.Join(r.commonDir, "config"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	section := fmt.Sprintf("remote %q", name)
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			current = strings.TrimSpace(strings.Trim(line, "[]"))
+		case current == section:
+			key, value, ok := strings.Cut(line, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "url") {
+				return strings.Trim(strings.TrimSpace(value), `"`), nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("remote %s not found", name)
+}
+
+// SourceURL 将远程仓库地址转换为可以公开的 https 地址：
+// git@host:org/repo.git 和 ssh://git@host/org/repo.git 转换为 https://host/org/repo，
+// 去掉地址中的用户名、密码（如 CI 中的访问令牌）和 .git 后缀；无法识别的地址原样返回
+func SourceURL(remote string) string {
+	u := remote
+	switch {
+	case strings.HasPrefix(u, "ssh://"), strings.HasPrefix(u, "git://"),
+		strings.HasPrefix(u, "https://"), strings.HasPrefix(u, "http://"):
+		scheme, rest, _ := strings.Cut(u, "://")
+		host, path, _ := strings.Cut(rest, "/")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if scheme != "http" {
+			scheme = "https"
+			// ssh 地址中的端口不适用于 https
+			if h, _, ok := strings.Cut(host, ":"); ok && !strings.HasPrefix(remote, "https://") {
+				host = h
+			}
+		}
+		u = scheme + "://" + host + "/" + path
+	case !strings.Contains(u, "://") && strings.Contains(u, ":"):
+		// scp 形式：[user@]host:path
+		host, path, _ := strings.Cut(u, ":")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if strings.ContainsAny(host, "/\\") {
+			return remote
+		}
+		u = "https://" + host + "/" + strings.TrimPrefix(path, "/")
+	default:
+		return remote
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+}
+
+// readHead 读取 HEAD，指向分支时返回 ref，分离状态时返回提交
+func (r *Repo) readHead() (ref, sha string, err error) {
+	content, err := os.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(content))
+	if ref, ok := strings.CutPrefix(head, "ref:"); ok {
+		return strings.TrimSpace(ref), "", nil
+	}
+	if !isHash(head) {
+		return "", "", fmt.Errorf("invalid HEAD %q", head)
+	}
+	return "", head, nil
+}
+
+// resolveRef 解析 ref（如 refs/heads/main）指向的对象，先查找松散 ref 再查找 packed-refs
+func (r *Repo) resolveRef(ref string) (string, error) {
+	for depth := 0; depth < maxPeelDepth; depth++ {
+		content, err := os.ReadFile(filepath.Join(r.commonDir, filepath.FromSlash(ref)))
+		if errors.Is(err, fs.ErrNotExist) {
+			refs, _, err := r.packedRefs()
+			if err != nil {
+				return "", err
+			}
+			if sha, ok := refs[ref]; ok {
+				return sha, nil
+			}
+			return "", fmt.Errorf("ref %s not found", ref)
+		}
+		if err != nil {
+			return "", err
+		}
+		value := strings.TrimSpace(string(content))
+		// 符号引用，继续解析
+		if target, ok := strings.CutPrefix(value, "ref:"); ok {
+			ref = strings.TrimSpace(target)
+			continue
+		}
+		if !isHash(value) {
+			return "", fmt.Errorf("invalid ref %s: %q", ref, value)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs for %s", ref)
+}
+
+// packedRefs 读取 packed-refs，返回 ref 到对象的映射，以及附注 tag 解析后的提交（^ 行）
+func (r *Repo) packedRefs() (refs, peeled map[string]string, err error) {
+	refs, peeled = map[string]string{}, map[string]string{}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return refs, peeled, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if last != "" {
+				peeled[last] = line[1:]
+			}
+		default:
+			sha, ref, ok := strings.Cut(line, " ")
+			if ok {
+				refs[ref] = sha
+				last = ref
+			}
+		}
+	}
+	return refs, peeled, scanner.Err()
+}
+
+// looseRefs 将 prefix 下的松散 ref 加入 refs，覆盖 packed-refs 中的同名项
+func (r *Repo) looseRefs(prefix string, refs map[string]string) error {
+	root := filepath.Join(r.commonDir, filepath.FromSlash(prefix))
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.commonDir, path)
+		if err != nil {
+			return err
+		}
+		if sha := strings.TrimSpace(string(content)); isHash(sha) {
+			refs[filepath.ToSlash(rel)] = sha
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// peel 将附注 tag 对象解析为其指向的对象，对象不是 tag 或无法读取时原样返回
+func (r *Repo) peel(sha string) string {
+	for depth := 0; depth < maxPeelDepth; depth++ {
+		typ, body, err := r.readObject(sha)
+		if err != nil || typ != "tag" {
+			return sha
+		}
+		target := ""
+		for _, line := range strings.Split(string(body), "\n") {
+			if value, ok := strings.CutPrefix(line, "object "); ok {
+				target = value
+				break
+			}
+		}
+		if !isHash(target) {
+			return sha
+		}
+		sha = target
+	}
+	return sha
+}
+
+// readObject 读取对象，返回类型和内容；松散对象不存在时在 pack 文件中查找（如 git gc 或 fetch 之后）
+func (r *Repo) readObject(sha string) (string, []byte, error) {
+	f, err := os.Open(filepath.Join(r.commonDir, "objects", sha[:2], sha[2:]))
+	if errors.Is(err, fs.ErrNotExist) {
+		return r.readPackedObject(sha)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	data, err := inflate(f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 对象格式为 "<type> <size>\x00<content>"
+	header, body, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("invalid object %s", sha)
+	}
+	typ, _, _ := strings.Cut(string(header), " ")
+	return typ, body, nil
+}
+
+// isHash 判断是否为 SHA-1 或 SHA-256 对象名
+func isHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
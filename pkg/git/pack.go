@@ -0,0 +1,263 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxDeltaDepth 读取 pack 中的对象时最多跟随的 delta 层数
+const maxDeltaDepth = 64
+
+// pack 文件中的对象类型，6 和 7 为 delta
+var packTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// errInvalidDelta 表示 pack 中的 delta 数据损坏
+var errInvalidDelta = errors.New("invalid delta")
+
+// readPackedObject 在 objects/pack 下的 pack 文件中查找对象，返回类型和内容。
+// 只支持第 2 版的索引文件（git 1.6 起的默认格式）
+func (r *Repo) readPackedObject(sha string) (string, []byte, error) {
+	id, err := hex.DecodeString(sha)
+	if err != nil {
+		return "", nil, err
+	}
+	indexes, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, index := range indexes {
+		offset, ok, err := findPackOffset(index, id)
+		if err != nil {
+			return "", nil, err
+		}
+		if !ok {
+			continue
+		}
+		f, err := os.Open(strings.TrimSuffix(index, ".idx") + ".pack")
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+		return r.readPackEntry(f, offset, len(id), 0)
+	}
+	return "", nil, fmt.Errorf("object %s not found", sha)
+}
+
+// findPackOffset 在索引文件中二分查找对象，返回对象在 pack 文件中的偏移
+func findPackOffset(path string, id []byte) (int64, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	// 索引格式：魔数、版本、256 项的 fanout 表、对象名、CRC32、4 字节偏移、8 字节偏移
+	var header [8 + 256*4]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return 0, false, fmt.Errorf("invalid pack index %s: %w", path, err)
+	}
+	if !bytes.Equal(header[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(header[4:8]) != 2 {
+		return 0, false, fmt.Errorf("unsupported pack index %s", path)
+	}
+	fanout := func(i int) int64 {
+		return int64(binary.BigEndian.Uint32(header[8+i*4:]))
+	}
+	total := fanout(255)
+	lo, hi := int64(0), fanout(int(id[0]))
+	if id[0] > 0 {
+		lo = fanout(int(id[0]) - 1)
+	}
+
+	hashLen := int64(len(id))
+	names := int64(len(header))
+	name := make([]byte, hashLen)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := f.ReadAt(name, names+mid*hashLen); err != nil {
+			return 0, false, fmt.Errorf("invalid pack index %s: %w", path, err)
+		}
+		switch c := bytes.Compare(name, id); {
+		case c < 0:
+			lo = mid + 1
+		case c > 0:
+			hi = mid
+		default:
+			offsets := names + total*(hashLen+4)
+			var b [8]byte
+			if _, err := f.ReadAt(b[:4], offsets+mid*4); err != nil {
+				return 0, false, fmt.Errorf("invalid pack index %s: %w", path, err)
+			}
+			offset := binary.BigEndian.Uint32(b[:4])
+			if offset&0x80000000 == 0 {
+				return int64(offset), true, nil
+			}
+			// 超过 2GB 的偏移存放在 8 字节偏移表中
+			if _, err := f.ReadAt(b[:], offsets+total*4+int64(offset&0x7fffffff)*8); err != nil {
+				return 0, false, fmt.Errorf("invalid pack index %s: %w", path, err)
+			}
+			return int64(binary.BigEndian.Uint64(b[:])), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// readPackEntry 读取 pack 文件中 offset 处的对象，delta 对象与其基础对象合并后返回
+func (r *Repo) readPackEntry(f *os.File, offset int64, hashLen, depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, fmt.Errorf("too many levels of deltas at offset %d of %s", offset, f.Name())
+	}
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	// 对象头：类型位于第一个字节的 4-6 位，之后为变长的大小（这里不需要）
+	c, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	typ := (c >> 4) & 7
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseType string
+	var base []byte
+	switch typ {
+	case packOfsDelta:
+		// 基础对象位于当前对象之前，距离使用 git 特有的变长编码
+		c, err := br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			distance = (distance+1)<<7 | int64(c&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return "", nil, fmt.Errorf("invalid delta base at offset %d of %s", offset, f.Name())
+		}
+		if baseType, base, err = r.readPackEntry(f, offset-distance, hashLen, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, hashLen)
+		if _, err := io.ReadFull(br, id); err != nil {
+			return "", nil, err
+		}
+		if baseType, base, err = r.readObject(hex.EncodeToString(id)); err != nil {
+			return "", nil, err
+		}
+	default:
+		name, ok := packTypes[typ]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid object type %d at offset %d of %s", typ, offset, f.Name())
+		}
+		body, err := inflate(br)
+		return name, body, err
+	}
+
+	delta, err := inflate(br)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := applyDelta(base, delta)
+	return baseType, body, err
+}
+
+// inflate 读取 zlib 压缩的数据
+func inflate(r io.Reader) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// applyDelta 将 delta 应用到 base 上。delta 以 base 和结果的大小开头，
+// 之后为复制 base 中一段内容或插入新内容的指令
+func applyDelta(base, delta []byte) ([]byte, error) {
+	size, delta, ok := deltaSize(delta)
+	if !ok || size != len(base) {
+		return nil, errInvalidDelta
+	}
+	size, delta, ok = deltaSize(delta)
+	if !ok {
+		return nil, errInvalidDelta
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// 复制：低 4 位表示偏移中存在的字节，4-6 位表示大小中存在的字节
+			var offset, n int
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errInvalidDelta
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					n |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if offset+n > len(base) {
+				return nil, errInvalidDelta
+			}
+			out = append(out, base[offset:offset+n]...)
+		case op != 0:
+			// 插入：op 为紧随其后的新内容的长度
+			if int(op) > len(delta) {
+				return nil, errInvalidDelta
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+	if len(out) != size {
+		return nil, errInvalidDelta
+	}
+	return out, nil
+}
+
+// deltaSize 读取 delta 开头的变长大小（每字节 7 位，低位在前）
+func deltaSize(delta []byte) (int, []byte, bool) {
+	size, shift := 0, 0
+	for i, c := range delta {
+		size |= int(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			return size, delta[i+1:], true
+		}
+	}
+	return 0, nil, false
+}
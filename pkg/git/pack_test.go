@@ -0,0 +1,124 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit 在 dir 中执行 git 命令，不读取用户的 git 配置
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// TestTagPacked 测试附注 tag 对象位于 pack 文件中（如 git gc、fetch 之后）而 ref 为松散 ref 时的解析
+func TestTagPacked(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "initial")
+	runGit(t, dir, "tag", "-a", "v1.2.0", "-m", "release")
+	// 只打包对象，ref 保持为松散 ref，packed-refs 中没有 ^ 行可用
+	runGit(t, dir, "repack", "-a", "-d", "-q")
+	tagSHA := runGit(t, dir, "rev-parse", "v1.2.0")
+	if _, err := os.Stat(filepath.Join(dir, ".git", "objects", tagSHA[:2], tagSHA[2:])); !os.IsNotExist(err) {
+		t.Fatalf("Expected the tag object to be packed, got %v", err)
+	}
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tag, err := repo.Tag(); err != nil || tag != "v1.2.0" {
+		t.Errorf("Expected tag v1.2.0, got %q (%v)", tag, err)
+	}
+	typ, body, err := repo.readObject(tagSHA)
+	if err != nil || typ != "tag" || !strings.Contains(string(body), "tag v1.2.0\n") {
+		t.Errorf("Expected the packed tag object, got %s %q (%v)", typ, body, err)
+	}
+	if _, _, err := repo.readObject(otherSHA); err == nil {
+		t.Error("Expected error for a missing object")
+	}
+}
+
+// TestApplyDelta 测试 delta 的复制和插入指令以及损坏的 delta
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world")
+	// base 大小 11，结果大小 9；从偏移 0 复制 6 字节，插入 "git"
+	delta := []byte{11, 9, 0x90, 6, 3, 'g', 'i', 't'}
+	out, err := applyDelta(base, delta)
+	if err != nil || string(out) != "hello git" {
+		t.Errorf("Expected %q, got %q (%v)", "hello git", out, err)
+	}
+
+	for _, delta := range [][]byte{
+		{10, 9, 0x90, 6, 3, 'g', 'i', 't'},
+		{11, 9, 0x91, 8, 6},
+		{11, 9, 0x90, 6, 5, 'g'},
+		{11, 8, 0x90, 6, 3, 'g', 'i', 't'},
+	} {
+		if _, err := applyDelta(base, delta); err != errInvalidDelta {
+			t.Errorf("Expected errInvalidDelta for %v, got %v", delta, err)
+		}
+	}
+}
+
+// TestReadPackedDelta 测试读取 pack 文件中以 delta 存储的对象
+func TestReadPackedDelta(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, strings.Repeat("line ", i%10+1))
+	}
+	for i, last := range []string{"v1", "v2"} {
+		writeFile(t, filepath.Join(dir, "app.txt"), strings.Join(append(lines, last), "\n"))
+		runGit(t, dir, "add", "app.txt")
+		runGit(t, dir, "commit", "-q", "-m", last)
+		if i == 0 {
+			runGit(t, dir, "tag", "-a", "v1", "-m", "first")
+		}
+	}
+	runGit(t, dir, "repack", "-a", "-d", "-f", "-q")
+	indexes, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if err != nil || len(indexes) != 1 {
+		t.Fatalf("Expected a single pack, got %v (%v)", indexes, err)
+	}
+	if !strings.Contains(runGit(t, dir, "verify-pack", "-v", indexes[0]), "chain length = 1") {
+		t.Fatal("Expected the pack to contain deltified objects")
+	}
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, rev := range []string{"HEAD:app.txt", "HEAD~1:app.txt", "HEAD", "HEAD~1", "v1"} {
+		sha := runGit(t, dir, "rev-parse", rev)
+		typ, body, err := repo.readObject(sha)
+		if err != nil {
+			t.Errorf("Unexpected error reading %s: %v", rev, err)
+			continue
+		}
+		if expected := runGit(t, dir, "cat-file", "-t", sha); typ != expected {
+			t.Errorf("Expected %s to be a %s, got %s", rev, expected, typ)
+		}
+		if expected := runGit(t, dir, "cat-file", typ, sha); strings.TrimSpace(string(body)) != expected {
+			t.Errorf("Unexpected content for %s: %q", rev, body)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package layer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
+)
+
+// Cache 在同一进程的多次构建之间共享层的 tar 文件，
+// 文件条目和属性相同的层只创建一次，可以并发使用
+type Cache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry 记录一个层的创建结果，并发请求同一个层时等待第一次创建完成
+type cacheEntry struct {
+	once sync.Once
+	err  error
+}
+
+// NewCache 创建一个将 tar 文件保存在 dir 中的层缓存，dir 由调用方创建和删除
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, entries: map[string]*cacheEntry{}}
+}
+
+// ProcessLayers 与 ProcessLayers 相同，但 tar 文件保存在缓存目录中，
+// 已由其他构建创建的相同层直接复用
+func (c *Cache) ProcessLayers(ctx context.Context, cfg *config.Config, srcDir string, now time.Time, log *event.Logger) ([]string, error) {
+	return processLayers(ctx, cfg, srcDir, c.dir, now, c, log)
+}
+
+// create 在 key 对应的层还未创建时调用 write 创建，返回是否由本次调用创建
+// 创建失败时，之后对同一个 key 的调用返回相同的错误
+func (c *Cache) create(key string, write func() error) (created bool, err error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cacheEntry{}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		created = true
+		e.err = write()
+	})
+	return created, e.err
+}
+
+// cacheKey 返回层的缓存键：文件条目（源路径按 srcDir 转换为绝对路径）和合并后属性的哈希，
+// 不同目录中的配置文件使用相同的相对路径时缓存键不同；层名和说明不影响 tar 文件的内容，不参与计算
+func cacheKey(entry config.LayerEntry, props config.LayerProperties, srcDir string) (string, error) {
+	files := make([]config.FileConfig, len(entry.Files))
+	for i, file := range entry.Files {
+		src, err := filepath.Abs(resolveSrc(srcDir, file.Src))
+		if err != nil {
+			return "", fmt.Errorf("resolving %s: %w", file.Src, err)
+		}
+		file.Src = src
+		files[i] = file
+	}
+	content, err := json.Marshal(struct {
+		Files      []config.FileConfig
+		Properties config.LayerProperties
+	}{files, props})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
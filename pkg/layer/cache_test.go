@@ -0,0 +1,163 @@
+package layer
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+)
+
+// TestCacheProcessLayers 测试不同构建中相同的层只创建一次
+func TestCacheProcessLayers(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "app.jar")
+	if err := os.WriteFile(src, []byte("jar"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if err := os.Mkdir(cacheDir, 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+
+	newConfig := func(name, perms string) *config.Config {
+		cfg := &config.Config{}
+		cfg.Layers.Entries = []config.LayerEntry{{
+			Name:       name,
+			Properties: config.LayerProperties{FilePermissions: perms},
+			Files:      []config.FileConfig{{Src: src, Dest: "/app/"}},
+		}}
+		return cfg
+	}
+
+	cache := NewCache(cacheDir)
+	first, err := cache.ProcessLayers(context.Background(), newConfig("app", "644"), tmpDir, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	// 层名不同但内容相同，复用同一个 tar 文件
+	second, err := cache.ProcessLayers(context.Background(), newConfig("service", "644"), tmpDir, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	if len(first) != 1 || len(second) != 1 || first[0] != second[0] {
+		t.Errorf("Expected identical layers to share a tar file, got %v and %v", first, second)
+	}
+	if filepath.Dir(first[0]) != cacheDir {
+		t.Errorf("Expected tar file in the cache dir, got %s", first[0])
+	}
+
+	// 属性不同时创建新的 tar 文件
+	third, err := cache.ProcessLayers(context.Background(), newConfig("app", "755"), tmpDir, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	if third[0] == first[0] {
+		t.Errorf("Expected a different tar file for different properties, got %s", third[0])
+	}
+}
+
+// TestCacheCreate 测试并发请求同一个层时只创建一次
+func TestCacheCreate(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	var writes, created int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := cache.create("key", func() error {
+				atomic.AddInt32(&writes, 1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("create failed: %v", err)
+			}
+			if ok {
+				atomic.AddInt32(&created, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if writes != 1 || created != 1 {
+		t.Errorf("Expected one write, got %d writes and %d creators", writes, created)
+	}
+}
+
+// TestCacheProcessLayersRelativeSrc 测试相对的 src 相对于配置文件所在目录，
+// 不同目录中相同的相对路径不共用 tar 文件
+func TestCacheProcessLayersRelativeSrc(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"api", "web"} {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, dir, "app.jar"), []byte(dir), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	newConfig := func() *config.Config {
+		cfg := &config.Config{}
+		cfg.Layers.Entries = []config.LayerEntry{{
+			Name:  "app",
+			Files: []config.FileConfig{{Src: "app.jar", Dest: "/app/"}},
+		}}
+		return cfg
+	}
+
+	cache := NewCache(t.TempDir())
+	api, err := cache.ProcessLayers(context.Background(), newConfig(), filepath.Join(tmpDir, "api"), time.Now(), nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	web, err := cache.ProcessLayers(context.Background(), newConfig(), filepath.Join(tmpDir, "web"), time.Now(), nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	if api[0] == web[0] {
+		t.Errorf("Expected different tar files for different config dirs, got %s", api[0])
+	}
+	for _, tt := range []struct {
+		path    string
+		content string
+	}{{api[0], "api"}, {web[0], "web"}} {
+		if got := tarFileContent(t, tt.path, "app/app.jar"); got != tt.content {
+			t.Errorf("Expected %s to contain %q, got %q", tt.path, tt.content, got)
+		}
+	}
+}
+
+// tarFileContent 返回 tar 文件中 name 文件的内容
+func tarFileContent(t *testing.T, tarPath, name string) string {
+	t.Helper()
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("Failed to open tar file: %v", err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("%s not found in %s", name, tarPath)
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar file: %v", err)
+		}
+		if strings.TrimPrefix(hdr.Name, "/") == name {
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", name, err)
+			}
+			return string(content)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+)
+
+// createdByPrefix 为本工具生成的层历史记录 created_by 的前缀
+const createdByPrefix = "crane-jib-tool"
+
+// LayerHistory 返回层 entry 的历史记录，created_by 描述层名称和复制的文件（源路径 -> 目标路径）
+func LayerHistory(entry config.LayerEntry, created time.Time, author string) v1.History {
+	files := make([]string, 0, len(entry.Files))
+	for _, file := range entry.Files {
+		files = append(files, fmt.Sprintf("%s -> %s", file.Src, file.Dest))
+	}
+	return v1.History{
+		Author:    author,
+		Created:   v1.Time{Time: created},
+		CreatedBy: fmt.Sprintf("%s: layer %s: %s", createdByPrefix, entry.Name, strings.Join(files, ", ")),
+		Comment:   entry.Comment,
+	}
+}
+
+// ConfigHistory 返回配置文件修改镜像配置的 empty_layer 历史记录，每个字段一条，
+// created_by 采用对应 Dockerfile 指令的写法，如 ENV、LABEL、EXPOSE
+func ConfigHistory(cfg *config.Config, created time.Time, author string) []v1.History {
+	var instructions []string
+	add := func(format string, args ...interface{}) {
+		instructions = append(instructions, fmt.Sprintf(format, args...))
+	}
+
+	if len(cfg.Environment) > 0 {
+		pairs := make([]string, 0, len(cfg.Environment))
+		for _, k := range cfg.EnvironmentKeys() {
+			pairs = append(pairs, k+"="+cfg.Environment[k])
+		}
+		add("ENV %s", strings.Join(pairs, " "))
+	}
+	if len(cfg.Labels) > 0 {
+		keys := make([]string, 0, len(cfg.Labels))
+		for k := range cfg.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", k, cfg.Labels[k]))
+		}
+		add("LABEL %s", strings.Join(pairs, " "))
+	}
+	if len(cfg.Volumes) > 0 {
+		add("VOLUME %s", jsonArray(cfg.Volumes))
+	}
+	if len(cfg.ExposedPorts) > 0 {
+		add("EXPOSE %s", strings.Join(cfg.ExposedPorts, " "))
+	}
+	if cfg.User != "" {
+		add("USER %s", cfg.User)
+	}
+	if cfg.WorkingDir != "" {
+		add("WORKDIR %s", cfg.WorkingDir)
+	}
+	if cfg.Healthcheck != nil {
+		add("HEALTHCHECK %s", jsonArray(cfg.Healthcheck.Test))
+	}
+	if cfg.StopSignal != "" {
+		add("STOPSIGNAL %s", cfg.StopSignal)
+	}
+	if len(cfg.Shell) > 0 {
+		add("SHELL %s", jsonArray(cfg.Shell))
+	}
+	for _, trigger := range cfg.OnBuild {
+		add("ONBUILD %s", trigger)
+	}
+	if len(cfg.Entrypoint) > 0 {
+		add("ENTRYPOINT %s", jsonArray(cfg.Entrypoint))
+	}
+	if len(cfg.Cmd) > 0 {
+		add("CMD %s", jsonArray(cfg.Cmd))
+	}
+
+	history := make([]v1.History, 0, len(instructions))
+	for _, instruction := range instructions {
+		history = append(history, v1.History{
+			Author:     author,
+			Created:    v1.Time{Time: created},
+			CreatedBy:  instruction,
+			EmptyLayer: true,
+		})
+	}
+	return history
+}
+
+// jsonArray 返回字符串列表的 JSON 数组形式，与 Dockerfile 的 exec 写法一致
+func jsonArray(values []string) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
@@ -0,0 +1,69 @@
+package layer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+)
+
+// TestLayerHistory 测试层历史记录描述层名称和复制的文件
+func TestLayerHistory(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := config.LayerEntry{
+		Name:    "app",
+		Comment: "application jar",
+		Files: []config.FileConfig{
+			{Src: "build/app.jar", Dest: "/app/app.jar"},
+			{Src: "res", Dest: "/app/res"},
+		},
+	}
+
+	h := LayerHistory(entry, created, "ci")
+	if h.CreatedBy != "crane-jib-tool: layer app: build/app.jar -> /app/app.jar, res -> /app/res" {
+		t.Errorf("Unexpected created_by %q", h.CreatedBy)
+	}
+	if h.Comment != "application jar" || h.Author != "ci" || !h.Created.Time.Equal(created) || h.EmptyLayer {
+		t.Errorf("Unexpected history %+v", h)
+	}
+}
+
+// TestConfigHistory 测试配置修改按 Dockerfile 指令的写法生成 empty_layer 历史记录
+func TestConfigHistory(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := &config.Config{
+		Environment:  map[string]string{"B": "2", "A": "1"},
+		Labels:       map[string]string{"version": "1.0", "team": "ops"},
+		ExposedPorts: []string{"80", "53/udp"},
+		User:         "app",
+		Healthcheck:  &config.HealthcheckConfig{Test: []string{"CMD", "true"}},
+		OnBuild:      []string{"RUN make"},
+		Entrypoint:   []string{"/app/run", "--serve"},
+	}
+
+	history := ConfigHistory(cfg, created, "")
+	var got []string
+	for _, h := range history {
+		if !h.EmptyLayer || !h.Created.Time.Equal(created) {
+			t.Errorf("Expected empty layer entry with created time, got %+v", h)
+		}
+		got = append(got, h.CreatedBy)
+	}
+	expected := []string{
+		"ENV A=1 B=2",
+		`LABEL team="ops" version="1.0"`,
+		"EXPOSE 80 53/udp",
+		"USER app",
+		`HEALTHCHECK ["CMD","true"]`,
+		"ONBUILD RUN make",
+		`ENTRYPOINT ["/app/run","--serve"]`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if history := ConfigHistory(&config.Config{}, created, ""); len(history) != 0 {
+		t.Errorf("Expected no history without config changes, got %+v", history)
+	}
+}
@@ -2,6 +2,7 @@ package layer
 
 import (
 	"archive/tar"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -11,7 +12,9 @@ import (
 	"time"
 
 	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
 	"github.com/AnonymousMister/crane-jib-tool/pkg/tarutil"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/trace"
 )
 
 // MergeProperties 合并全局属性和层级属性，层级属性优先级更高
@@ -68,44 +71,32 @@ func ExtractPlatforms(fromConfig config.FromConfig) []string {
 	return platforms
 }
 
-// ParseCreationTime 解析创建时间字符串，支持毫秒时间戳和 ISO 8601 格式
-func ParseCreationTime(creationTimeStr string) (time.Time, error) {
-	// 尝试解析为毫秒时间戳，确保整个字符串都是数字
-	var ms int64
-	if _, err := fmt.Sscanf(creationTimeStr, "%d", &ms); err == nil {
-		// 检查是否整个字符串都是数字
-		if fmt.Sprintf("%d", ms) == creationTimeStr {
-			// 转换为纳秒
-			return time.Unix(0, ms*1000000), nil
+// FileTimestamp 解析层属性中的文件时间戳，格式见 config.ParseTime，USE_CURRENT_TIMESTAMP 为 now。
+// 设置了 timestamp 时返回该时间，所有文件使用它；未设置时 timestamp 为零值，即使用文件的修改时间，
+// 此时如果设置了 SOURCE_DATE_EPOCH，maxTimestamp 为该时间，晚于它的修改时间改为它
+func FileTimestamp(props config.LayerProperties, now time.Time) (timestamp, maxTimestamp time.Time, err error) {
+	if props.Timestamp != "" {
+		if timestamp, err = config.ParseTimeAt(props.Timestamp, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid layer timestamp: %w", err)
 		}
+		return timestamp, time.Time{}, nil
 	}
-
-	// 尝试解析为 ISO 8601 格式，支持多种变体
-	formats := []string{
-		time.RFC3339,
-		"2006-01-02T15:04:05Z07:00",
-		"2006-01-02T15:04:05Z",
-		"2006-01-02 15:04:05",
-		"2006-01-02",
-	}
-
-	for _, format := range formats {
-		if ts, err := time.Parse(format, creationTimeStr); err == nil {
-			return ts, nil
-		}
+	epoch, ok, err := config.SourceDateEpoch()
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid layer timestamp: %w", err)
 	}
-
-	// 尝试解析为 RFC3339 格式，忽略时区
-	if ts, err := time.Parse("2006-01-02T15:04:05", creationTimeStr); err == nil {
-		return ts, nil
+	if ok {
+		maxTimestamp = epoch
 	}
-
-	// 解析失败，返回当前时间
-	return time.Now(), fmt.Errorf("failed to parse creation time: %s", creationTimeStr)
+	return time.Time{}, maxTimestamp, nil
 }
 
 // CreateTarLayer 创建 tar 包，确保 tar 文件不被包含在 tar 包中
 func CreateTarLayer(contentDir, tarPath string, props config.LayerProperties) error {
+	timestamp, maxTimestamp, err := FileTimestamp(props, time.Now())
+	if err != nil {
+		return err
+	}
 	// 创建 tar 包，设置相应的属性
 	if err := tarutil.CreateTar(tarPath, contentDir, tarutil.TarOptions{
 		Cwd:                  contentDir,
@@ -115,7 +106,8 @@ func CreateTarLayer(contentDir, tarPath string, props config.LayerProperties) er
 		DirectoryPermissions: props.DirectoryPermissions,
 		User:                 props.User,
 		Group:                props.Group,
-		Timestamp:            props.Timestamp,
+		Timestamp:            timestamp,
+		MaxTimestamp:         maxTimestamp,
 	}); err != nil {
 		return fmt.Errorf("creating tar layer: %w", err)
 	}
@@ -198,8 +190,8 @@ func ShouldIncludeFile(filePath string, excludes, includes []string) bool {
 	return true
 }
 
-// copyDirWithFilter 递归复制目录，应用 excludes 和 includes 过滤规则
-func copyDirWithFilter(srcDir, destDir string, excludes, includes []string) error {
+// copyDirWithFilter 递归复制目录，应用 excludes 和 includes 过滤规则，跳过的文件通过 log 报告
+func copyDirWithFilter(srcDir, destDir string, excludes, includes []string, log *event.Logger) error {
 	// 遍历源目录
 	walkErr := filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -221,7 +213,7 @@ func copyDirWithFilter(srcDir, destDir string, excludes, includes []string) erro
 		} else {
 			// 检查是否应该包含该文件
 			if !ShouldIncludeFile(relPath, excludes, includes) {
-				fmt.Printf("   🚫 Skipping excluded: %s\n", filePath)
+				log.Info("layer.skip", fmt.Sprintf("Skipping excluded: %s", filePath), event.Fields{"path": filePath})
 				return nil
 			}
 
@@ -267,9 +259,24 @@ func copyFile(src, dest string) error {
 	return os.Chmod(dest, srcInfo.Mode())
 }
 
-// ProcessLayers 处理所有层，创建 tar 文件并返回层路径列表
-func ProcessLayers(cfg *config.Config, rootTmpDir string) ([]string, error) {
-	layerPaths := make([]string, 0, len(cfg.Layers.Entries))
+// ProcessLayers 处理所有层，创建 tar 文件并返回层路径列表，相对的 src 相对于 srcDir（通常为配置文件所在目录）
+// now 为构建的当前时间，层属性 timestamp 为 USE_CURRENT_TIMESTAMP 时使用；
+// log 为 nil 时不输出事件；ctx 中有 tracer 时为每个层记录一个 span
+func ProcessLayers(ctx context.Context, cfg *config.Config, srcDir, rootTmpDir string, now time.Time, log *event.Logger) ([]string, error) {
+	return processLayers(ctx, cfg, srcDir, rootTmpDir, now, nil, log)
+}
+
+// processLayers 在 dir 中创建所有层的 tar 文件，cache 不为 nil 时 dir 为缓存目录，
+// 配置相同的层只创建一次
+func processLayers(ctx context.Context, cfg *config.Config, srcDir, dir string, now time.Time, cache *Cache, log *event.Logger) (layerPaths []string, err error) {
+	layerPaths = make([]string, 0, len(cfg.Layers.Entries))
+
+	// 当前层的 span，出错时标记失败
+	var span *trace.Span
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 
 	if len(cfg.Layers.Entries) == 0 {
 		return layerPaths, nil
@@ -288,118 +295,127 @@ func ProcessLayers(cfg *config.Config, rootTmpDir string) ([]string, error) {
 		// 合并全局属性和层级属性
 		mergedProps := MergeProperties(cfg.Layers.Properties, layerEntry.Properties)
 
-		// 创建 tar 文件路径
-		layerTarPath := filepath.Join(rootTmpDir, fmt.Sprintf("%s.tar", layerEntry.Name))
-		fmt.Printf("   📦 Creating layer: %s -> %s\n", layerEntry.Name, layerTarPath)
-
-		// 创建 tar 文件
-		dstFile, err := os.Create(layerTarPath)
+		// 创建 tar 文件路径，使用缓存时以层配置的哈希命名
+		layerTarPath := filepath.Join(dir, fmt.Sprintf("%s.tar", layerEntry.Name))
+		var key string
+		if cache != nil {
+			if key, err = cacheKey(layerEntry, mergedProps, srcDir); err != nil {
+				return nil, err
+			}
+			layerTarPath = filepath.Join(dir, key+".tar")
+		}
+		_, span = trace.Start(ctx, "layer", trace.String("layer.name", layerEntry.Name))
+		step := log.Start("layer.create", fmt.Sprintf("Creating layer: %s -> %s", layerEntry.Name, layerTarPath), event.Fields{"layer": layerEntry.Name, "path": layerTarPath})
+
+		created := true
+		if cache != nil {
+			created, err = cache.create(key, func() error {
+				return writeLayer(layerEntry, mergedProps, srcDir, layerTarPath, now, log)
+			})
+		} else {
+			err = writeLayer(layerEntry, mergedProps, srcDir, layerTarPath, now, log)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to create tar file %s: %w", layerTarPath, err)
+			return nil, err
 		}
 
-		// 创建 tar writer
-		w := tar.NewWriter(dstFile)
+		// 添加到层路径列表
+		layerPaths = append(layerPaths, layerTarPath)
+		fields := event.Fields{}
+		if info, err := os.Stat(layerTarPath); err == nil {
+			fields["size"] = info.Size()
+			span.SetAttributes(trace.Int("layer.size", info.Size()))
+		}
+		msg := ""
+		if !created {
+			msg = fmt.Sprintf("Reusing identical layer %s from another build", layerEntry.Name)
+			fields["cached"] = true
+			span.SetAttributes(trace.Bool("layer.cached", true))
+		}
+		step.Done(msg, fields)
+		span.End()
+	}
 
-		// 处理每个文件条目
-		for _, file := range layerEntry.Files {
-			// 获取源文件信息
-			srcInfo, err := os.Stat(file.Src)
-			if err != nil {
-				dstFile.Close()
-				os.Remove(layerTarPath)
-				return nil, fmt.Errorf("failed to stat file %s: %w", file.Src, err)
-			}
-			mergedProps := MergeProperties(mergedProps, file.Properties)
-			// 准备 tar 选项
-			tarOptions := tarutil.TarOptions{
-				PreservePermissions:  false,
-				FilePermissions:      mergedProps.FilePermissions,
-				DirectoryPermissions: mergedProps.DirectoryPermissions,
-				User:                 mergedProps.User,
-				Group:                mergedProps.Group,
-				Timestamp:            mergedProps.Timestamp,
-			}
+	return layerPaths, nil
+}
 
-			// 根据文件类型处理
-			if srcInfo.IsDir() {
-				// 源是目录，需要递归添加
-				// 计算目标路径前缀（去掉末尾的/如果有的话）
-				destPrefix := file.Dest
-				if strings.HasSuffix(destPrefix, "/") {
-					destPrefix = destPrefix[:len(destPrefix)-1]
-				}
+// writeLayer 按层配置将文件写入 tar 文件 layerTarPath，出错时删除未完成的文件
+func writeLayer(entry config.LayerEntry, mergedProps config.LayerProperties, srcDir, layerTarPath string, now time.Time, log *event.Logger) error {
+	// 创建 tar 文件
+	dstFile, err := os.Create(layerTarPath)
+	if err != nil {
+		return fmt.Errorf("failed to create tar file %s: %w", layerTarPath, err)
+	}
 
-				// 遍历目录并添加到 tar
-				walkErr := filepath.Walk(file.Src, func(filePath string, info os.FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
+	// 创建 tar writer
+	w := tar.NewWriter(dstFile)
 
-					// 相对于源目录的路径
-					relPath, err := filepath.Rel(file.Src, filePath)
-					if err != nil {
-						return err
-					}
+	// 处理每个文件条目
+	for _, file := range entry.Files {
+		file.Src = resolveSrc(srcDir, file.Src)
+		// 获取源文件信息
+		srcInfo, err := os.Stat(file.Src)
+		if err != nil {
+			dstFile.Close()
+			os.Remove(layerTarPath)
+			return fmt.Errorf("failed to stat file %s: %w", file.Src, err)
+		}
+		mergedProps := MergeProperties(mergedProps, file.Properties)
+		timestamp, maxTimestamp, err := FileTimestamp(mergedProps, now)
+		if err != nil {
+			dstFile.Close()
+			os.Remove(layerTarPath)
+			return err
+		}
+		// 准备 tar 选项
+		tarOptions := tarutil.TarOptions{
+			PreservePermissions:  false,
+			FilePermissions:      mergedProps.FilePermissions,
+			DirectoryPermissions: mergedProps.DirectoryPermissions,
+			User:                 mergedProps.User,
+			Group:                mergedProps.Group,
+			Timestamp:            timestamp,
+			MaxTimestamp:         maxTimestamp,
+		}
 
-					// 检查是否应该包含该文件
-					if !ShouldIncludeFile(relPath, file.Excludes, file.Includes) {
-						fmt.Printf("   🚫 Skipping excluded: %s\n", filePath)
-						if info.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
+		// 根据文件类型处理
+		if srcInfo.IsDir() {
+			// 源是目录，需要递归添加
+			// 计算目标路径前缀（去掉末尾的/如果有的话）
+			destPrefix := file.Dest
+			if strings.HasSuffix(destPrefix, "/") {
+				destPrefix = destPrefix[:len(destPrefix)-1]
+			}
 
-					// 构建 tar 中的目标路径
-					var tarPath string
-					if relPath == "." {
-						// 根目录，直接使用目标前缀
-						tarPath = destPrefix
-					} else {
-						// 子文件/目录，添加到目标前缀下
-						tarPath = filepath.Join(destPrefix, relPath)
-					}
+			// 遍历目录并添加到 tar
+			walkErr := filepath.Walk(file.Src, func(filePath string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
 
-					// 转换为 tar 格式的路径（使用正斜杠）
-					tarPath = filepath.ToSlash(tarPath)
-					// 处理 Windows 驱动器号（如 C:\ -> /C/）
-					if len(tarPath) > 1 && tarPath[1] == ':' {
-						tarPath = "/" + strings.ToUpper(string(tarPath[0])) + tarPath[2:]
-					}
-					// 确保所有反斜杠都被转换为正斜杠
-					tarPath = strings.ReplaceAll(tarPath, "\\", "/")
+				// 相对于源目录的路径
+				relPath, err := filepath.Rel(file.Src, filePath)
+				if err != nil {
+					return err
+				}
 
-					// 添加文件到 tar
-					if err := addFileToTarWithPath(w, filePath, tarPath, info, tarOptions); err != nil {
-						return fmt.Errorf("failed to add file %s to tar: %w", filePath, err)
+				// 检查是否应该包含该文件
+				if !ShouldIncludeFile(relPath, file.Excludes, file.Includes) {
+					log.Info("layer.skip", fmt.Sprintf("Skipping excluded: %s", filePath), event.Fields{"layer": entry.Name, "path": filePath})
+					if info.IsDir() {
+						return filepath.SkipDir
 					}
-
 					return nil
-				})
-
-				if walkErr != nil {
-					w.Close()
-					dstFile.Close()
-					os.Remove(layerTarPath)
-					return nil, fmt.Errorf("failed to walk directory %s: %w", file.Src, walkErr)
-				}
-			} else {
-				// 源是文件，直接添加
-				// 检查是否应该包含该文件
-				if !ShouldIncludeFile(filepath.Base(file.Src), file.Excludes, file.Includes) {
-					fmt.Printf("   🚫 Skipping excluded: %s\n", file.Src)
-					continue
 				}
 
 				// 构建 tar 中的目标路径
 				var tarPath string
-				if strings.HasSuffix(file.Dest, "/") {
-					// 目标是目录，使用源文件名
-					tarPath = filepath.Join(file.Dest, filepath.Base(file.Src))
+				if relPath == "." {
+					// 根目录，直接使用目标前缀
+					tarPath = destPrefix
 				} else {
-					// 目标是文件，直接使用
-					tarPath = file.Dest
+					// 子文件/目录，添加到目标前缀下
+					tarPath = filepath.Join(destPrefix, relPath)
 				}
 
 				// 转换为 tar 格式的路径（使用正斜杠）
@@ -412,33 +428,77 @@ func ProcessLayers(cfg *config.Config, rootTmpDir string) ([]string, error) {
 				tarPath = strings.ReplaceAll(tarPath, "\\", "/")
 
 				// 添加文件到 tar
-				if err := addFileToTarWithPath(w, file.Src, tarPath, srcInfo, tarOptions); err != nil {
-					w.Close()
-					dstFile.Close()
-					os.Remove(layerTarPath)
-					return nil, fmt.Errorf("failed to add file %s to tar: %w", file.Src, err)
+				if err := addFileToTarWithPath(w, filePath, tarPath, info, tarOptions); err != nil {
+					return fmt.Errorf("failed to add file %s to tar: %w", filePath, err)
 				}
+
+				return nil
+			})
+
+			if walkErr != nil {
+				w.Close()
+				dstFile.Close()
+				os.Remove(layerTarPath)
+				return fmt.Errorf("failed to walk directory %s: %w", file.Src, walkErr)
+			}
+		} else {
+			// 源是文件，直接添加
+			// 检查是否应该包含该文件
+			if !ShouldIncludeFile(filepath.Base(file.Src), file.Excludes, file.Includes) {
+				log.Info("layer.skip", fmt.Sprintf("Skipping excluded: %s", file.Src), event.Fields{"layer": entry.Name, "path": file.Src})
+				continue
 			}
-		}
 
-		// 关闭 tar writer
-		if err := w.Close(); err != nil {
-			dstFile.Close()
-			os.Remove(layerTarPath)
-			return nil, fmt.Errorf("failed to close tar writer: %w", err)
-		}
+			// 构建 tar 中的目标路径
+			var tarPath string
+			if strings.HasSuffix(file.Dest, "/") {
+				// 目标是目录，使用源文件名
+				tarPath = filepath.Join(file.Dest, filepath.Base(file.Src))
+			} else {
+				// 目标是文件，直接使用
+				tarPath = file.Dest
+			}
 
-		// 关闭目标文件
-		if err := dstFile.Close(); err != nil {
-			os.Remove(layerTarPath)
-			return nil, fmt.Errorf("failed to close tar file: %w", err)
+			// 转换为 tar 格式的路径（使用正斜杠）
+			tarPath = filepath.ToSlash(tarPath)
+			// 处理 Windows 驱动器号（如 C:\ -> /C/）
+			if len(tarPath) > 1 && tarPath[1] == ':' {
+				tarPath = "/" + strings.ToUpper(string(tarPath[0])) + tarPath[2:]
+			}
+			// 确保所有反斜杠都被转换为正斜杠
+			tarPath = strings.ReplaceAll(tarPath, "\\", "/")
+
+			// 添加文件到 tar
+			if err := addFileToTarWithPath(w, file.Src, tarPath, srcInfo, tarOptions); err != nil {
+				w.Close()
+				dstFile.Close()
+				os.Remove(layerTarPath)
+				return fmt.Errorf("failed to add file %s to tar: %w", file.Src, err)
+			}
 		}
+	}
 
-		// 添加到层路径列表
-		layerPaths = append(layerPaths, layerTarPath)
+	// 关闭 tar writer
+	if err := w.Close(); err != nil {
+		dstFile.Close()
+		os.Remove(layerTarPath)
+		return fmt.Errorf("failed to close tar writer: %w", err)
 	}
 
-	return layerPaths, nil
+	// 关闭目标文件
+	if err := dstFile.Close(); err != nil {
+		os.Remove(layerTarPath)
+		return fmt.Errorf("failed to close tar file: %w", err)
+	}
+	return nil
+}
+
+// resolveSrc 返回文件条目的源路径，相对路径相对于 srcDir
+func resolveSrc(srcDir, src string) string {
+	if filepath.IsAbs(src) {
+		return src
+	}
+	return filepath.Join(srcDir, src)
 }
 
 // addFileToTarWithPath 将文件添加到 tar 包，支持自定义 tar 内路径
@@ -513,25 +573,16 @@ func addFileToTarWithPath(w *tar.Writer, filePath, tarPath string, info os.FileI
 		}
 	}
 
-	// 设置修改时间
-	if opt.Timestamp != "" {
-		// 尝试解析为时间戳（毫秒）
-		var ms int64
-		if _, err := fmt.Sscanf(opt.Timestamp, "%d", &ms); err == nil {
-			// 转换为纳秒
-			timestamp := time.Unix(0, ms*1000000)
-			header.ModTime = timestamp
-			header.AccessTime = timestamp
-			header.ChangeTime = timestamp
-		} else {
-			// 尝试解析为 ISO 8601 格式
-			if ts, err := time.Parse(time.RFC3339, opt.Timestamp); err == nil {
-				header.ModTime = ts
-				header.AccessTime = ts
-				header.ChangeTime = ts
-			}
-			// 解析失败则使用文件的修改时间（已在 FileInfoHeader 中设置）
-		}
+	// 设置修改时间，未设置时使用文件的修改时间（已在 FileInfoHeader 中设置），不晚于 MaxTimestamp
+	switch {
+	case !opt.Timestamp.IsZero():
+		header.ModTime = opt.Timestamp
+		header.AccessTime = opt.Timestamp
+		header.ChangeTime = opt.Timestamp
+	case !opt.MaxTimestamp.IsZero() && header.ModTime.After(opt.MaxTimestamp):
+		header.ModTime = opt.MaxTimestamp
+		header.AccessTime = opt.MaxTimestamp
+		header.ChangeTime = opt.MaxTimestamp
 	}
 
 	// 写入 tar 头
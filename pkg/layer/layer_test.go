@@ -1,12 +1,17 @@
 package layer
 
 import (
+	"archive/tar"
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/AnonymousMister/crane-jib-tool/pkg/event"
 )
 
 // TestExtractPlatforms 测试提取平台信息功能
@@ -68,39 +73,6 @@ func TestExtractPlatforms(t *testing.T) {
 	}
 }
 
-// TestParseCreationTime 测试解析创建时间功能
-func TestParseCreationTime(t *testing.T) {
-	// 测试用例：毫秒时间戳
-	ts, err := ParseCreationTime("1000")
-	if err != nil {
-		t.Errorf("Expected no error parsing 1000, got %v", err)
-	}
-	expected := ts.UnixNano()
-	if expected != 1000*1000000 {
-		t.Errorf("Expected %d, got %d", 1000*1000000, expected)
-	}
-
-	// 测试用例：ISO 8601 格式
-	ts, err = ParseCreationTime("2020-01-01T00:00:00Z")
-	if err != nil {
-		t.Errorf("Expected no error parsing ISO 8601 date, got %v", err)
-	}
-	// 验证年份和月份
-	if ts.Year() != 2020 || ts.Month() != 1 || ts.Day() != 1 {
-		t.Errorf("Expected 2020-01-01, got %v", ts)
-	}
-
-	// 测试用例：无效格式
-	ts, err = ParseCreationTime("invalid-date")
-	if err == nil {
-		t.Error("Expected error parsing invalid date")
-	}
-	// 应该返回当前时间
-	if ts.IsZero() {
-		t.Error("Expected non-zero time for invalid date")
-	}
-}
-
 // TestMergeProperties 测试合并属性功能
 func TestMergeProperties(t *testing.T) {
 	globalProps := config.LayerProperties{
@@ -233,6 +205,101 @@ func TestCreateTarLayer(t *testing.T) {
 	}
 }
 
+// TestFileTimestamp 测试层时间戳的解析和 SOURCE_DATE_EPOCH 上限
+func TestFileTimestamp(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Setenv(config.EnvSourceDateEpoch, "")
+	if ts, max, err := FileTimestamp(config.LayerProperties{}, now); err != nil || !ts.IsZero() || !max.IsZero() {
+		t.Errorf("Expected zero times without timestamp, got %v, %v (%v)", ts, max, err)
+	}
+	if ts, _, err := FileTimestamp(config.LayerProperties{Timestamp: "EPOCH_PLUS_SECOND"}, now); err != nil || ts.Unix() != 1 {
+		t.Errorf("Expected EPOCH_PLUS_SECOND, got %v (%v)", ts, err)
+	}
+	if ts, _, err := FileTimestamp(config.LayerProperties{Timestamp: "USE_CURRENT_TIMESTAMP"}, now); err != nil || !ts.Equal(now) {
+		t.Errorf("Expected the build time, got %v (%v)", ts, err)
+	}
+	if _, _, err := FileTimestamp(config.LayerProperties{Timestamp: "later"}, now); err == nil {
+		t.Error("Expected error for invalid timestamp")
+	}
+
+	// SOURCE_DATE_EPOCH 只作为修改时间的上限，设置了 timestamp 时不生效
+	t.Setenv(config.EnvSourceDateEpoch, "1700000000")
+	if ts, max, err := FileTimestamp(config.LayerProperties{}, now); err != nil || !ts.IsZero() || max.Unix() != 1700000000 {
+		t.Errorf("Expected SOURCE_DATE_EPOCH as the upper bound, got %v, %v (%v)", ts, max, err)
+	}
+	if ts, max, err := FileTimestamp(config.LayerProperties{Timestamp: "EPOCH"}, now); err != nil || ts.Unix() != 0 || !max.IsZero() {
+		t.Errorf("Expected EPOCH without an upper bound, got %v, %v (%v)", ts, max, err)
+	}
+}
+
+// TestProcessLayersTimestamps 测试 SOURCE_DATE_EPOCH 只将较新的修改时间改为该时间，
+// USE_CURRENT_TIMESTAMP 的所有文件使用构建时间
+func TestProcessLayersTimestamps(t *testing.T) {
+	srcDir := t.TempDir()
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"old.txt", "new.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(srcDir, "old.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	newConfig := func(timestamp string) *config.Config {
+		return &config.Config{Layers: config.LayerConfig{Entries: []config.LayerEntry{{
+			Name:       "app",
+			Properties: config.LayerProperties{Timestamp: timestamp},
+			Files: []config.FileConfig{
+				{Src: "old.txt", Dest: "/app/"},
+				{Src: "new.txt", Dest: "/app/"},
+			},
+		}}}}
+	}
+
+	t.Setenv(config.EnvSourceDateEpoch, "1700000000")
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	paths, err := ProcessLayers(context.Background(), newConfig(""), srcDir, t.TempDir(), now, nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	times := tarModTimes(t, paths[0])
+	if !times["app/old.txt"].Equal(old) || times["app/new.txt"].Unix() != 1700000000 {
+		t.Errorf("Expected the old mtime kept and the new one clamped, got %v", times)
+	}
+
+	paths, err = ProcessLayers(context.Background(), newConfig("USE_CURRENT_TIMESTAMP"), srcDir, t.TempDir(), now, nil)
+	if err != nil {
+		t.Fatalf("ProcessLayers failed: %v", err)
+	}
+	for name, mtime := range tarModTimes(t, paths[0]) {
+		if !mtime.Equal(now) {
+			t.Errorf("Expected %s to use the build time, got %v", name, mtime)
+		}
+	}
+}
+
+// tarModTimes 返回 tar 文件中每个文件的修改时间
+func tarModTimes(t *testing.T, tarPath string) map[string]time.Time {
+	t.Helper()
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("Failed to open tar file: %v", err)
+	}
+	defer f.Close()
+	times := make(map[string]time.Time)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return times
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar file: %v", err)
+		}
+		times[strings.TrimPrefix(hdr.Name, "/")] = hdr.ModTime
+	}
+}
+
 // TestCopyFile 测试复制文件功能
 func TestCopyFile(t *testing.T) {
 	// 创建临时目录用于测试
@@ -304,9 +371,14 @@ func TestCopyDirWithFilter(t *testing.T) {
 	// 测试用例：只复制 txt 文件
 	excludes := []string{"*.md"}
 	includes := []string{"*.txt", "**/*.txt"}
-	if err := copyDirWithFilter(srcDir, dstDir, excludes, includes); err != nil {
+	var logs strings.Builder
+	if err := copyDirWithFilter(srcDir, dstDir, excludes, includes, event.New(&logs)); err != nil {
 		t.Fatalf("Failed to copy dir with filter: %v", err)
 	}
+	// 跳过的文件通过日志报告
+	if msg := "Skipping excluded: " + filepath.Join(srcDir, "file2.md"); !strings.Contains(logs.String(), msg) {
+		t.Errorf("Expected %q in the log, got:\n%s", msg, logs.String())
+	}
 
 	// 验证复制结果
 	expectedFiles := []string{
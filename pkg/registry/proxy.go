@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+)
+
+// ProxyDecision 记录了某个请求最终使用的代理及原因
+type ProxyDecision struct {
+	// URL 使用的代理地址，为 nil 表示直连
+	URL *url.URL
+	// Reason 选择该代理的原因，用于调试日志
+	Reason string
+}
+
+// String 返回便于日志输出的代理决策描述（不包含代理密码）
+func (d ProxyDecision) String() string {
+	if d.URL == nil {
+		return fmt.Sprintf("direct (%s)", d.Reason)
+	}
+	return fmt.Sprintf("%s (%s)", d.URL.Redacted(), d.Reason)
+}
+
+// ResolveProxy 计算请求 target 应使用的代理
+// override 为仓库级代理配置，设置后替代 global；两者都为空时使用环境变量 HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+func ResolveProxy(target *url.URL, global config.ProxyConfig, override *config.ProxyConfig) (ProxyDecision, error) {
+	pc := global
+	source := "global"
+	if override != nil {
+		pc = *override
+		source = "registry"
+	}
+
+	if pc.IsZero() {
+		u, err := http.ProxyFromEnvironment(&http.Request{URL: target})
+		if err != nil {
+			return ProxyDecision{}, err
+		}
+		return ProxyDecision{URL: u, Reason: "environment"}, nil
+	}
+
+	if MatchNoProxy(target.Host, pc.NoProxy) {
+		return ProxyDecision{Reason: source + " noProxy"}, nil
+	}
+
+	raw := pc.HTTP
+	if target.Scheme == "https" && pc.HTTPS != "" {
+		raw = pc.HTTPS
+	}
+	if raw == "" {
+		return ProxyDecision{Reason: source + " proxy not set for " + target.Scheme}, nil
+	}
+
+	u, err := parseProxyURL(raw, pc)
+	if err != nil {
+		return ProxyDecision{}, err
+	}
+	return ProxyDecision{URL: u, Reason: source}, nil
+}
+
+// ValidateProxy 检查代理配置中的地址是否合法
+func ValidateProxy(pc config.ProxyConfig) error {
+	for _, raw := range []string{pc.HTTP, pc.HTTPS} {
+		if raw == "" {
+			continue
+		}
+		if _, err := parseProxyURL(raw, pc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseProxyURL 解析代理地址，缺省协议为 http，并附加代理认证信息
+func parseProxyURL(raw string, pc config.ProxyConfig) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy address %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %q", u.Scheme, raw)
+	}
+	if pc.Username != "" && u.User == nil {
+		u.User = url.UserPassword(pc.Username, pc.Password)
+	}
+	return u, nil
+}
+
+// MatchNoProxy 检查 host 是否匹配 noProxy 列表中的任一模式
+func MatchNoProxy(host string, patterns []string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	ip := net.ParseIP(hostname)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == "*" {
+			return true
+		}
+
+		// 带端口的模式需要完整匹配 host:port
+		if _, _, err := net.SplitHostPort(pattern); err == nil {
+			if pattern == strings.ToLower(host) {
+				return true
+			}
+			continue
+		}
+
+		// IP 和 CIDR
+		if _, cidr, err := net.ParseCIDR(pattern); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if patternIP := net.ParseIP(pattern); patternIP != nil {
+			if ip != nil && patternIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		// 域名后缀：*.example.com、.example.com 和 example.com 都匹配其子域名
+		pattern = strings.TrimPrefix(pattern, "*")
+		pattern = strings.TrimPrefix(pattern, ".")
+		if hostname == pattern || strings.HasSuffix(hostname, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+// Package registry 提供按镜像仓库区分的连接配置（TLS、HTTP、代理等）
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Transport 根据请求的目标仓库，将请求分发给单独配置的 http.Transport
+type Transport struct {
+	base *http.Transport
+
+	mu         sync.RWMutex
+	proxy      config.ProxyConfig
+	registries map[string]config.RegistryConfig
+	transports map[string]http.RoundTripper
+
+	// logged 记录已输出过代理决策的主机，避免重复日志
+	logged sync.Map
+}
+
+// NewTransport 创建一个分发 Transport，未配置的仓库使用 base
+// base 的代理设置会被替换为按仓库计算的代理
+func NewTransport(base *http.Transport) *Transport {
+	t := &Transport{
+		base:       base,
+		registries: map[string]config.RegistryConfig{},
+		transports: map[string]http.RoundTripper{},
+	}
+	base.Proxy = t.resolveProxy
+	return t
+}
+
+// Clone 返回 t 的副本，副本上的 SetProxy 和 Configure 不影响 t，
+// 用于为一次构建单独应用配置文件中的仓库配置（见 WithContext）
+func (t *Transport) Clone() *Transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	c := NewTransport(t.base.Clone())
+	c.proxy = t.proxy
+	for key, rc := range t.registries {
+		c.registries[key] = rc
+	}
+	// 仓库的 Transport 复制自 t.base，代理需要改为按 c 的配置计算
+	for key, rt := range t.transports {
+		transport := rt.(*http.Transport).Clone()
+		transport.Proxy = c.resolveProxy
+		c.transports[key] = transport
+	}
+	return c
+}
+
+// contextKey 为 WithContext 在 context 中使用的键
+type contextKey struct{}
+
+// WithContext 返回携带 t 的 context。Transport 收到使用该 context 的请求时交给 t 处理，
+// 使共用的 Transport 链（认证、限流等）可以为每次构建使用不同的仓库配置
+func WithContext(ctx context.Context, t *Transport) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// SetProxy 设置全局代理配置，未配置仓库级代理的请求使用该配置
+func (t *Transport) SetProxy(pc config.ProxyConfig) error {
+	if err := ValidateProxy(pc); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.proxy = pc
+	return nil
+}
+
+// Configure 合并仓库配置，后设置的配置优先级更高
+// 每个仓库的 TLS 配置会立即构建，以便尽早暴露证书文件错误
+func (t *Transport) Configure(regs map[string]config.RegistryConfig) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for host, rc := range regs {
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("registry %s: %w", host, err)
+		}
+		if rc.Proxy != nil {
+			if err := ValidateProxy(*rc.Proxy); err != nil {
+				return fmt.Errorf("registry %s: proxy: %w", host, err)
+			}
+		}
+		key := normalizeHost(host)
+		merged := t.registries[key].Merge(rc)
+
+		rt, err := t.newTransport(merged)
+		if err != nil {
+			return fmt.Errorf("registry %s: %w", host, err)
+		}
+		t.registries[key] = merged
+		t.transports[key] = rt
+	}
+	return nil
+}
+
+// Lookup 返回指定仓库的配置，找不到时返回 false
+func (t *Transport) Lookup(registry string) (config.RegistryConfig, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	key, ok := t.match(normalizeHost(registry))
+	if !ok {
+		return config.RegistryConfig{}, false
+	}
+	return t.registries[key], true
+}
+
+// NameOptions 返回解析指向该仓库的镜像引用时需要附加的 name.Option
+func (t *Transport) NameOptions(registry string) []name.Option {
+	rc, ok := t.Lookup(registry)
+	if !ok {
+		return nil
+	}
+	if rc.Insecure || rc.PlainHTTP {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+// RoundTrip 实现了 http.RoundTripper 接口，请求的 context 携带其他 Transport 时交给它处理
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if other, ok := req.Context().Value(contextKey{}).(*Transport); ok && other != t {
+		return other.RoundTrip(req)
+	}
+
+	t.mu.RLock()
+	rt := http.RoundTripper(t.base)
+	if key, ok := t.match(req.URL.Host); ok {
+		rt = t.transports[key]
+	}
+	t.mu.RUnlock()
+
+	return rt.RoundTrip(req)
+}
+
+// resolveProxy 实现了 http.Transport.Proxy，按请求的目标仓库选择代理
+func (t *Transport) resolveProxy(req *http.Request) (*url.URL, error) {
+	t.mu.RLock()
+	global := t.proxy
+	var override *config.ProxyConfig
+	if key, ok := t.match(req.URL.Host); ok {
+		override = t.registries[key].Proxy
+	}
+	t.mu.RUnlock()
+
+	decision, err := ResolveProxy(req.URL, global, override)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个主机只输出一次代理决策
+	msg := decision.String()
+	if prev, loaded := t.logged.Swap(req.URL.Host, msg); !loaded || prev != msg {
+		logs.Debug.Printf("proxy for %s: %s", req.URL.Host, msg)
+	}
+	return decision.URL, nil
+}
+
+// match 查找与 host 对应的配置键，先精确匹配，再忽略端口匹配
+// 调用方需持有锁
+func (t *Transport) match(host string) (string, bool) {
+	if _, ok := t.registries[host]; ok {
+		return host, true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if _, ok := t.registries[hostname]; ok {
+			return hostname, true
+		}
+	}
+	return "", false
+}
+
+// newTransport 基于 base 创建应用了仓库配置的 http.Transport
+func (t *Transport) newTransport(rc config.RegistryConfig) (http.RoundTripper, error) {
+	transport := t.base.Clone()
+	tlsConfig, err := TLSConfig(transport.TLSClientConfig, rc)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// TLSConfig 在 base 的基础上应用仓库的 TLS 配置
+func TLSConfig(base *tls.Config, rc config.RegistryConfig) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	if base != nil {
+		tlsConfig = base.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+
+	if rc.Insecure {
+		tlsConfig.InsecureSkipVerify = true //nolint: gosec
+	}
+
+	// 追加自定义 CA 证书
+	if len(rc.CACerts) > 0 {
+		pool := tlsConfig.RootCAs
+		if pool == nil {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				systemPool = x509.NewCertPool()
+			}
+			pool = systemPool
+		} else {
+			pool = pool.Clone()
+		}
+		for _, caFile := range rc.CACerts {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle %s: %w", caFile, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 加载客户端证书（双向 TLS）
+	if rc.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(rc.ClientCert, rc.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %w", rc.ClientCert, err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+
+	return tlsConfig, nil
+}
+
+// normalizeHost 规范化仓库地址，例如 docker.io 会被转换为 index.docker.io
+func normalizeHost(host string) string {
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return host
+	}
+	return reg.RegistryStr()
+}
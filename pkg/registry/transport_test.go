@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnonymousMister/crane-jib-tool/pkg/config"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// writeServerCA 将测试服务器的证书写入 PEM 文件
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, content, 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	return caFile
+}
+
+// TestTransportCACerts 测试按仓库追加 CA 证书
+func TestTransportCACerts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	// 测试用例：未配置 CA 时证书校验失败
+	rt := NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+	client := &http.Client{Transport: rt}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("Expected certificate error without CA bundle, got nil")
+	}
+
+	// 测试用例：配置 CA 后请求成功
+	rt = NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+	if err := rt.Configure(map[string]config.RegistryConfig{
+		u.Host: {CACerts: []string{writeServerCA(t, server)}},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client = &http.Client{Transport: rt}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// TestTransportClone 测试副本继承已有的仓库配置，副本上的配置不影响原 Transport，
+// 以及通过 context 将请求交给副本处理
+func TestTransportClone(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	get := func(rt http.RoundTripper, ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	rt := NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+	if err := rt.Configure(map[string]config.RegistryConfig{
+		u.Host: {CACerts: []string{writeServerCA(t, server)}},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	trusted := rt.Clone()
+	if err := get(trusted, context.Background()); err != nil {
+		t.Errorf("Expected the clone to keep the CA bundle, got %v", err)
+	}
+
+	// 测试用例：副本上的 insecure 不影响原 Transport
+	rt = NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+	insecure := rt.Clone()
+	if err := insecure.Configure(map[string]config.RegistryConfig{u.Host: {Insecure: true}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := get(insecure, context.Background()); err != nil {
+		t.Errorf("Expected the insecure clone to skip verification, got %v", err)
+	}
+	if err := get(rt, context.Background()); err == nil {
+		t.Error("Expected certificate error from the original transport, got nil")
+	}
+	if _, ok := rt.Lookup(u.Host); ok {
+		t.Error("Expected the original transport to have no settings for the registry")
+	}
+
+	// 测试用例：context 中的副本处理经过原 Transport 的请求
+	if err := get(rt, WithContext(context.Background(), insecure)); err != nil {
+		t.Errorf("Expected the request to use the clone from the context, got %v", err)
+	}
+}
+
+// TestTransportConfigureErrors 测试错误的仓库配置
+func TestTransportConfigureErrors(t *testing.T) {
+	rt := NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+
+	// 测试用例：CA 文件不存在
+	err := rt.Configure(map[string]config.RegistryConfig{
+		"registry.example.com": {CACerts: []string{"/nonexistent/ca.pem"}},
+	})
+	if err == nil {
+		t.Error("Expected error for missing CA bundle, got nil")
+	}
+
+	// 测试用例：CA 文件中没有证书
+	emptyCA := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(emptyCA, []byte("not a certificate"), 0644)
+	err = rt.Configure(map[string]config.RegistryConfig{
+		"registry.example.com": {CACerts: []string{emptyCA}},
+	})
+	if err == nil {
+		t.Error("Expected error for empty CA bundle, got nil")
+	}
+
+	// 测试用例：只设置了客户端证书
+	err = rt.Configure(map[string]config.RegistryConfig{
+		"registry.example.com": {ClientCert: "client.pem"},
+	})
+	if err == nil {
+		t.Error("Expected error for client cert without key, got nil")
+	}
+}
+
+// TestTransportNameOptions 测试按仓库匹配 name.Option
+func TestTransportNameOptions(t *testing.T) {
+	rt := NewTransport(remote.DefaultTransport.(*http.Transport).Clone())
+	if err := rt.Configure(map[string]config.RegistryConfig{
+		"registry.internal":  {PlainHTTP: true},
+		"docker.io":          {Insecure: true},
+		"secure.example.com": {},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		registry string
+		want     int
+	}{
+		{"registry.internal", 1},
+		{"registry.internal:5000", 1}, // 忽略端口匹配
+		{"index.docker.io", 1},        // docker.io 被规范化
+		{"secure.example.com", 0},
+		{"other.example.com", 0},
+	}
+	for _, tt := range tests {
+		if got := len(rt.NameOptions(tt.registry)); got != tt.want {
+			t.Errorf("NameOptions(%s): expected %d options, got %d", tt.registry, tt.want, got)
+		}
+	}
+}
@@ -47,8 +47,10 @@ type TarOptions struct {
 	User string
 	// Group 指定文件的组 ID
 	Group string
-	// Timestamp 指定文件的时间戳
-	Timestamp string
+	// Timestamp 指定文件的时间戳，零值时使用文件的修改时间
+	Timestamp time.Time
+	// MaxTimestamp 不为零值且未指定 Timestamp 时，晚于它的修改时间改为它（SOURCE_DATE_EPOCH 的约定）
+	MaxTimestamp time.Time
 }
 
 // CreateTar 创建 tar 包，支持跨平台
@@ -251,34 +253,16 @@ func addSingleFileToTar(w *tar.Writer, cwd, filePath string, info os.FileInfo, o
 	}
 
 	// 设置修改时间
-	if opt.Timestamp != "" {
-		// 尝试解析为时间戳（毫秒）
-		var ms int64
-		if _, err := fmt.Sscanf(opt.Timestamp, "%d", &ms); err == nil {
-			// 转换为纳秒
-			timestamp := time.Unix(0, ms*1000000)
-			header.ModTime = timestamp
-			header.AccessTime = timestamp
-			header.ChangeTime = timestamp
-		} else {
-			// 尝试解析为 ISO 8601 格式
-			if ts, err := time.Parse(time.RFC3339, opt.Timestamp); err == nil {
-				header.ModTime = ts
-				header.AccessTime = ts
-				header.ChangeTime = ts
-			} else {
-				// 解析失败，使用文件的修改时间
-				header.ModTime = info.ModTime()
-				header.AccessTime = info.ModTime()
-				header.ChangeTime = info.ModTime()
-			}
-		}
-	} else {
-		// 使用文件的修改时间
-		header.ModTime = info.ModTime()
-		header.AccessTime = info.ModTime()
-		header.ChangeTime = info.ModTime()
+	modTime := info.ModTime()
+	switch {
+	case !opt.Timestamp.IsZero():
+		modTime = opt.Timestamp
+	case !opt.MaxTimestamp.IsZero() && modTime.After(opt.MaxTimestamp):
+		modTime = opt.MaxTimestamp
 	}
+	header.ModTime = modTime
+	header.AccessTime = modTime
+	header.ChangeTime = modTime
 
 	// 写入 tar 头
 	if err := w.WriteHeader(header); err != nil {
@@ -0,0 +1,307 @@
+// Package trace 记录构建各阶段的耗时，并导出为 OTLP JSON 格式的 trace 文件
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanKind 定义了 span 的类型，取值与 OTLP 一致
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindClient   SpanKind = 3
+)
+
+// statusError 为 OTLP 中表示失败的状态码
+const statusError = 2
+
+// Attribute 是 span 上的一个键值对属性
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String 创建字符串属性
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int 创建整数属性
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool 创建布尔属性
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer 收集一次执行中的所有 span，nil Tracer 不记录任何内容
+type Tracer struct {
+	service string
+	version string
+	traceID string
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewTracer 创建一个 Tracer，所有 span 属于同一个 trace
+func NewTracer(service, version string) *Tracer {
+	return &Tracer{service: service, version: version, traceID: newID(16)}
+}
+
+// Span 表示一个有起止时间的操作
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     SpanKind
+	spanID   string
+	parentID string
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	status     int
+	message    string
+}
+
+type tracerKey struct{}
+type spanKey struct{}
+
+// WithTracer 返回携带 tracer 的 context，之后通过 Start 创建的 span 都记录到该 tracer
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// Start 创建一个 span，父 span 为 ctx 中的当前 span；ctx 中没有 tracer 时返回 nil span
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind 创建指定类型的 span
+func StartKind(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		spanID:     newID(8),
+		start:      time.Now(),
+		attributes: attrs,
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		s.parentID = parent.spanID
+	}
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes 添加属性
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attrs...)
+}
+
+// SetError 将 span 标记为失败，err 为 nil 时不做任何事
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = statusError
+	s.message = err.Error()
+}
+
+// End 结束 span，重复调用只记录第一次的结束时间
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+}
+
+// WriteFile 将所有 span 以 OTLP JSON 格式写入文件
+func (t *Tracer) WriteFile(path string) error {
+	if t == nil {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create trace file %s: %w", path, err)
+	}
+	if err := t.Encode(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write trace file %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Encode 将所有 span 以 OTLP JSON 格式（ExportTraceServiceRequest）写入 w
+// 未结束的 span 以编码时间作为结束时间
+func (t *Tracer) Encode(w io.Writer) error {
+	t.mu.Lock()
+	spans := make([]*Span, len(t.spans))
+	copy(spans, t.spans)
+	t.mu.Unlock()
+
+	now := time.Now()
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, s.encode(t.traceID, now))
+	}
+
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", t.service), String("service.version", t.version)})},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: t.service, Version: t.version},
+				Spans: encoded,
+			}},
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(req)
+}
+
+// encode 将 span 转换为 OTLP JSON 结构
+func (s *Span) encode(traceID string, now time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.end
+	if end.IsZero() {
+		end = now
+	}
+	return otlpSpan{
+		TraceID:           traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              int(s.kind),
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        encodeAttributes(s.attributes),
+		Status:            otlpStatus{Code: s.status, Message: s.message},
+	}
+}
+
+// encodeAttributes 将属性转换为 OTLP 的 KeyValue 列表
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	result := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch val := a.Value.(type) {
+		case string:
+			v.StringValue = &val
+		case int64:
+			s := strconv.FormatInt(val, 10)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &val
+		default:
+			s := fmt.Sprint(val)
+			v.StringValue = &s
+		}
+		result = append(result, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return result
+}
+
+// newID 生成 n 字节的随机 ID（十六进制）
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// 随机数不可用时退化为时间戳，ID 只用于关联 span
+		ts := uint64(time.Now().UnixNano())
+		for i := range b {
+			b[i] = byte(ts >> (8 * (i % 8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+// 以下为 OTLP JSON（opentelemetry-proto 的 JSON 映射）结构
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestStartWithoutTracer 测试没有 tracer 时不记录 span
+func TestStartWithoutTracer(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil {
+		t.Error("Expected nil span without tracer")
+	}
+	// nil span 的方法不应 panic
+	span.SetAttributes(String("k", "v"))
+	span.SetError(errors.New("ignored"))
+	span.End()
+	if ctx != context.Background() {
+		t.Error("Expected context to be unchanged")
+	}
+}
+
+// TestEncode 测试 span 的父子关系和 OTLP JSON 编码
+func TestEncode(t *testing.T) {
+	tracer := NewTracer("crane-jib-tool", "v1.0.0")
+	ctx := WithTracer(context.Background(), tracer)
+
+	ctx, root := Start(ctx, "build", String("config", "build.yaml"))
+	_, child := StartKind(ctx, "HTTP GET", KindClient, Int("http.response.status_code", 200), Bool("retry", false))
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+
+	var buf bytes.Buffer
+	if err := tracer.Encode(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		t.Fatalf("Failed to decode trace: %v", err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[1].ParentSpanID != spans[0].SpanID {
+		t.Errorf("Expected child parent %s, got %s", spans[0].SpanID, spans[1].ParentSpanID)
+	}
+	if spans[0].TraceID != spans[1].TraceID || len(spans[0].TraceID) != 32 || len(spans[0].SpanID) != 16 {
+		t.Errorf("Unexpected ids: %+v", spans)
+	}
+	if spans[1].Kind != int(KindClient) || spans[1].Status.Code != statusError || spans[1].Status.Message != "boom" {
+		t.Errorf("Unexpected child span: %+v", spans[1])
+	}
+	if v := spans[1].Attributes[0].Value.IntValue; v == nil || *v != "200" {
+		t.Errorf("Expected intValue 200, got %+v", spans[1].Attributes[0].Value)
+	}
+}